@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/azhai/gozzo/logging"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -40,19 +42,34 @@ func (r *RedisStream) Size() int {
 	return r.DataSize(r.name, r.Type())
 }
 
-// Receive 接收消息
+// Receive 接收消息，处理消息时的panic会写入崩溃报告，不影响后续消息
 func (r *RedisStream) Receive(workers int, handler HandlerFunc) {
+	go r.Consume(context.Background(), workers, handler)
+}
+
+// Consume 接收消息直到ctx取消，等待处理中的消息完成后返回
+func (r *RedisStream) Consume(ctx context.Context, workers int, handler HandlerFunc) {
+	var wg sync.WaitGroup
 	for i := 0; i < workers; i++ {
+		wg.Add(1)
 		customerName := fmt.Sprintf("customer-%04d", i)
 		go func(name string) {
-			for {
+			defer wg.Done()
+			for ctx.Err() == nil {
 				topic, msgs := r.ReadMessages(name, 1)
 				if topic != "" && len(msgs) == 1 {
-					handler(r, msgs[0].Values, msgs[0].ID, name)
+					r.handle(handler, msgs[0], name)
 				}
 			}
 		}(customerName)
 	}
+	wg.Wait()
+}
+
+// handle 处理一条消息，捕获其中的panic
+func (r *RedisStream) handle(handler HandlerFunc, msg redis.XMessage, name string) {
+	defer logging.Recover(false)
+	handler(r, msg.Values, msg.ID, name)
 }
 
 // Send 发送多条消息
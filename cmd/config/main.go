@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/azhai/gozzo/config"
+)
+
+const Version = "1.0.0"
+
+var (
+	toFormat, outFile, envPrefix string
+	schemaFormat                 string
+	rawFile, decrypt             bool
+)
+
+func init() {
+	flag.StringVar(&toFormat, "to", "", "output format: hcl, json, yaml or toml, default by -o or the input file")
+	flag.StringVar(&outFile, "o", "", "write to the file instead of stdout")
+	flag.StringVar(&envPrefix, "env", "", "prefix of environment variables which override the config")
+	flag.StringVar(&schemaFormat, "schema", "", "print the schema of config as json, hcl or md, without file")
+	flag.BoolVar(&rawFile, "raw", false, "only the given file, without the local file and environment")
+	flag.BoolVar(&decrypt, "decrypt", false, "output secrets in plain text, they are kept as decrypt(...) by default")
+	flag.Usage = usage
+	flag.Parse()
+}
+
+func main() {
+	if schemaFormat != "" {
+		if err := printSchema(); err != nil {
+			exitOnError(err)
+		}
+		return
+	}
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	file := flag.Arg(0)
+	data, err := loadData(file)
+	if err != nil {
+		exitOnError(err)
+	}
+	if toFormat == "" {
+		if toFormat = config.FileFormat(file); outFile != "" {
+			toFormat = config.FileFormat(outFile)
+		}
+	}
+	output, err := config.EncodeData(data, toFormat)
+	if err != nil {
+		exitOnError(err)
+	}
+	if outFile == "" {
+		_, err = os.Stdout.Write(output)
+	} else {
+		err = os.WriteFile(outFile, output, 0o644)
+	}
+	if err != nil {
+		exitOnError(err)
+	}
+}
+
+// usage 使用帮助
+func usage() {
+	out := flag.CommandLine.Output()
+	desc := `Version: v%s
+Usage: config [flags] file
+  e.g. config -env APP -to yaml settings.hcl
+       config -raw -o settings.toml settings.hcl
+       config -schema md
+`
+	_, _ = fmt.Fprintf(out, desc, Version)
+	flag.PrintDefaults()
+}
+
+func exitOnError(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+// loadData 读取配置，默认合并本地配置文件和环境变量，不解密secret
+func loadData(file string) (map[string]any, error) {
+	opts := &config.EvalOptions{KeepSecrets: !decrypt}
+	if rawFile {
+		return config.EvalFileData(file, opts)
+	}
+	loader := config.NewLoader(file, envPrefix)
+	loader.Eval = opts
+	return loader.Effective()
+}
+
+// printSchema 输出配置项的JSON Schema、示例配置或Markdown参考表
+func printSchema() (err error) {
+	var output []byte
+	schema := config.NewConfigSchema(nil, nil)
+	switch schemaFormat {
+	case "json":
+		if output, err = schema.JSONSchema(); err == nil {
+			output = append(output, '\n')
+		}
+	case "hcl":
+		output = schema.ExampleHCL()
+	case "md", "markdown":
+		output = []byte(schema.Markdown())
+	default:
+		err = fmt.Errorf("unknown schema format %q", schemaFormat)
+	}
+	if err == nil {
+		_, err = os.Stdout.Write(output)
+	}
+	return
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/azhai/gozzo/logging"
+)
+
+const Version = "1.0.0"
+
+var (
+	timeFormat, since, until string
+	minLevel, maxLevel       string
+	keyword                  string
+	fields                   fieldList
+	limit                    int
+	asJSON, listFiles        bool
+)
+
+// fieldList 可重复的 key=value 参数
+type fieldList map[string]string
+
+func (f fieldList) String() string {
+	return fmt.Sprint(map[string]string(f))
+}
+
+func (f fieldList) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("field must be key=value: %s", value)
+	}
+	f[key] = val
+	return nil
+}
+
+func init() {
+	fields = make(fieldList)
+	flag.StringVar(&timeFormat, "t", "2006-01-02 15:04:05", "time format of the log")
+	flag.StringVar(&since, "since", "", "only entries at or after this time")
+	flag.StringVar(&until, "until", "", "only entries before this time")
+	flag.StringVar(&minLevel, "level", "", "minimum level")
+	flag.StringVar(&maxLevel, "max", "", "maximum level")
+	flag.StringVar(&keyword, "grep", "", "message contains the keyword")
+	flag.Var(fields, "f", "field equals value, as key=value (repeatable)")
+	flag.IntVar(&limit, "n", 0, "stop after n entries, 0 means no limit")
+	flag.BoolVar(&asJSON, "json", false, "output entries as json")
+	flag.BoolVar(&listFiles, "l", false, "list log files only")
+	flag.Usage = usage
+	flag.Parse()
+}
+
+func main() {
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	query, err := buildQuery()
+	if err != nil {
+		exitOnError(err)
+	}
+	for _, file := range flag.Args() {
+		if err = queryFile(file, query); err != nil {
+			exitOnError(err)
+		}
+	}
+}
+
+// usage 使用帮助
+func usage() {
+	out := flag.CommandLine.Output()
+	desc := `Version: v%s
+Usage: logq [flags] file|rotate-url ...
+  e.g. logq -level warn -since "2024-01-01 08:00:00" "rotate://logs/access.log?cycle=daily"
+`
+	_, _ = fmt.Fprintf(out, desc, Version)
+	flag.PrintDefaults()
+}
+
+func exitOnError(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+// buildQuery 根据命令行参数生成过滤条件
+func buildQuery() (q *logging.LogQuery, err error) {
+	q = &logging.LogQuery{
+		MinLevel: minLevel, MaxLevel: maxLevel,
+		Keyword: keyword, Fields: fields,
+	}
+	if since != "" {
+		if q.Since, err = time.ParseInLocation(timeFormat, since, time.Local); err != nil {
+			return
+		}
+	}
+	if until != "" {
+		q.Until, err = time.ParseInLocation(timeFormat, until, time.Local)
+	}
+	return
+}
+
+// queryFile 查询当前日志和它的备份
+func queryFile(file string, query *logging.LogQuery) error {
+	reader, err := logging.NewLogReaderURL(file, timeFormat)
+	if err != nil {
+		return err
+	}
+	if listFiles {
+		var files []string
+		if files, err = reader.Files(); err == nil {
+			fmt.Println(strings.Join(files, "\n"))
+		}
+		return err
+	}
+	count := 0
+	return reader.Query(query, func(e *logging.LogEntry) bool {
+		if asJSON {
+			data, _ := json.Marshal(e)
+			fmt.Println(string(data))
+		} else {
+			fmt.Println(e.Raw)
+		}
+		count++
+		return limit <= 0 || count < limit
+	})
+}
@@ -0,0 +1,350 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"sync"
+	"syscall"
+	"time"
+
+	fs "github.com/azhai/gozzo/filesystem"
+	"github.com/azhai/gozzo/logging"
+)
+
+// 应用的默认值
+const (
+	DefaultConfigFile  = "settings.hcl"
+	DefaultStopTimeout = 10 * time.Second
+)
+
+// Component 随应用启动和停止的组件，Start不能阻塞，Stop需要在ctx结束前返回
+type Component interface {
+	Name() string
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// Notifier 可选接口，组件在后台运行出错时从通道发出错误，应用随之停止
+type Notifier interface {
+	Errors() <-chan error
+}
+
+// App 应用的启动和生命周期，依次解析参数、读取配置、初始化日志、启动组件，
+// 收到SIGINT或SIGTERM后按相反顺序停止组件
+type App struct {
+	Name        string
+	ConfigFile  string        // 配置文件，可以用 -c 参数修改
+	EnvPrefix   string        // 环境变量前缀，为空时不读环境变量
+	Remain      any           // 用户的剩余配置，不为空时解析
+	StopTimeout time.Duration // 停止全部组件的总时间
+	Flags       *flag.FlagSet
+	Loader      *Loader
+	Root        *RootConfig
+	components  []Component
+	started     []Component
+	mu          sync.Mutex
+}
+
+// NewApp 创建应用，命令行参数可以在Run之前加入Flags
+func NewApp(name string) *App {
+	a := &App{
+		Name: name, ConfigFile: DefaultConfigFile, StopTimeout: DefaultStopTimeout,
+		Flags: flag.NewFlagSet(name, flag.ContinueOnError),
+	}
+	a.Flags.StringVar(&a.ConfigFile, "c", a.ConfigFile, "config file")
+	return a
+}
+
+// Register 按启动顺序加入组件
+func (a *App) Register(comps ...Component) *App {
+	a.mu.Lock()
+	a.components = append(a.components, comps...)
+	a.mu.Unlock()
+	return a
+}
+
+// Init 解析命令行参数，读取配置并初始化日志和内存限制
+// 没有修改配置文件且默认的配置文件不存在时，只使用默认值、环境变量和命令行参数
+func (a *App) Init(args []string) error {
+	if a.Loader == nil {
+		a.Loader = NewLoader(a.ConfigFile, a.EnvPrefix)
+	}
+	a.Loader.BindFlags(a.Flags)
+	if err := a.Flags.Parse(args); err != nil {
+		return err
+	}
+	a.Loader.File = a.ConfigFile
+	if !isFlagSet(a.Flags, "c") && !fs.File(a.ConfigFile).IsExist() {
+		a.Loader.File = ""
+	}
+	root, err := a.Loader.Load(a.Remain)
+	if err != nil {
+		return err
+	}
+	a.Root = root
+	if root.Log == nil {
+		root.Log = &LogConfig{}
+	}
+	if err = ReplaceLog(root.Log); err != nil {
+		return err
+	}
+	if root.App != nil {
+		SetMemoryLimit(root.App.MemoryLimit)
+	}
+	return nil
+}
+
+// Start 按顺序启动组件，出错时停止已启动的组件
+func (a *App) Start(ctx context.Context) error {
+	a.mu.Lock()
+	comps := append([]Component{}, a.components...)
+	a.mu.Unlock()
+	for _, comp := range comps {
+		if err := comp.Start(ctx); err != nil {
+			err = fmt.Errorf("start %s: %w", comp.Name(), err)
+			return errors.Join(err, a.Stop(context.Background()))
+		}
+		logging.Infof("%s started", comp.Name())
+		a.mu.Lock()
+		a.started = append(a.started, comp)
+		a.mu.Unlock()
+	}
+	return nil
+}
+
+// Stop 按启动的相反顺序停止组件，超过StopTimeout时不再等待
+func (a *App) Stop(ctx context.Context) error {
+	timeout := a.StopTimeout
+	if timeout <= 0 {
+		timeout = DefaultStopTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	a.mu.Lock()
+	started := a.started
+	a.started = nil
+	a.mu.Unlock()
+
+	var errs []error
+	for i := len(started) - 1; i >= 0; i-- {
+		comp := started[i]
+		done := make(chan error, 1)
+		go func() {
+			defer logging.Recover(false)
+			done <- comp.Stop(ctx)
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				errs = append(errs, fmt.Errorf("stop %s: %w", comp.Name(), err))
+			} else {
+				logging.Infof("%s stopped", comp.Name())
+			}
+		case <-ctx.Done():
+			errs = append(errs, fmt.Errorf("stop %s: %w", comp.Name(), ctx.Err()))
+		}
+	}
+	if err := logging.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Run 初始化并启动应用，等待信号、ctx结束或组件出错后停止
+func (a *App) Run(ctx context.Context, args []string) error {
+	if err := a.Init(args); err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := a.Start(ctx); err != nil {
+		return err
+	}
+	var runErr error
+	select {
+	case <-ctx.Done():
+		logging.Infof("%s is shutting down", a.Name)
+	case runErr = <-a.errors():
+		logging.Errorf("%s is shutting down: %v", a.Name, runErr)
+	}
+	stop() // 再次收到信号时直接退出
+	return errors.Join(runErr, a.Stop(context.Background()))
+}
+
+// errors 合并组件的错误通道
+func (a *App) errors() <-chan error {
+	result := make(chan error, 1)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, comp := range a.started {
+		if n, ok := comp.(Notifier); ok {
+			go func(name string, ch <-chan error) {
+				if err, ok := <-ch; ok && err != nil {
+					select {
+					case result <- fmt.Errorf("%s: %w", name, err):
+					default:
+					}
+				}
+			}(comp.Name(), n.Errors())
+		}
+	}
+	return result
+}
+
+// isFlagSet 命令行中是否设置了参数
+func isFlagSet(flags *flag.FlagSet, name string) (found bool) {
+	flags.Visit(func(f *flag.Flag) {
+		found = found || f.Name == name
+	})
+	return
+}
+
+// SetMemoryLimit 设置软内存上限，单位MB，取代以前的压舱石
+// 已经设置了环境变量GOMEMLIMIT或者mb不大于0时不修改，返回当前的上限
+func SetMemoryLimit(mb int) int64 {
+	if mb > 0 && os.Getenv("GOMEMLIMIT") == "" {
+		debug.SetMemoryLimit(int64(mb) * MegaByte)
+	}
+	return debug.SetMemoryLimit(-1)
+}
+
+// funcComponent 用函数实现的组件
+type funcComponent struct {
+	name  string
+	start func(ctx context.Context) error
+	stop  func(ctx context.Context) error
+}
+
+// NewComponent 用启动和停止函数创建组件，函数可以为空
+func NewComponent(name string, start, stop func(ctx context.Context) error) Component {
+	return &funcComponent{name: name, start: start, stop: stop}
+}
+
+// Name 组件名称
+func (c *funcComponent) Name() string {
+	return c.name
+}
+
+// Start 启动组件
+func (c *funcComponent) Start(ctx context.Context) error {
+	if c.start == nil {
+		return nil
+	}
+	return c.start(ctx)
+}
+
+// Stop 停止组件
+func (c *funcComponent) Stop(ctx context.Context) error {
+	if c.stop == nil {
+		return nil
+	}
+	return c.stop(ctx)
+}
+
+// Worker 在后台运行直到ctx取消的组件，例如Redis消息队列的消费者
+type Worker struct {
+	name   string
+	run    func(ctx context.Context) error
+	cancel context.CancelFunc
+	done   chan struct{}
+	errs   chan error
+}
+
+// NewWorker 创建后台任务，run需要在ctx取消后尽快返回
+func NewWorker(name string, run func(ctx context.Context) error) *Worker {
+	return &Worker{name: name, run: run, errs: make(chan error, 1)}
+}
+
+// Name 组件名称
+func (w *Worker) Name() string {
+	return w.name
+}
+
+// Start 在后台运行，panic会写入崩溃报告并作为错误返回
+func (w *Worker) Start(ctx context.Context) error {
+	ctx, w.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	w.done = make(chan struct{})
+	go func() {
+		defer close(w.done)
+		defer func() {
+			if v := recover(); v != nil {
+				w.errs <- logging.HandlePanic(v, false)
+			}
+		}()
+		if err := w.run(ctx); err != nil && ctx.Err() == nil {
+			w.errs <- err
+		}
+	}()
+	return nil
+}
+
+// Stop 取消并等待结束
+func (w *Worker) Stop(ctx context.Context) error {
+	if w.cancel == nil {
+		return nil
+	}
+	w.cancel()
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Errors 实现Notifier
+func (w *Worker) Errors() <-chan error {
+	return w.errs
+}
+
+// HTTPServer 作为组件的HTTP服务
+type HTTPServer struct {
+	*http.Server
+	errs chan error
+}
+
+// NewHTTPServer 创建HTTP服务组件
+func NewHTTPServer(srv *http.Server) *HTTPServer {
+	return &HTTPServer{Server: srv, errs: make(chan error, 1)}
+}
+
+// Name 组件名称
+func (s *HTTPServer) Name() string {
+	return "http " + s.Addr
+}
+
+// Start 先监听端口，端口被占用时直接返回错误，然后在后台服务
+func (s *HTTPServer) Start(_ context.Context) error {
+	addr := s.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.Addr = ln.Addr().String()
+	go func() {
+		if err := s.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.errs <- err
+		}
+	}()
+	return nil
+}
+
+// Stop 优雅关闭，等待处理中的请求
+func (s *HTTPServer) Stop(ctx context.Context) error {
+	return s.Shutdown(ctx)
+}
+
+// Errors 实现Notifier
+func (s *HTTPServer) Errors() <-chan error {
+	return s.errs
+}
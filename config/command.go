@@ -0,0 +1,393 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/azhai/gozzo/mapper"
+)
+
+// Command 命令行命令，可以嵌套子命令，参数绑定到Options结构体的字段
+// 字段标签 flag:"name" 为参数名，short:"n" 为短参数名，usage:"..." 为说明，
+// config:"log.log_level" 表示参数同时覆盖配置项，需要设置Loader
+type Command struct {
+	Name     string
+	Usage    string // 一行说明
+	Options  any    // 绑定参数的结构体指针，可以为空
+	Loader   *Loader
+	Run      func(cmd *Command, args []string) error
+	Output   io.Writer // 帮助信息的输出，默认为标准错误
+	parent   *Command
+	commands []*Command
+	flags    *flag.FlagSet
+	infos    []*flagInfo
+	bound    bool
+}
+
+// flagInfo 参数的说明和绑定的配置项
+type flagInfo struct {
+	name, short, typ, usage, key string
+	value                        flag.Value
+}
+
+// NewCommand 创建命令
+func NewCommand(name, usage string, options any, run func(cmd *Command, args []string) error) *Command {
+	return &Command{Name: name, Usage: usage, Options: options, Run: run}
+}
+
+// AddCommand 加入子命令
+func (c *Command) AddCommand(subs ...*Command) *Command {
+	for _, sub := range subs {
+		sub.parent = c
+		c.commands = append(c.commands, sub)
+	}
+	return c
+}
+
+// Commands 全部子命令
+func (c *Command) Commands() []*Command {
+	return c.commands
+}
+
+// Path 从根命令开始的完整名称
+func (c *Command) Path() string {
+	if c.parent == nil {
+		return c.Name
+	}
+	return c.parent.Path() + " " + c.Name
+}
+
+// Flags 命令的参数集合
+func (c *Command) Flags() *flag.FlagSet {
+	if c.flags == nil {
+		c.flags = flag.NewFlagSet(c.Name, flag.ContinueOnError)
+		c.flags.SetOutput(io.Discard)
+		c.flags.Usage = func() {}
+	}
+	return c.flags
+}
+
+// BindKey 增加一个直接覆盖配置项的文字参数
+func (c *Command) BindKey(name, key, usage string) *Command {
+	value := &flagValue{}
+	c.Flags().Var(value, name, usage)
+	c.infos = append(c.infos, &flagInfo{name: name, typ: "string", usage: usage, key: key, value: value})
+	return c
+}
+
+// bindOptions 按标签把Options的字段绑定为参数
+func (c *Command) bindOptions() error {
+	flags := c.Flags()
+	if c.Options == nil || c.bound {
+		return nil
+	}
+	c.bound = true
+	var errs []error
+	_ = mapper.TravelStruct(c.Options, "flag", false, func(field *mapper.StructField, opt *mapper.TagOpt) error {
+		typ := flagType(field.Type)
+		if typ == "" {
+			errs = append(errs, fmt.Errorf("unsupported type %s of flag %s", field.Type, opt.Name))
+			return nil
+		}
+		info := &flagInfo{
+			name: opt.Name, short: field.GetTag("short"), typ: typ,
+			usage: field.GetTag("usage"), key: field.GetTag("config"),
+			value: &fieldValue{field: field},
+		}
+		flags.Var(info.value, info.name, info.usage)
+		if info.short != "" {
+			flags.Var(info.value, info.short, info.usage)
+		}
+		c.infos = append(c.infos, info)
+		return nil
+	})
+	return errors.Join(errs...)
+}
+
+// Execute 解析参数并执行命令，参数之后的第一个位置参数是子命令名称时交给子命令
+func (c *Command) Execute(args []string) error {
+	if err := c.bindOptions(); err != nil {
+		return err
+	}
+	if err := c.Flags().Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			c.PrintHelp()
+			return nil
+		}
+		return fmt.Errorf("%s: %w", c.Path(), err)
+	}
+	if err := c.applyConfig(); err != nil {
+		return err
+	}
+	rest := c.flags.Args()
+	if len(rest) > 0 {
+		if sub := c.Find(rest[0]); sub != nil {
+			return sub.Execute(rest[1:])
+		}
+	}
+	if c.Run == nil {
+		if len(rest) > 0 && len(c.commands) > 0 {
+			return fmt.Errorf("%s: unknown command %q", c.Path(), rest[0])
+		}
+		c.PrintHelp()
+		return nil
+	}
+	return c.Run(c, rest)
+}
+
+// Find 按名称找到子命令
+func (c *Command) Find(name string) *Command {
+	for _, sub := range c.commands {
+		if sub.Name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+// loader 自己或上级命令的Loader
+func (c *Command) loader() *Loader {
+	for cmd := c; cmd != nil; cmd = cmd.parent {
+		if cmd.Loader != nil {
+			return cmd.Loader
+		}
+	}
+	return nil
+}
+
+// applyConfig 命令行中设置了的参数覆盖绑定的配置项
+func (c *Command) applyConfig() error {
+	set := make(map[string]bool)
+	c.flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for _, info := range c.infos {
+		if info.key == "" || !set[info.name] && !set[info.short] {
+			continue
+		}
+		l := c.loader()
+		if l == nil {
+			return fmt.Errorf("%s: flag -%s is bound to config %s but no loader", c.Path(), info.name, info.key)
+		}
+		l.Override(info.key, info.value.String(), SourceFlag+"-"+info.name)
+	}
+	return nil
+}
+
+// PrintHelp 输出帮助信息
+func (c *Command) PrintHelp() {
+	out := c.Output
+	for cmd := c; out == nil && cmd != nil; cmd = cmd.parent {
+		out = cmd.Output
+	}
+	if out == nil {
+		out = os.Stderr
+	}
+	_, _ = io.WriteString(out, c.Help())
+}
+
+// Help 生成帮助信息
+func (c *Command) Help() string {
+	_ = c.bindOptions()
+	var buf strings.Builder
+	buf.WriteString("Usage: " + c.Path())
+	if len(c.infos) > 0 {
+		buf.WriteString(" [flags]")
+	}
+	if len(c.commands) > 0 {
+		buf.WriteString(" <command>")
+	}
+	buf.WriteString(" [args]\n")
+	if c.Usage != "" {
+		buf.WriteString("\n" + c.Usage + "\n")
+	}
+	if len(c.commands) > 0 {
+		buf.WriteString("\nCommands:\n")
+		width := 0
+		for _, sub := range c.commands {
+			width = max(width, len(sub.Name))
+		}
+		for _, sub := range c.commands {
+			fmt.Fprintf(&buf, "  %-*s  %s\n", width, sub.Name, sub.Usage)
+		}
+	}
+	if len(c.infos) > 0 {
+		buf.WriteString("\nFlags:\n")
+		names := make([]string, len(c.infos))
+		width := 0
+		for i, info := range c.infos {
+			if names[i] = "-" + info.name; info.short != "" {
+				names[i] = "-" + info.short + ", " + names[i]
+			}
+			if info.typ != "bool" {
+				names[i] += " " + info.typ
+			}
+			width = max(width, len(names[i]))
+		}
+		for i, info := range c.infos {
+			usage := info.usage
+			if def := info.value.String(); def != "" && def != "false" && def != "0" {
+				usage += fmt.Sprintf(" (default %s)", def)
+			}
+			if info.key != "" {
+				usage += " [config " + info.key + "]"
+			}
+			fmt.Fprintf(&buf, "  %-*s  %s\n", width, names[i], strings.TrimSpace(usage))
+		}
+	}
+	return buf.String()
+}
+
+// Completion 生成bash或zsh的自动补全脚本，只能用于根命令
+func (c *Command) Completion(shell string) (string, error) {
+	var buf strings.Builder
+	switch shell {
+	case "bash":
+	case "zsh":
+		buf.WriteString("#compdef " + c.Name + "\nautoload -U +X bashcompinit && bashcompinit\n\n")
+	default:
+		return "", fmt.Errorf("unsupported shell %q, only bash and zsh", shell)
+	}
+	fn := "_" + strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return '_'
+		}
+		return r
+	}, c.Name) + "_complete"
+	var paths, cases []string
+	var walk func(cmd *Command, path string)
+	walk = func(cmd *Command, path string) {
+		_ = cmd.bindOptions()
+		var words []string
+		for _, sub := range cmd.commands {
+			words = append(words, sub.Name)
+			paths = append(paths, `"`+path+" "+sub.Name+`"`)
+		}
+		for _, info := range cmd.infos {
+			words = append(words, "-"+info.name)
+			if info.short != "" {
+				words = append(words, "-"+info.short)
+			}
+		}
+		cases = append(cases, fmt.Sprintf("    %q) words=%q ;;", path, strings.Join(words, " ")))
+		for _, sub := range cmd.commands {
+			walk(sub, path+" "+sub.Name)
+		}
+	}
+	walk(c, "")
+	sort.Strings(paths)
+	fmt.Fprintf(&buf, "%s() {\n", fn)
+	buf.WriteString("  local cur=\"${COMP_WORDS[COMP_CWORD]}\" path=\"\" words=\"\" i\n")
+	buf.WriteString("  for ((i=1; i<COMP_CWORD; i++)); do\n")
+	buf.WriteString("    case \"$path ${COMP_WORDS[i]}\" in\n")
+	if len(paths) > 0 {
+		fmt.Fprintf(&buf, "      %s) path=\"$path ${COMP_WORDS[i]}\" ;;\n", strings.Join(paths, "|"))
+	}
+	buf.WriteString("    esac\n  done\n  case \"$path\" in\n")
+	buf.WriteString(strings.Join(cases, "\n"))
+	buf.WriteString("\n  esac\n  COMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n}\n")
+	fmt.Fprintf(&buf, "complete -F %s %s\n", fn, c.Name)
+	return buf.String(), nil
+}
+
+// NewCompletionCommand 输出自动补全脚本的子命令，例如 app completion bash
+func NewCompletionCommand(root *Command) *Command {
+	return NewCommand("completion", "print the completion script of bash or zsh", nil,
+		func(cmd *Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("usage: %s bash|zsh", cmd.Path())
+			}
+			script, err := root.Completion(args[0])
+			if err == nil {
+				out := root.Output
+				if out == nil {
+					out = os.Stdout
+				}
+				_, err = io.WriteString(out, script)
+			}
+			return err
+		})
+}
+
+// flagType 参数类型的名称，不支持时为空
+func flagType(vt reflect.Type) string {
+	if vt == durationType {
+		return "duration"
+	}
+	switch vt.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "int"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "uint"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Slice:
+		if vt.Elem().Kind() == reflect.String {
+			return "list"
+		}
+	}
+	return ""
+}
+
+// fieldValue 绑定到结构体字段的参数，数组可以重复设置或用逗号分隔
+type fieldValue struct {
+	field *mapper.StructField
+	set   bool
+}
+
+// String 实现flag.Value
+func (v *fieldValue) String() string {
+	if v == nil || v.field == nil {
+		return ""
+	}
+	value := v.field.Value
+	if v.field.Type.Kind() == reflect.Slice {
+		items := make([]string, value.Len())
+		for i := range items {
+			items[i] = value.Index(i).String()
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value.Interface())
+}
+
+// Set 实现flag.Value
+func (v *fieldValue) Set(value string) error {
+	field := v.field
+	if field.Type == durationType {
+		d, err := time.ParseDuration(value)
+		if err == nil {
+			field.Value.SetInt(int64(d))
+		}
+		return err
+	}
+	if field.Type.Kind() == reflect.Slice {
+		if !v.set { // 第一次设置时替换默认值
+			field.Value.Set(reflect.MakeSlice(field.Type, 0, 1))
+		}
+		v.set = true
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				field.Value.Set(reflect.Append(field.Value, reflect.ValueOf(item).Convert(field.Type.Elem())))
+			}
+		}
+		return nil
+	}
+	return setFieldString(field, value)
+}
+
+// IsBoolFlag 布尔参数可以省略值
+func (v *fieldValue) IsBoolFlag() bool {
+	return v.field != nil && v.field.Type.Kind() == reflect.Bool
+}
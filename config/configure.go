@@ -4,14 +4,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
 
 	fs "github.com/azhai/gozzo/filesystem"
 	"github.com/azhai/gozzo/logging"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/gohcl"
-	"github.com/hashicorp/hcl/v2/hclsimple"
 	. "github.com/klauspost/cpuid/v2"
 	"go.uber.org/zap"
 )
@@ -19,6 +17,8 @@ import (
 const (
 	MegaByte = 1024 * 1024
 	NoDiags  = "no diagnostics"
+
+	DefaultCrashLogs = 100 // 崩溃报告中默认保留的最近日志条数
 )
 
 func filterError(err error) error {
@@ -31,8 +31,10 @@ func filterError(err error) error {
 // RootConfig 顶层配置，包含其他配置块
 type RootConfig struct {
 	file   string
+	files  []string // 读取过的配置文件，包括本地配置和包含的文件
 	parsed bool
-	Debug  bool       `hcl:"debug" json:"debug"`
+	ctx    *hcl.EvalContext
+	Debug  bool       `hcl:"debug,optional" json:"debug"`
 	App    *AppConfig `hcl:"app,block" json:"app"`
 	Log    *LogConfig `hcl:"log,block" json:"log,omitempty"`
 	Remain hcl.Body   `hcl:",remain"`
@@ -40,16 +42,23 @@ type RootConfig struct {
 
 // AppConfig App配置，包括App名称和自定义配置
 type AppConfig struct {
-	Name    string   `hcl:"name,optional" json:"name,omitempty"`
-	Version string   `hcl:"version,optional" json:"version,omitempty"`
-	Remain  hcl.Body `hcl:",remain"`
+	Name        string   `hcl:"name,optional" json:"name,omitempty"`
+	Version     string   `hcl:"version,optional" json:"version,omitempty"`
+	MemoryLimit int      `hcl:"memory_limit,optional" json:"memory_limit,omitempty" validate:"min=0"` // 软内存上限，单位MB
+	Remain      hcl.Body `hcl:",remain"`
 }
 
-// LogConfig 日志配置，指定文件夹或URL文件
+// LogConfig 日志配置，指定文件夹或URL文件，或者使用output块分别配置多个输出
 type LogConfig struct {
-	LogLevel string `hcl:"log_level,optional" json:"log_level,omitempty"`
-	LogFile  string `hcl:"log_file,optional" json:"log_file,omitempty"`
-	LogDir   string `hcl:"log_dir,optional" json:"log_dir,omitempty"`
+	LogLevel   string          `hcl:"log_level,optional" json:"log_level,omitempty"`
+	LogFile    string          `hcl:"log_file,optional" json:"log_file,omitempty"`
+	LogDir     string          `hcl:"log_dir,optional" json:"log_dir,omitempty"`
+	Encoding   string          `hcl:"encoding,optional" json:"encoding,omitempty" validate:"oneof=console json"`
+	TimeFormat string          `hcl:"time_format,optional" json:"time_format,omitempty"`
+	LevelCase  string          `hcl:"level_case,optional" json:"level_case,omitempty"`
+	CrashLogs  int             `hcl:"crash_logs,optional" json:"crash_logs,omitempty"` // 崩溃报告中最近日志的条数，负数时不保留
+	Outputs    []*OutputConfig `hcl:"output,block" json:"outputs,omitempty"`
+	Redact     *RedactConfig   `hcl:"redact,block" json:"redact,omitempty"`
 }
 
 // ReadConfigFile 读取配置文件
@@ -70,18 +79,26 @@ func (c *RootConfig) ParseFile(force bool) error {
 	if !fh.IsExist() {
 		return fh.Error()
 	}
-	err := hclsimple.DecodeFile(c.file, nil, c)
+	var err error
+	c.ctx, c.files, err = decodeConfigFiles(c.file, nil, c)
 	c.parsed = true
 	return filterError(err)
 }
 
+// Files 读取过的配置文件，包括本地配置和包含的文件
+func (c *RootConfig) Files() []string {
+	return c.files
+}
+
 // ParseRemain 解析剩下的配置
 func (c *RootConfig) ParseRemain(remain any) error {
 	if remain == nil {
 		return nil
 	}
-	err := gohcl.DecodeBody(c.Remain, nil, remain)
-	return filterError(err)
+	if err := filterError(gohcl.DecodeBody(c.Remain, c.ctx, remain)); err != nil {
+		return err
+	}
+	return ValidateStruct(remain, c.Remain)
 }
 
 // ParseAppRemain 解析剩下的配置
@@ -89,30 +106,62 @@ func (c *RootConfig) ParseAppRemain(remain any) error {
 	if remain == nil {
 		return nil
 	}
-	err := gohcl.DecodeBody(c.App.Remain, nil, remain)
-	return filterError(err)
+	if err := filterError(gohcl.DecodeBody(c.App.Remain, c.ctx, remain)); err != nil {
+		return err
+	}
+	return ValidateStruct(remain, c.App.Remain)
 }
 
-// SetupLog 根据配置初始化日志单例
+// SetupLog 根据配置初始化日志单例，出错时panic
 func SetupLog(cfg *LogConfig) {
-	var logger *zap.SugaredLogger
-	if cfg.LogFile != "" {
+	if err := ReplaceLog(cfg); err != nil {
+		panic(err)
+	}
+}
+
+// ReplaceLog 根据配置替换日志单例，并关闭原来的日志，可以在其他协程记录日志时调用
+// 仍然持有原来日志的地方，之后写入的日志会转给新的日志单例
+func ReplaceLog(cfg *LogConfig) error {
+	logger, err := BuildLog(cfg)
+	if err != nil {
+		return err
+	}
+	recent := cfg.CrashLogs
+	if recent == 0 {
+		recent = DefaultCrashLogs
+	}
+	logging.EnableCrashReport(cfg.LogDir, recent)
+	old := logging.SwapLogger(logger)
+	return logging.CloseLogger(old) // 写完原来的异步缓冲并关闭文件
+}
+
+// BuildLog 根据配置创建日志，配置有错或者打开文件失败时返回错误
+func BuildLog(cfg *LogConfig) (logger *zap.SugaredLogger, err error) {
+	defer func() { // 创建日志的函数出错时会panic
+		if v := recover(); v != nil {
+			logger, err = nil, fmt.Errorf("build log: %v", v)
+		}
+	}()
+	if cfg.IsCustom() {
+		logCfg, err := cfg.ToLogging()
+		if err != nil {
+			return nil, err
+		}
+		logger = logging.NewLoggerCustom(logCfg, "")
+	} else if cfg.LogFile != "" {
 		logger = logging.NewLoggerURL(cfg.LogLevel, cfg.LogFile)
 	} else if cfg.LogDir != "" {
 		logger = logging.NewLogger(cfg.LogDir)
 	} else {
 		logger = zap.NewNop().Sugar()
 	}
-	logging.SetLogger(logger)
+	return logger, nil
 }
 
-// PrepareEnv 初始化环境
+// PrepareEnv 初始化环境，提示设置GOAMD64，测试时退回根目录
+//
+// Deprecated: size原来是压舱石的大小，现在不再使用，内存上限请使用SetMemoryLimit
 func PrepareEnv(size int) {
-	if size > 0 { // 压舱石，阻止频繁GC
-		ballast := make([]byte, size*MegaByte)
-		runtime.KeepAlive(ballast)
-	}
-
 	if level := os.Getenv("GOAMD64"); level == "" {
 		level = fmt.Sprintf("v%d", CPU.X64Level())
 		fmt.Printf("请设置环境变量 export GOAMD64=%s\n\n", level)
@@ -0,0 +1,559 @@
+package config_test
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/azhai/gozzo/config"
+	"github.com/azhai/gozzo/logging"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/stretchr/testify/assert"
+)
+
+var logHCL = `
+debug = true
+
+app {
+  name = "demo"
+}
+
+log {
+  log_level   = "info"
+  log_dir     = "%s"
+  encoding    = "console"
+  time_format = "2006-01-02 15:04:05.000"
+
+  output {
+    stop  = "info"
+    paths = ["access.log"]
+    rotate {
+      cycle    = "daily"
+      max_size = 100
+      compress = false
+    }
+  }
+
+  output {
+    start    = "warn"
+    paths    = ["error.log", "stderr"]
+    encoding = "json"
+    dedup    = "10s"
+    sampling {
+      first      = 10
+      thereafter = 100
+    }
+  }
+}
+`
+
+// writeConfig 写入临时配置文件
+func writeConfig(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "settings.hcl")
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+	return file
+}
+
+func Test11_LogOutputs(t *testing.T) {
+	dir := t.TempDir()
+	file := writeConfig(t, fmt.Sprintf(logHCL, dir))
+	root, err := config.ReadConfigFile(file, nil)
+	assert.NoError(t, err)
+	assert.Len(t, root.Log.Outputs, 2)
+
+	cfg, err := root.Log.ToLogging()
+	assert.NoError(t, err)
+	assert.Equal(t, "info", cfg.MinLevel)
+	access := "rotate://" + filepath.ToSlash(filepath.Join(dir, "access.log")) +
+		"?comp=false&cycle=daily&size=100"
+	assert.Equal(t, []string{access}, cfg.Outputs[0].OutPaths)
+	assert.Equal(t, []string{filepath.Join(dir, "error.log"), "stderr"}, cfg.Outputs[1].OutPaths)
+	assert.Equal(t, 10, cfg.Outputs[1].Sampling.First)
+
+	config.SetupLog(root.Log)
+	logging.Error("something is wrong")
+	data, err := os.ReadFile(filepath.Join(dir, "error.log"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"M":"something is wrong"`)
+}
+
+func Test12_Loader(t *testing.T) {
+	file := writeConfig(t, `
+debug = false
+app {
+  name    = "demo"
+  version = "1.0"
+}
+log {
+  log_level = "info"
+}
+`)
+	local := strings.TrimSuffix(file, ".hcl") + ".local.hcl"
+	assert.NoError(t, os.WriteFile(local, []byte("debug = true\n"), 0o644))
+	t.Setenv("APP_LOG_LOG_LEVEL", "warn")
+
+	loader := config.NewLoader(file, "APP").SetDefault("log.log_dir", "logs")
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader.BindFlags(flags)
+	assert.NoError(t, flags.Parse([]string{"-app.name=cli"}))
+	root, err := loader.Load(nil)
+	assert.NoError(t, err)
+
+	assert.True(t, root.Debug)
+	assert.Equal(t, "cli", root.App.Name)
+	assert.Equal(t, "1.0", root.App.Version)
+	assert.Equal(t, "warn", root.Log.LogLevel)
+	assert.Equal(t, "logs", root.Log.LogDir)
+	assert.Equal(t, "file:"+local, loader.Source("debug"))
+	assert.Equal(t, "flag:-app.name", loader.Source("app.name"))
+	assert.Equal(t, "file:"+file, loader.Source("app.version"))
+	assert.Equal(t, "env:APP_LOG_LOG_LEVEL", loader.Source("log.log_level"))
+	assert.Equal(t, "default", loader.Source("log.log_dir"))
+}
+
+func Test13_Watcher(t *testing.T) {
+	dir := t.TempDir()
+	content := "app {\n  name = \"%s\"\n}\nlog {\n  log_level = \"%s\"\n  log_dir = \"%s\"\n}\n"
+	file := writeConfig(t, fmt.Sprintf(content, "demo", "info", dir))
+	w, err := config.NewWatcher(file, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	config.SetupLog(w.Current().Root.Log)
+	done := make(chan struct{})
+	defer close(done)
+	go func() { // 替换日志时其他协程仍在记录
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				logging.Info("watching")
+			}
+		}
+	}()
+	var names []string
+	w.Subscribe(func(old, cur *config.Snapshot) {
+		names = append(names, old.Root.App.Name+">"+cur.Root.App.Name)
+	})
+	changed, err := w.Reload(false)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	touch := func(text string, delay time.Duration) {
+		assert.NoError(t, os.WriteFile(file, []byte(text), 0o644))
+		mtime := time.Now().Add(delay)
+		assert.NoError(t, os.Chtimes(file, mtime, mtime))
+	}
+	touch(fmt.Sprintf(content, "next", "warn", dir), time.Second)
+	changed, err = w.Reload(false)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []string{"demo>next"}, names)
+	assert.Equal(t, 1, w.Current().Version)
+	assert.Equal(t, "warn", w.Current().Root.Log.LogLevel)
+
+	touch("app {\n  name = \n}\n", 2*time.Second) // 语法错误时保留原配置
+	_, err = w.Reload(false)
+	assert.Error(t, err)
+	assert.Equal(t, "next", w.Current().Root.App.Name)
+
+	// 修改包含的文件也会重新读取
+	part := filepath.Join(filepath.Dir(file), "part.hcl")
+	assert.NoError(t, os.WriteFile(part, []byte("debug = false\n"), 0o644))
+	touch("include = [\"part.hcl\"]\napp {\n  name = \"main\"\n}\n", 3*time.Second)
+	changed, err = w.Reload(false)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, w.Current().Root.Files(), part)
+	assert.NoError(t, os.WriteFile(part, []byte("debug = true\n"), 0o644))
+	mtime := time.Now().Add(4 * time.Second)
+	assert.NoError(t, os.Chtimes(part, mtime, mtime))
+	changed, err = w.Reload(false)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.True(t, w.Current().Root.Debug)
+}
+
+func Test14_EvalContext(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	secret, err := config.EncryptSecret(key, "p@ssw0rd")
+	assert.NoError(t, err)
+	t.Setenv("APP_ENV", "prod")
+
+	file := writeConfig(t, fmt.Sprintf(`
+include = ["conf.d/*.hcl"]
+
+variable "region" {
+  default = "cn"
+}
+
+locals {
+  full_name = "${local.name}-${var.region}"
+  name      = upper(env("APP_ENV", "dev"))
+}
+
+debug = trimspace(file("debug.txt")) == "on"
+
+app {
+  name     = local.full_name
+  version  = format("%%s.%%d", "v1", 2)
+  password = decrypt("%s")
+}
+`, secret))
+	dir := filepath.Dir(file)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "debug.txt"), []byte("on\n"), 0o644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "conf.d"), 0o755))
+	logConf := "log {\n  log_level = lower(\"WARN\")\n}\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "conf.d", "log.hcl"), []byte(logConf), 0o644))
+
+	loader := config.NewLoader(file, "")
+	loader.Eval = &config.EvalOptions{SecretKey: key, Vars: map[string]string{"region": "us"}}
+	remain := &struct {
+		Password string `hcl:"password"`
+	}{}
+	root, err := loader.Load(nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, root.ParseAppRemain(remain))
+	assert.True(t, root.Debug)
+	assert.Equal(t, "PROD-us", root.App.Name)
+	assert.Equal(t, "v1.2", root.App.Version)
+	assert.Equal(t, "p@ssw0rd", remain.Password)
+	assert.Equal(t, "warn", root.Log.LogLevel)
+
+	_, err = config.DecryptSecret([]byte("fedcba9876543210"), secret)
+	assert.Error(t, err)
+	again, err := config.EncryptSecret(key, "p@ssw0rd")
+	assert.NoError(t, err)
+	assert.NotEqual(t, secret, again) // 随机nonce
+	assert.True(t, strings.HasPrefix(again, config.SecretPrefix))
+	_, err = config.DecryptSecret(key, strings.TrimPrefix(secret, config.SecretPrefix))
+	assert.Error(t, err) // 没有版本前缀
+
+	// 转换格式时保留decrypt()，不输出明文
+	data, err := config.EvalFileData(file, &config.EvalOptions{KeepSecrets: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, format := range []string{config.FormatYAML, config.FormatJSON, config.FormatHCL} {
+		out, err := config.EncodeData(data, format)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(out), "p@ssw0rd")
+		assert.Contains(t, string(out), secret)
+		conv := filepath.Join(dir, "conv."+format)
+		assert.NoError(t, os.WriteFile(conv, out, 0o644))
+		plain, err := config.EvalFileData(conv, &config.EvalOptions{SecretKey: key})
+		if assert.NoError(t, err, format) {
+			app := plain["app"].(map[string]any)
+			assert.Equal(t, "p@ssw0rd", app["password"], format)
+		}
+	}
+}
+
+type serverConfig struct {
+	Host     string            `hcl:"host" validate:"required"`
+	Port     int               `hcl:"port,optional" validate:"min=1,max=65535"`
+	Mode     string            `hcl:"mode,optional" validate:"oneof=dev prod"`
+	Timeout  string            `hcl:"timeout,optional" validate:"duration"`
+	CertKey  string            `hcl:"cert_key,optional" validate:"file"`
+	Name     string            `hcl:"name,optional" validate:"regex=^[a-z]{2,8}$"`
+	Upstream []*upstreamConfig `hcl:"upstream,block"`
+}
+
+type upstreamConfig struct {
+	URL    string `hcl:"url" validate:"required,url"`
+	Weight int    `hcl:"weight,optional" validate:"max=100"`
+}
+
+func Test15_Validate(t *testing.T) {
+	file := writeConfig(t, `
+host     = "localhost"
+port     = 70000
+mode     = "test"
+timeout  = "3 minutes"
+cert_key = "missing.key"
+name     = "Web1"
+
+upstream {
+  url = "http://10.0.0.1:8080"
+}
+
+upstream {
+  url    = "10.0.0.2"
+  weight = 200
+}
+
+log {
+  output {
+    paths     = ["app.log"]
+    encoding  = "text"
+  }
+}
+`)
+	_, err := config.ReadConfigFile(file, nil)
+	var errs config.ValidationErrors
+	if assert.ErrorAs(t, err, &errs) && assert.Len(t, errs, 1) {
+		assert.Equal(t, "log.output[0].encoding", errs[0].Key)
+		assert.Equal(t, 21, errs[0].Range.Start.Line)
+	}
+
+	data, _ := os.ReadFile(file)
+	content := strings.Replace(string(data), `"text"`, `"json"`, 1)
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+	root, err := config.ReadConfigFile(file, nil)
+	assert.NoError(t, err)
+	remain := &serverConfig{}
+	err = root.ParseRemain(remain)
+	if !assert.ErrorAs(t, err, &errs) {
+		return
+	}
+	keys := make([]string, len(errs))
+	for i, e := range errs {
+		keys[i] = e.Key
+	}
+	assert.Equal(t, []string{"port", "mode", "timeout", "cert_key", "name",
+		"upstream[1].url", "upstream[1].weight"}, keys)
+	assert.Equal(t, 3, errs[0].Range.Start.Line)
+	assert.Equal(t, file, errs[0].Range.Filename)
+	assert.Contains(t, err.Error(), "must be at most 65535")
+	assert.Equal(t, 14, errs[5].Range.Start.Line)
+
+	// 设置为空数组或零值时仍然检查min
+	file = writeConfig(t, "host = \"localhost\"\nport = 0\n\nlog {\n  output {\n    paths = []\n  }\n}\n")
+	_, err = config.ReadConfigFile(file, nil)
+	if assert.ErrorAs(t, err, &errs) && assert.Len(t, errs, 1) {
+		assert.Equal(t, "log.output[0].paths", errs[0].Key)
+	}
+	content = strings.Replace(content, "port     = 70000", "port     = 0", 1)
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+	root, err = config.ReadConfigFile(file, nil)
+	assert.NoError(t, err)
+	err = root.ParseRemain(&serverConfig{})
+	if assert.ErrorAs(t, err, &errs) {
+		assert.Equal(t, "port", errs[0].Key)
+		assert.Contains(t, errs[0].Message, "at least 1")
+	}
+}
+
+func Test16_Formats(t *testing.T) {
+	dir := t.TempDir()
+	contents := map[string]string{
+		"settings.yaml": `
+debug: true
+app:
+  name: web
+log:
+  log_level: warn
+  output:
+    - paths: [app.log]
+    - start: error
+      paths: [err.log]
+server:
+  host: localhost
+  port: 8080
+`,
+		"settings.toml": `
+debug = true
+[app]
+name = "web"
+[log]
+log_level = "warn"
+[[log.output]]
+paths = ["app.log"]
+[[log.output]]
+start = "error"
+paths = ["err.log"]
+[server]
+host = "localhost"
+port = 8080
+`,
+	}
+	for name, content := range contents {
+		file := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+		remain := &struct {
+			Server *serverConfig `hcl:"server,block"`
+		}{}
+		root, err := config.ReadConfigFile(file, remain)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		assert.True(t, root.Debug)
+		assert.Equal(t, "web", root.App.Name)
+		assert.Equal(t, "warn", root.Log.LogLevel)
+		if assert.Len(t, root.Log.Outputs, 2) {
+			assert.Equal(t, "error", root.Log.Outputs[1].Start)
+		}
+		assert.Equal(t, 8080, remain.Server.Port)
+	}
+
+	data, err := config.EvalFileData(filepath.Join(dir, "settings.toml"), nil)
+	assert.NoError(t, err)
+	output, err := config.EncodeData(data, config.FormatHCL)
+	assert.NoError(t, err)
+	file := filepath.Join(dir, "converted.hcl")
+	assert.NoError(t, os.WriteFile(file, output, 0o644))
+	root, err := config.ReadConfigFile(file, nil)
+	assert.NoError(t, err)
+	assert.Len(t, root.Log.Outputs, 2)
+	assert.Contains(t, string(output), "server {\n  host = \"localhost\"")
+}
+
+func Test17_App(t *testing.T) {
+	file := writeConfig(t, `
+app {
+  name         = "demo"
+  memory_limit = 512
+}
+`)
+	var (
+		events []string
+		mu     sync.Mutex
+	)
+	record := func(event string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			mu.Lock()
+			events = append(events, event)
+			mu.Unlock()
+			return nil
+		}
+	}
+	srv := config.NewHTTPServer(&http.Server{
+		Addr: "127.0.0.1:0",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("ok"))
+		}),
+	})
+	worker := config.NewWorker("worker", func(ctx context.Context) error {
+		<-ctx.Done()
+		return record("worker done")(ctx)
+	})
+	ready := make(chan struct{})
+	app := config.NewApp("demo")
+	app.Register(config.NewComponent("db", record("db start"), record("db stop")), srv, worker,
+		config.NewComponent("ready", func(context.Context) error { close(ready); return nil }, nil))
+	defer debug.SetMemoryLimit(math.MaxInt64)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Run(ctx, []string{"-c", file, "-app.version", "v2"})
+	}()
+	<-ready
+	resp, err := http.Get("http://" + srv.Addr)
+	if assert.NoError(t, err) {
+		_ = resp.Body.Close()
+	}
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Equal(t, "v2", app.Root.App.Version)
+	assert.Equal(t, int64(512*config.MegaByte), config.SetMemoryLimit(0))
+	assert.Equal(t, []string{"db start", "worker done", "db stop"}, events)
+
+	// 重复初始化时不重复定义参数，日志配置有错时返回错误
+	assert.NoError(t, app.Init([]string{"-c", file, "-app.version", "v3"}))
+	assert.Equal(t, "v3", app.Root.App.Version)
+	err = app.Init([]string{"-c", file, "-log.log_file", "bogus://nowhere"})
+	assert.ErrorContains(t, err, "build log")
+
+	failing := config.NewApp("failing")
+	failing.Register(config.NewComponent("first", nil, record("first stop")),
+		config.NewComponent("second", func(context.Context) error { return fmt.Errorf("boom") }, nil))
+	events = nil
+	err = failing.Start(context.Background())
+	assert.ErrorContains(t, err, "start second: boom")
+	assert.Equal(t, []string{"first stop"}, events)
+}
+
+func Test18_Command(t *testing.T) {
+	file := writeConfig(t, logHCL)
+	opts := &struct {
+		Port    int           `flag:"port" short:"p" usage:"listen port"`
+		Level   string        `flag:"level" config:"log.log_level" usage:"log level"`
+		Tags    []string      `flag:"tags" usage:"server tags"`
+		Timeout time.Duration `flag:"timeout"`
+		Skip    bool          `flag:"-"`
+	}{Port: 8080, Tags: []string{"default"}}
+	var gotArgs []string
+	root := config.NewCommand("demo", "demo application", nil, nil)
+	root.Loader = config.NewLoader(file, "")
+	serve := config.NewCommand("serve", "start the server", opts,
+		func(cmd *config.Command, args []string) error {
+			gotArgs = args
+			return nil
+		})
+	root.AddCommand(serve, config.NewCompletionCommand(root))
+
+	err := root.Execute([]string{"serve", "-p", "9000", "-level", "warn",
+		"-tags", "a,b", "-tags", "c", "-timeout", "3s", "extra"})
+	assert.NoError(t, err)
+	assert.Equal(t, 9000, opts.Port)
+	assert.Equal(t, []string{"a", "b", "c"}, opts.Tags)
+	assert.Equal(t, 3*time.Second, opts.Timeout)
+	assert.Equal(t, []string{"extra"}, gotArgs)
+	cfg, err := root.Loader.Load(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "warn", cfg.Log.LogLevel)
+	assert.Equal(t, "flag:-level", root.Loader.Source("log.log_level"))
+
+	help := serve.Help()
+	assert.Contains(t, help, "Usage: demo serve [flags] [args]")
+	assert.Contains(t, help, "-p, -port int")
+	assert.Contains(t, help, "[config log.log_level]")
+	assert.NotContains(t, help, "-skip")
+	assert.Contains(t, root.Help(), "completion")
+
+	var buf strings.Builder
+	root.Output = &buf
+	assert.NoError(t, root.Execute([]string{"completion", "bash"}))
+	assert.Contains(t, buf.String(), "complete -F _demo_complete demo")
+	assert.Contains(t, buf.String(), `" serve") words="-port -p -level -tags -timeout" ;;`)
+	assert.Error(t, root.Execute([]string{"unknown"}))
+}
+
+func Test19_Schema(t *testing.T) {
+	remain := &struct {
+		Server []*struct {
+			Name string `hcl:"name,label"`
+			Host string `hcl:"host" doc:"server host"`
+			Port int    `hcl:"port,optional" validate:"min=1,max=65535" default:"8080"`
+		} `hcl:"server,block"`
+	}{}
+	schema := config.NewConfigSchema(remain, nil)
+	assert.Contains(t, schema.Keys(), "log.output.rotate.cycle")
+	assert.Contains(t, schema.Keys(), "server.port")
+
+	data, err := schema.JSONSchema()
+	assert.NoError(t, err)
+	var doc map[string]any
+	assert.NoError(t, json.Unmarshal(data, &doc))
+	props := doc["properties"].(map[string]any)
+	server := props["server"].(map[string]any)["additionalProperties"].(map[string]any)
+	port := server["properties"].(map[string]any)["port"].(map[string]any)
+	assert.Equal(t, 65535.0, port["maximum"])
+	assert.Equal(t, 8080.0, port["default"])
+	assert.Equal(t, []any{"host"}, server["required"])
+	assert.Equal(t, false, doc["additionalProperties"])
+
+	example := schema.ExampleHCL()
+	_, diags := hclparse.NewParser().ParseHCL(example, "example.hcl")
+	assert.False(t, diags.HasErrors(), diags.Error())
+	assert.Contains(t, string(example), "# log_level = \"debug\"")
+	assert.Contains(t, string(example), "server \"name\" {\n  # server host\n  host = \"\"")
+
+	md := schema.Markdown()
+	assert.Contains(t, md, "| `server.port` | integer |  | `8080` | `min=1,max=65535` |  |")
+	assert.Contains(t, md, "| `log.output` | block，可多个 |")
+}
@@ -0,0 +1,393 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/azhai/gozzo/cryptogy"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+// SecretKeyEnv 没有指定密钥时，从这个环境变量读取解密secret的密钥
+const SecretKeyEnv = "CONFIG_SECRET_KEY"
+
+// EvalOptions 解析配置文件时的变量和密钥
+type EvalOptions struct {
+	Vars        map[string]string // 覆盖variable块的默认值
+	SecretKey   []byte            // 解密secret的AES密钥，长度16、24或32
+	KeepSecrets bool              // 不解密，decrypt("...")的结果为 ${decrypt("...")} 模板，转换格式时不输出明文
+}
+
+// evalSchema 配置文件中的变量、局部值和包含的文件
+var evalSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{{Name: "include"}},
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "locals"},
+		{Type: "variable", LabelNames: []string{"name"}},
+	},
+}
+
+// variableSchema variable块的内容
+var variableSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{{Name: "default"}, {Name: "description"}},
+}
+
+// evalState 解析过程中收集的内容
+type evalState struct {
+	opts      *EvalOptions
+	parser    *hclparse.Parser
+	ctx       *hcl.EvalContext
+	bodies    []hcl.Body
+	locals    map[string]*hcl.Attribute
+	variables map[string]cty.Value
+	seen      map[string]bool
+}
+
+// DecodeConfigFile 解析配置文件，支持函数、variable和locals块，以及include其他文件，最后按validate标签验证
+func DecodeConfigFile(file string, opts *EvalOptions, target any) (*hcl.EvalContext, error) {
+	ctx, _, err := decodeConfigFiles(file, opts, target)
+	return ctx, err
+}
+
+// decodeConfigFiles 解析配置文件，同时返回读取过的文件，包括包含的文件
+func decodeConfigFiles(file string, opts *EvalOptions, target any) (*hcl.EvalContext, []string, error) {
+	s, err := newEvalState(file, opts)
+	files := s.files()
+	if err != nil {
+		return s.ctx, files, err
+	}
+	body := hcl.MergeBodies(s.bodies)
+	if diags := gohcl.DecodeBody(body, s.ctx, target); diags.HasErrors() {
+		return s.ctx, files, diags
+	}
+	return s.ctx, files, ValidateStruct(target, body)
+}
+
+// newEvalState 读取配置文件和包含的文件，计算变量和局部值
+func newEvalState(file string, opts *EvalOptions) (*evalState, error) {
+	if opts == nil {
+		opts = &EvalOptions{}
+	}
+	s := &evalState{
+		opts: opts, parser: hclparse.NewParser(),
+		ctx:       NewEvalContext(filepath.Dir(file), opts),
+		locals:    make(map[string]*hcl.Attribute),
+		variables: make(map[string]cty.Value),
+		seen:      make(map[string]bool),
+	}
+	if err := s.loadFile(file); err != nil {
+		return s, err
+	}
+	for name, value := range opts.Vars {
+		s.variables[name] = cty.StringVal(value)
+	}
+	s.ctx.Variables["var"] = cty.ObjectVal(s.variables)
+	return s, s.evalLocals()
+}
+
+// loadFile 读取一个文件，先加入包含的文件
+func (s *evalState) loadFile(file string) error {
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	if s.seen[file] {
+		return fmt.Errorf("config file %s is included repeatedly", file)
+	}
+	s.seen[file] = true
+	f, diags := parseConfigFile(s.parser, file)
+	if diags.HasErrors() {
+		return diags
+	}
+	content, remain, diags := f.Body.PartialContent(evalSchema)
+	if diags.HasErrors() {
+		return diags
+	}
+	if attr, ok := content.Attributes["include"]; ok {
+		if err := s.include(attr, filepath.Dir(file)); err != nil {
+			return err
+		}
+	}
+	for _, block := range content.Blocks {
+		if err := s.addBlock(block); err != nil {
+			return err
+		}
+	}
+	s.bodies = append(s.bodies, remain)
+	return nil
+}
+
+// files 读取过的文件，按名称排序
+func (s *evalState) files() []string {
+	files := make([]string, 0, len(s.seen))
+	for file := range s.seen {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// include 读取包含的文件，路径相对于当前文件，支持通配符
+func (s *evalState) include(attr *hcl.Attribute, dir string) error {
+	var patterns []string
+	if diags := gohcl.DecodeExpression(attr.Expr, s.ctx, &patterns); diags.HasErrors() {
+		return diags
+	}
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return fmt.Errorf("included config file %s is not found", pattern)
+		}
+		for _, file := range files {
+			if err = s.loadFile(file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addBlock 收集locals和variable块
+func (s *evalState) addBlock(block *hcl.Block) error {
+	if block.Type == "locals" {
+		attrs, diags := block.Body.JustAttributes()
+		if diags.HasErrors() {
+			return diags
+		}
+		for name, attr := range attrs {
+			if _, ok := s.locals[name]; ok {
+				return fmt.Errorf("duplicate local value %s at %s", name, attr.Range)
+			}
+			s.locals[name] = attr
+		}
+		return nil
+	}
+	name := block.Labels[0]
+	if _, ok := s.variables[name]; ok {
+		return fmt.Errorf("duplicate variable %s at %s", name, block.DefRange)
+	}
+	content, diags := block.Body.Content(variableSchema)
+	if diags.HasErrors() {
+		return diags
+	}
+	s.variables[name] = cty.NullVal(cty.DynamicPseudoType)
+	if attr, ok := content.Attributes["default"]; ok {
+		value, diags := attr.Expr.Value(s.ctx)
+		if diags.HasErrors() {
+			return diags
+		}
+		s.variables[name] = value
+	}
+	return nil
+}
+
+// evalLocals 按依赖关系计算局部值
+func (s *evalState) evalLocals() error {
+	values := make(map[string]cty.Value, len(s.locals))
+	s.ctx.Variables["local"] = cty.EmptyObjectVal
+	for len(s.locals) > 0 {
+		progress := false
+		for name, attr := range s.locals {
+			if !isResolved(attr.Expr, values) {
+				continue
+			}
+			value, diags := attr.Expr.Value(s.ctx)
+			if diags.HasErrors() {
+				return diags
+			}
+			values[name], progress = value, true
+			delete(s.locals, name)
+			s.ctx.Variables["local"] = cty.ObjectVal(values)
+		}
+		if !progress {
+			names := make([]string, 0, len(s.locals))
+			for name := range s.locals {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("cannot resolve local values: %s", strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// isResolved 表达式引用的局部值是否都已计算
+func isResolved(expr hcl.Expression, values map[string]cty.Value) bool {
+	for _, trav := range expr.Variables() {
+		if trav.RootName() != "local" || len(trav) < 2 {
+			continue
+		}
+		if attr, ok := trav[1].(hcl.TraverseAttr); ok {
+			if _, ok = values[attr.Name]; !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// NewEvalContext 创建包含函数的上下文，file函数的相对路径基于dir
+func NewEvalContext(dir string, opts *EvalOptions) *hcl.EvalContext {
+	if opts == nil {
+		opts = &EvalOptions{}
+	}
+	funcs := map[string]function.Function{
+		"env":          envFunc,
+		"file":         fileFunc(dir),
+		"decrypt":      decryptFunc(opts.SecretKey, opts.KeepSecrets),
+		"upper":        stdlib.UpperFunc,
+		"lower":        stdlib.LowerFunc,
+		"title":        stdlib.TitleFunc,
+		"trim":         stdlib.TrimFunc,
+		"trimspace":    stdlib.TrimSpaceFunc,
+		"trimprefix":   stdlib.TrimPrefixFunc,
+		"trimsuffix":   stdlib.TrimSuffixFunc,
+		"chomp":        stdlib.ChompFunc,
+		"replace":      stdlib.ReplaceFunc,
+		"regexreplace": stdlib.RegexReplaceFunc,
+		"split":        stdlib.SplitFunc,
+		"join":         stdlib.JoinFunc,
+		"format":       stdlib.FormatFunc,
+		"substr":       stdlib.SubstrFunc,
+		"strlen":       stdlib.StrlenFunc,
+		"concat":       stdlib.ConcatFunc,
+		"coalesce":     stdlib.CoalesceFunc,
+		"length":       stdlib.LengthFunc,
+		"lookup":       stdlib.LookupFunc,
+		"merge":        stdlib.MergeFunc,
+		"min":          stdlib.MinFunc,
+		"max":          stdlib.MaxFunc,
+		"parseint":     stdlib.ParseIntFunc,
+		"jsonencode":   stdlib.JSONEncodeFunc,
+		"jsondecode":   stdlib.JSONDecodeFunc,
+	}
+	return &hcl.EvalContext{Variables: map[string]cty.Value{}, Functions: funcs}
+}
+
+// envFunc 读取环境变量，env("NAME") 或 env("NAME", "默认值")
+var envFunc = function.New(&function.Spec{
+	Params:   []function.Parameter{{Name: "name", Type: cty.String}},
+	VarParam: &function.Parameter{Name: "default", Type: cty.String},
+	Type:     function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+		if value, ok := os.LookupEnv(args[0].AsString()); ok {
+			return cty.StringVal(value), nil
+		}
+		if len(args) > 1 {
+			return args[1], nil
+		}
+		return cty.StringVal(""), nil
+	},
+})
+
+// fileFunc 读取文件内容，相对路径基于配置文件所在目录
+func fileFunc(dir string) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{{Name: "path", Type: cty.String}},
+		Type:   function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+			path := args[0].AsString()
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return cty.NilVal, err
+			}
+			return cty.StringVal(string(data)), nil
+		},
+	})
+}
+
+// secretTemplate 不解密时保留的模板，JSON、YAML和TOML格式的配置中仍然可以解密
+var secretTemplate = regexp.MustCompile(`^\$\{decrypt\("([^"\\]*)"\)\}$`)
+
+// decryptFunc 解密EncryptSecret生成的密文，keep为真时不解密，返回模板
+func decryptFunc(key []byte, keep bool) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{{Name: "secret", Type: cty.String}},
+		Type:   function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+			if keep {
+				return cty.StringVal(`${decrypt("` + args[0].AsString() + `")}`), nil
+			}
+			plain, err := DecryptSecret(key, args[0].AsString())
+			if err != nil {
+				return cty.NilVal, err
+			}
+			return cty.StringVal(plain), nil
+		},
+	})
+}
+
+// SecretPrefix 加密的secret的版本前缀
+const SecretPrefix = "v2:"
+
+// secretKey 加解密secret的密钥，没有密钥时读取环境变量
+func secretKey(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		key = []byte(os.Getenv(SecretKeyEnv))
+	}
+	if len(key) == 0 {
+		return nil, errors.New("secret key is empty, set " + SecretKeyEnv)
+	}
+	return key, nil
+}
+
+// EncryptSecret 加密敏感配置，结果用于配置文件中的 decrypt("...")
+// 使用AES-GCM和随机nonce，同样的内容每次结果不同，密钥错误或内容被修改时无法解密
+func EncryptSecret(key []byte, plain string) (string, error) {
+	key, err := secretKey(key)
+	if err != nil {
+		return "", err
+	}
+	c, err := cryptogy.NewAEADCipher("GCM", key)
+	if err != nil {
+		return "", err
+	}
+	data, err := c.SealData([]byte(plain), []byte(SecretPrefix))
+	if err != nil {
+		return "", err
+	}
+	return SecretPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// DecryptSecret 解密敏感配置，没有版本前缀时返回错误
+func DecryptSecret(key []byte, secret string) (string, error) {
+	key, err := secretKey(key)
+	if err != nil {
+		return "", err
+	}
+	encoded, ok := strings.CutPrefix(secret, SecretPrefix)
+	if !ok {
+		return "", fmt.Errorf("secret must start with %q", SecretPrefix)
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	c, err := cryptogy.NewAEADCipher("GCM", key)
+	if err != nil {
+		return "", err
+	}
+	if data, err = c.OpenData(data, []byte(SecretPrefix)); err != nil {
+		return "", errors.New("cannot decrypt secret, the key may be wrong")
+	}
+	return string(data), nil
+}
@@ -0,0 +1,341 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+	"gopkg.in/yaml.v3"
+)
+
+// 配置文件格式，各种格式的配置项名称都和HCL相同
+const (
+	FormatHCL  = "hcl"
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+)
+
+// FileFormat 按扩展名判断配置文件格式，未知的扩展名当作HCL
+func FileFormat(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	}
+	return FormatHCL
+}
+
+// parseConfigFile 解析配置文件，YAML和TOML先转为JSON，再按HCL的JSON语法解析
+func parseConfigFile(parser *hclparse.Parser, file string) (*hcl.File, hcl.Diagnostics) {
+	switch FileFormat(file) {
+	case FormatHCL:
+		return parser.ParseHCLFile(file)
+	case FormatJSON:
+		return parser.ParseJSONFile(file)
+	}
+	data, err := ReadFileData(file)
+	if err == nil {
+		var src []byte
+		if src, err = json.MarshalIndent(data, "", "  "); err == nil {
+			return parser.ParseJSON(src, file)
+		}
+	}
+	return nil, hcl.Diagnostics{{
+		Severity: hcl.DiagError, Summary: "Failed to read file",
+		Detail: fmt.Sprintf("The configuration file %q could not be read: %s", file, err),
+	}}
+}
+
+// ReadFileData 读取JSON、YAML或TOML文件的原始内容，不计算表达式
+func ReadFileData(file string) (map[string]any, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]any)
+	switch format := FileFormat(file); format {
+	case FormatJSON:
+		dec := json.NewDecoder(bytes.NewReader(content))
+		dec.UseNumber()
+		err = dec.Decode(&data)
+	case FormatYAML:
+		err = yaml.Unmarshal(content, &data)
+	case FormatTOML:
+		err = toml.Unmarshal(content, &data)
+	default:
+		return nil, fmt.Errorf("cannot read %s file %s directly, use EvalFileData", format, file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return normalize(data).(map[string]any), nil
+}
+
+// EvalFileData 读取配置文件并计算全部表达式，包括包含的文件，配置块转为嵌套的哈希表
+// 同名的多个配置块转为数组，带标签的配置块按标签嵌套
+func EvalFileData(file string, opts *EvalOptions) (map[string]any, error) {
+	s, err := newEvalState(file, opts)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]any)
+	for _, body := range s.bodies {
+		part, err := bodyData(body, s.ctx, true)
+		if err != nil {
+			return nil, err
+		}
+		mergeData(data, part, true)
+	}
+	return data, nil
+}
+
+// bodyData 计算配置内容，top为真时跳过include、locals和variable
+func bodyData(body hcl.Body, ctx *hcl.EvalContext, top bool) (map[string]any, error) {
+	data := make(map[string]any)
+	sb, ok := body.(*hclsyntax.Body)
+	if !ok { // JSON语法无法区分属性和配置块，全部作为属性计算
+		attrs, diags := body.JustAttributes()
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		for name, attr := range attrs {
+			value, err := exprData(attr.Expr, ctx)
+			if err != nil {
+				return nil, err
+			}
+			data[name] = value
+		}
+		return data, nil
+	}
+	for name, attr := range sb.Attributes {
+		if top && name == "include" {
+			continue
+		}
+		value, err := exprData(attr.Expr, ctx)
+		if err != nil {
+			return nil, err
+		}
+		data[name] = value
+	}
+	for _, block := range sb.Blocks {
+		if top && (block.Type == "locals" || block.Type == "variable") {
+			continue
+		}
+		part, err := bodyData(block.Body, ctx, false)
+		if err != nil {
+			return nil, err
+		}
+		var value any = part
+		for i := len(block.Labels) - 1; i >= 0; i-- {
+			value = map[string]any{block.Labels[i]: value}
+		}
+		mergeData(data, map[string]any{block.Type: value}, len(block.Labels) == 0)
+	}
+	return data, nil
+}
+
+// exprData 计算表达式，转为普通的Go类型
+func exprData(expr hcl.Expression, ctx *hcl.EvalContext) (any, error) {
+	value, diags := expr.Value(ctx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if value.IsNull() {
+		return nil, nil
+	}
+	src, err := ctyjson.Marshal(value, value.Type())
+	if err != nil {
+		return nil, err
+	}
+	var result any
+	dec := json.NewDecoder(bytes.NewReader(src))
+	dec.UseNumber()
+	if err = dec.Decode(&result); err != nil {
+		return nil, err
+	}
+	return normalize(result), nil
+}
+
+// mergeData 合并配置，哈希表递归合并，appendBlocks为真时同名的配置块合并为数组，否则覆盖
+func mergeData(dst, src map[string]any, appendBlocks bool) {
+	for key, value := range src {
+		old, ok := dst[key]
+		if !ok {
+			dst[key] = value
+			continue
+		}
+		oldMap, isOldMap := old.(map[string]any)
+		newMap, isNewMap := value.(map[string]any)
+		if appendBlocks && isBlockData(old) && isBlockData(value) {
+			dst[key] = append(blockList(old), blockList(value)...)
+		} else if isOldMap && isNewMap {
+			mergeData(oldMap, newMap, appendBlocks)
+		} else {
+			dst[key] = value
+		}
+	}
+}
+
+// isBlockData 是否配置块，即哈希表或者哈希表的数组
+func isBlockData(value any) bool {
+	switch v := value.(type) {
+	case map[string]any:
+		return true
+	case []any:
+		for _, item := range v {
+			if _, ok := item.(map[string]any); !ok {
+				return false
+			}
+		}
+		return len(v) > 0
+	}
+	return false
+}
+
+// blockList 配置块转为数组
+func blockList(value any) []any {
+	if list, ok := value.([]any); ok {
+		return list
+	}
+	return []any{value}
+}
+
+// normalize 统一数据类型，整数转为int64，去掉空值
+func normalize(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if item == nil {
+				delete(v, key)
+			} else {
+				v[key] = normalize(item)
+			}
+		}
+		return v
+	case map[any]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			if item != nil {
+				result[fmt.Sprint(key)] = normalize(item)
+			}
+		}
+		return result
+	case []map[string]any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = normalize(item)
+		}
+		return result
+	case []any:
+		for i, item := range v {
+			v[i] = normalize(item)
+		}
+		return v
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return value
+}
+
+// EncodeData 按格式输出配置
+func EncodeData(data map[string]any, format string) ([]byte, error) {
+	data = normalize(data).(map[string]any)
+	switch format {
+	case FormatJSON:
+		src, err := json.MarshalIndent(data, "", "  ")
+		return append(src, '\n'), err
+	case FormatYAML:
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		err := enc.Encode(data)
+		return buf.Bytes(), err
+	case FormatTOML:
+		var buf bytes.Buffer
+		err := toml.NewEncoder(&buf).Encode(data)
+		return buf.Bytes(), err
+	case FormatHCL:
+		f := hclwrite.NewEmptyFile()
+		if err := writeHCLBody(f.Body(), data); err != nil {
+			return nil, err
+		}
+		return f.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown config format %q", format)
+}
+
+// writeHCLBody 写入HCL，哈希表和哈希表的数组写为配置块，其他写为属性
+func writeHCLBody(body *hclwrite.Body, data map[string]any) error {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	count := 0
+	for _, key := range keys {
+		if isBlockData(data[key]) {
+			continue
+		}
+		if text, ok := data[key].(string); ok { // 没有解密的secret写为函数调用
+			if m := secretTemplate.FindStringSubmatch(text); m != nil {
+				tokens := hclwrite.TokensForValue(cty.StringVal(m[1]))
+				body.SetAttributeRaw(key, hclwrite.TokensForFunctionCall("decrypt", tokens))
+				count++
+				continue
+			}
+		}
+		value, err := ctyValue(data[key])
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		body.SetAttributeValue(key, value)
+		count++
+	}
+	for _, key := range keys {
+		if !isBlockData(data[key]) {
+			continue
+		}
+		for _, item := range blockList(data[key]) {
+			if count++; count > 1 { // 配置块之间空一行
+				body.AppendNewline()
+			}
+			block := body.AppendNewBlock(key, nil)
+			if err := writeHCLBody(block.Body(), item.(map[string]any)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ctyValue 普通的Go类型转为cty值
+func ctyValue(value any) (cty.Value, error) {
+	src, err := json.Marshal(value)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	ty, err := ctyjson.ImpliedType(src)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	return ctyjson.Unmarshal(src, ty)
+}
@@ -0,0 +1,488 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	fs "github.com/azhai/gozzo/filesystem"
+	"github.com/azhai/gozzo/mapper"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// 配置值的来源
+const (
+	SourceDefault = "default"
+	SourceFile    = "file:"
+	SourceEnv     = "env:"
+	SourceFlag    = "flag:"
+)
+
+// Loader 分层读取配置，依次为默认值、配置文件、本地配置文件、环境变量和命令行参数，后面的覆盖前面的
+type Loader struct {
+	File      string            // 配置文件，同目录下的 *.local.hcl 为本地配置
+	EnvPrefix string            // 环境变量前缀，例如APP，为空时不读环境变量
+	Defaults  map[string]string // 默认值，键为点号连接的名称，例如 log.log_level
+	Eval      *EvalOptions      // 配置文件中的变量和密钥
+	flags     *flag.FlagSet
+	values    map[string]*flagValue
+	overrides map[string][2]string // 键为配置项，值为文字和来源
+	sources   map[string]string
+	mu        sync.RWMutex // 保护overrides和sources，Load可能在监视器的协程中执行
+}
+
+// NewLoader 创建分层读取器
+func NewLoader(file, envPrefix string) *Loader {
+	return &Loader{
+		File: file, EnvPrefix: envPrefix,
+		Defaults: make(map[string]string),
+		sources:  make(map[string]string),
+	}
+}
+
+// SetDefault 设置默认值
+func (l *Loader) SetDefault(key, value string) *Loader {
+	l.Defaults[key] = value
+	return l
+}
+
+// LocalFile 本地配置文件，例如 settings.hcl 对应 settings.local.hcl
+func (l *Loader) LocalFile() string {
+	if l.File == "" {
+		return ""
+	}
+	ext := ".hcl"
+	if pos := strings.LastIndexByte(l.File, '.'); pos > strings.LastIndexAny(l.File, `/\`) {
+		ext = l.File[pos:]
+	}
+	return strings.TrimSuffix(l.File, ext) + ".local" + ext
+}
+
+// EnvName 配置项对应的环境变量名，例如 log.log_level 对应 APP_LOG_LOG_LEVEL
+func (l *Loader) EnvName(key string) string {
+	name := strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+	if l.EnvPrefix == "" {
+		return name
+	}
+	return strings.ToUpper(l.EnvPrefix) + "_" + name
+}
+
+// BindFlags 为每个配置项增加命令行参数，例如 -debug、-log.log_level
+// 可以重复绑定同一个FlagSet，已经定义的参数不再重复定义
+func (l *Loader) BindFlags(flags *flag.FlagSet) {
+	l.flags, l.values = flags, make(map[string]*flagValue)
+	for _, key := range ConfigKeys(&RootConfig{}) {
+		if f := flags.Lookup(key); f != nil {
+			if value, ok := f.Value.(*flagValue); ok {
+				l.values[key] = value
+			}
+			continue
+		}
+		field, _ := lookupKey(&RootConfig{}, key, true)
+		value := &flagValue{isBool: field.Type.Kind() == reflect.Bool}
+		l.values[key] = value
+		flags.Var(value, key, "override "+key+" in config file")
+	}
+}
+
+// Override 覆盖配置项，在命令行参数之后生效，例如子命令中绑定到配置项的参数
+func (l *Loader) Override(key, value, source string) *Loader {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.overrides == nil {
+		l.overrides = make(map[string][2]string)
+	}
+	l.overrides[key] = [2]string{value, source}
+	return l
+}
+
+// Source 配置项的来源，未设置时为空
+func (l *Loader) Source(key string) string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.sources[key]
+}
+
+// Sources 全部配置项的来源
+func (l *Loader) Sources() map[string]string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	result := make(map[string]string, len(l.sources))
+	for key, src := range l.sources {
+		result[key] = src
+	}
+	return result
+}
+
+// Load 读取配置，remain不为空时解析剩下的配置，只使用主配置文件中的，成功后才替换配置项的来源
+func (l *Loader) Load(remain any) (*RootConfig, error) {
+	root := &RootConfig{file: l.File}
+	sources := make(map[string]string)
+	if err := l.load(root, sources); err != nil {
+		return root, err
+	}
+	if err := root.ParseRemain(remain); err != nil {
+		return root, err
+	}
+	l.mu.Lock()
+	l.sources = sources
+	l.mu.Unlock()
+	return root, nil
+}
+
+// load 依次读取各层配置，记录配置项的来源
+func (l *Loader) load(root *RootConfig, sources map[string]string) error {
+	for key, value := range l.Defaults {
+		if err := l.setString(root, sources, key, value, SourceDefault); err != nil {
+			return err
+		}
+	}
+	if l.File != "" {
+		if err := l.loadFile(root, sources, l.File, true); err != nil {
+			return err
+		}
+		root.parsed = true
+	}
+	if local := l.LocalFile(); local != "" && fs.File(local).IsExist() {
+		if err := l.loadFile(root, sources, local, false); err != nil {
+			return err
+		}
+	}
+	if l.EnvPrefix != "" {
+		for _, key := range ConfigKeys(root) {
+			name := l.EnvName(key)
+			if value, ok := os.LookupEnv(name); ok {
+				if err := l.setString(root, sources, key, value, SourceEnv+name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if l.flags != nil {
+		var err error
+		l.flags.Visit(func(f *flag.Flag) {
+			if value, ok := l.values[f.Name]; ok && err == nil {
+				err = l.setString(root, sources, f.Name, value.value, SourceFlag+"-"+f.Name)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	l.mu.RLock()
+	overrides := make(map[string][2]string, len(l.overrides))
+	for key, item := range l.overrides {
+		overrides[key] = item
+	}
+	l.mu.RUnlock()
+	for key, item := range overrides {
+		if err := l.setString(root, sources, key, item[0], item[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Effective 合并后的最终配置，包括本地配置文件、默认值、环境变量和命令行参数
+func (l *Loader) Effective() (map[string]any, error) {
+	root, err := l.Load(nil)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]any)
+	if l.File != "" {
+		if data, err = EvalFileData(l.File, l.Eval); err != nil {
+			return nil, err
+		}
+	}
+	if local := l.LocalFile(); local != "" && fs.File(local).IsExist() {
+		part, err := EvalFileData(local, l.Eval)
+		if err != nil {
+			return nil, err
+		}
+		mergeData(data, part, false)
+	}
+	for key, src := range l.Sources() {
+		if strings.HasPrefix(src, SourceFile) {
+			continue
+		}
+		field, err := lookupKey(root, key, false)
+		if err != nil || field == nil || field.Value.Kind() == reflect.Pointer && field.Value.IsNil() {
+			continue
+		}
+		setDataKey(data, key, reflect.Indirect(field.Value).Interface())
+	}
+	return data, nil
+}
+
+// loadFile 读取配置文件，主配置直接解析，本地配置只覆盖文件中出现的配置项
+func (l *Loader) loadFile(root *RootConfig, sources map[string]string, file string, isMain bool) error {
+	fh := fs.File(file)
+	if !fh.IsExist() {
+		return fh.Error()
+	}
+	keys, err := presentKeys(file)
+	if err != nil {
+		return err
+	}
+	layer := root
+	if !isMain {
+		layer = &RootConfig{file: file}
+	}
+	ctx, files, err := decodeConfigFiles(file, l.Eval, layer)
+	root.files = append(root.files, files...)
+	if err = filterError(err); err != nil {
+		return err
+	}
+	if isMain {
+		root.ctx = ctx
+	}
+	for _, key := range keys {
+		src, err := lookupKey(layer, key, false)
+		if err != nil || src == nil || src.Type.Kind() == reflect.Pointer && isBlock(src.Type) {
+			continue // 自定义配置或者配置块
+		}
+		if !isMain {
+			dst, err := lookupKey(root, key, true)
+			if err != nil {
+				return err
+			}
+			dst.Value.Set(src.Value)
+		}
+		sources[key] = SourceFile + file
+	}
+	return nil
+}
+
+// setString 按文字设置配置项
+func (l *Loader) setString(root *RootConfig, sources map[string]string, key, value, source string) error {
+	field, err := lookupKey(root, key, true)
+	if err == nil {
+		err = setFieldString(field, value)
+	}
+	if err != nil {
+		return fmt.Errorf("config %s from %s: %w", key, source, err)
+	}
+	sources[key] = source
+	return nil
+}
+
+// presentKeys 配置文件中出现的配置项，包括配置块
+func presentKeys(file string) ([]string, error) {
+	if FileFormat(file) != FormatHCL {
+		return dataKeys(file)
+	}
+	f, diags := hclparse.NewParser().ParseHCLFile(file)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	var keys []string
+	var walk func(body *hclsyntax.Body, prefix string)
+	walk = func(body *hclsyntax.Body, prefix string) {
+		for name := range body.Attributes {
+			keys = append(keys, prefix+name)
+		}
+		for _, block := range body.Blocks {
+			keys = append(keys, prefix+block.Type)
+			walk(block.Body, prefix+block.Type+".")
+		}
+	}
+	if body, ok := f.Body.(*hclsyntax.Body); ok {
+		walk(body, "")
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// dataKeys JSON、YAML或TOML文件中出现的配置项
+func dataKeys(file string) ([]string, error) {
+	data, err := ReadFileData(file)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	var walk func(data map[string]any, prefix string)
+	walk = func(data map[string]any, prefix string) {
+		for name, value := range data {
+			keys = append(keys, prefix+name)
+			if child, ok := value.(map[string]any); ok {
+				walk(child, prefix+name+".")
+			}
+		}
+	}
+	walk(data, "")
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// setDataKey 按点号连接的名称设置配置，中间是多个配置块时忽略
+func setDataKey(data map[string]any, key string, value any) {
+	names := strings.Split(key, ".")
+	for _, name := range names[:len(names)-1] {
+		child, ok := data[name]
+		if !ok {
+			child = make(map[string]any)
+			data[name] = child
+		}
+		if data, ok = child.(map[string]any); !ok {
+			return
+		}
+	}
+	data[names[len(names)-1]] = value
+}
+
+// ConfigKeys 可以用环境变量和命令行参数覆盖的配置项，不包括多个的配置块
+func ConfigKeys(obj any) []string {
+	var keys []string
+	var walk func(vt reflect.Type, prefix string)
+	walk = func(vt reflect.Type, prefix string) {
+		fields, opts := hclFields(reflect.New(vt).Interface())
+		for i, field := range fields {
+			name := prefix + opts[i].Name
+			if isBlock(field.Type) {
+				if field.Type.Kind() == reflect.Pointer {
+					walk(field.Type.Elem(), name+".")
+				}
+			} else if isScalar(field.Type) {
+				keys = append(keys, name)
+			}
+		}
+	}
+	walk(reflect.Indirect(reflect.ValueOf(obj)).Type(), "")
+	return keys
+}
+
+// hclFields 结构体中带有hcl标签的字段
+func hclFields(obj any) (fields []*mapper.StructField, opts []*mapper.TagOpt) {
+	builder := mapper.NewStructBuilder(obj)
+	if builder == nil {
+		return
+	}
+	all, allOpts := builder.GetFieldTagOpts("hcl", mapper.NameNoChange)
+	for i, field := range all {
+		if field.GetTag("hcl") != "" && allOpts[i].ConvType != "remain" {
+			fields, opts = append(fields, field), append(opts, allOpts[i])
+		}
+	}
+	return
+}
+
+// lookupKey 按点号连接的名称找到字段，create为真时创建中间的配置块
+func lookupKey(obj any, key string, create bool) (*mapper.StructField, error) {
+	names := strings.Split(key, ".")
+	for i, name := range names {
+		var found *mapper.StructField
+		fields, opts := hclFields(obj)
+		for j, opt := range opts {
+			if opt.Name == name {
+				found = fields[j]
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("unknown config key %s", key)
+		}
+		if i == len(names)-1 {
+			return found, nil
+		}
+		if found.Type.Kind() != reflect.Pointer || !isBlock(found.Type) {
+			return nil, fmt.Errorf("config %s is not a block", strings.Join(names[:i+1], "."))
+		}
+		if found.Value.IsNil() {
+			if !create {
+				return nil, nil
+			}
+			found.Value.Set(reflect.New(found.Type.Elem()))
+		}
+		obj = found.Value.Interface()
+	}
+	return nil, fmt.Errorf("empty config key")
+}
+
+// isBlock 是否配置块
+func isBlock(vt reflect.Type) bool {
+	if vt.Kind() == reflect.Slice || vt.Kind() == reflect.Pointer {
+		vt = vt.Elem()
+	}
+	if vt.Kind() == reflect.Pointer {
+		vt = vt.Elem()
+	}
+	return vt.Kind() == reflect.Struct
+}
+
+// isScalar 是否可以用文字设置的类型
+func isScalar(vt reflect.Type) bool {
+	if vt.Kind() == reflect.Pointer {
+		vt = vt.Elem()
+	}
+	switch vt.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	case reflect.Slice:
+		return vt.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// setFieldString 按文字设置字段，数组用逗号分隔
+func setFieldString(field *mapper.StructField, value string) (err error) {
+	if field.Type.Kind() == reflect.Pointer { // 例如*bool
+		ptr := reflect.New(field.Type.Elem())
+		elem := &mapper.StructField{Value: ptr.Elem(), Type: field.Type.Elem()}
+		if err = setFieldString(elem, value); err == nil {
+			field.Value.Set(ptr)
+		}
+		return
+	}
+	switch field.Type.Kind() {
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(value); err == nil {
+			field.Value.SetBool(b)
+		}
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Value.Set(reflect.ValueOf(items))
+	default:
+		err = field.SetString(value)
+	}
+	return
+}
+
+// flagValue 命令行参数的值，只记录文字，读取配置时再转换
+type flagValue struct {
+	value  string
+	isBool bool
+}
+
+// String 实现flag.Value
+func (v *flagValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.value
+}
+
+// Set 实现flag.Value
+func (v *flagValue) Set(value string) error {
+	v.value = value
+	return nil
+}
+
+// IsBoolFlag 布尔参数可以省略值
+func (v *flagValue) IsBoolFlag() bool {
+	return v.isBool
+}
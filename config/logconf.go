@@ -0,0 +1,206 @@
+package config
+
+import (
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/azhai/gozzo/logging"
+)
+
+// OutputConfig 日志输出配置，按级别范围写入一个或多个地址
+type OutputConfig struct {
+	Start    string          `hcl:"start,optional" json:"start,omitempty"`
+	Stop     string          `hcl:"stop,optional" json:"stop,omitempty"`
+	Paths    []string        `hcl:"paths" json:"paths" validate:"min=1"`
+	Encoding string          `hcl:"encoding,optional" json:"encoding,omitempty" validate:"oneof=console json"`
+	Dedup    string          `hcl:"dedup,optional" json:"dedup,omitempty" validate:"duration"` // 去重窗口，例如 10s
+	Rotate   *RotateConfig   `hcl:"rotate,block" json:"rotate,omitempty"`
+	Sampling *SamplingConfig `hcl:"sampling,block" json:"sampling,omitempty"`
+	Buffer   *BufferConfig   `hcl:"buffer,block" json:"buffer,omitempty"`
+}
+
+// RotateConfig 日志文件轮转配置，对应logging.RotateFile
+type RotateConfig struct {
+	MaxSize      int    `hcl:"max_size,optional" json:"max_size,omitempty" validate:"min=0"` // 单位MB
+	Cycle        string `hcl:"cycle,optional" json:"cycle,omitempty" validate:"oneof=hourly daily weekly monthly"`
+	Minutely     int    `hcl:"minutely,optional" json:"minutely,omitempty"`
+	MaxAge       int    `hcl:"max_age,optional" json:"max_age,omitempty"` // 单位天
+	MaxBackups   int    `hcl:"max_backups,optional" json:"max_backups,omitempty"`
+	MaxTotalSize int    `hcl:"max_total_size,optional" json:"max_total_size,omitempty"` // 单位MB
+	Compress     *bool  `hcl:"compress,optional" json:"compress,omitempty"`
+	LocalTime    *bool  `hcl:"local_time,optional" json:"local_time,omitempty"`
+	TimeZone     string `hcl:"time_zone,optional" json:"time_zone,omitempty"`
+}
+
+// SamplingConfig 采样配置，对应logging.Sampling
+type SamplingConfig struct {
+	Interval   string `hcl:"interval,optional" json:"interval,omitempty" validate:"duration"`
+	First      int    `hcl:"first" json:"first"`
+	Thereafter int    `hcl:"thereafter,optional" json:"thereafter,omitempty"`
+}
+
+// BufferConfig 异步缓冲写入配置，对应logging.Buffer
+type BufferConfig struct {
+	Size          int    `hcl:"size,optional" json:"size,omitempty"`
+	FlushInterval string `hcl:"flush_interval,optional" json:"flush_interval,omitempty" validate:"duration"`
+	FlushLevel    string `hcl:"flush_level,optional" json:"flush_level,omitempty"`
+	WhenFull      string `hcl:"when_full,optional" json:"when_full,omitempty" validate:"oneof=drop block"` // drop或block，默认drop
+}
+
+// RedactConfig 日志脱敏配置，对应logging.Redaction
+type RedactConfig struct {
+	Keys     []string `hcl:"keys,optional" json:"keys,omitempty"`
+	Patterns []string `hcl:"patterns,optional" json:"patterns,omitempty"`
+	Rules    []string `hcl:"rules,optional" json:"rules,omitempty"` // 内置规则，为空时全部启用
+}
+
+// IsCustom 是否使用了output或redact配置
+func (c *LogConfig) IsCustom() bool {
+	return len(c.Outputs) > 0 || c.Redact != nil
+}
+
+// ToLogging 转为logging包的日志配置
+func (c *LogConfig) ToLogging() (*logging.LogConfig, error) {
+	cfg := logging.DefaultConfig()
+	if c.LogLevel != "" {
+		cfg.MinLevel = c.LogLevel
+	}
+	if c.Encoding != "" {
+		cfg.Encoding = c.Encoding
+	}
+	if c.TimeFormat != "" {
+		cfg.TimeFormat = c.TimeFormat
+	}
+	if c.LevelCase != "" {
+		cfg.LevelCase = c.LevelCase
+	}
+	if c.Redact != nil {
+		cfg.Redaction = &logging.Redaction{
+			Keys: c.Redact.Keys, Patterns: c.Redact.Patterns, Rules: c.Redact.Rules,
+		}
+	}
+	if len(c.Outputs) == 0 { // 没有output块时沿用log_file或log_dir
+		cfg.Outputs = c.defaultOutputs(cfg.Outputs)
+		return cfg, nil
+	}
+	cfg.Outputs = make([]logging.Output, 0, len(c.Outputs))
+	for _, out := range c.Outputs {
+		o, err := out.ToLogging(c.LogDir)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Outputs = append(cfg.Outputs, o)
+	}
+	return cfg, nil
+}
+
+// defaultOutputs 单个文件或目录下默认的两个文件
+func (c *LogConfig) defaultOutputs(outputs []logging.Output) []logging.Output {
+	if c.LogFile != "" {
+		file := strings.Replace(c.LogFile, "$FILE", "", 1)
+		return logging.SingleFileConfig(c.LogLevel, file).Outputs
+	} else if c.LogDir == "" {
+		return nil
+	}
+	for i, out := range outputs {
+		for j, path := range out.OutPaths {
+			outputs[i].OutPaths[j] = filepath.Join(c.LogDir, path)
+		}
+	}
+	return outputs
+}
+
+// ToLogging 转为logging包的输出配置
+func (o *OutputConfig) ToLogging(dir string) (out logging.Output, err error) {
+	out = logging.Output{Start: o.Start, Stop: o.Stop, Encoding: o.Encoding}
+	if o.Dedup != "" {
+		if out.DedupWindow, err = time.ParseDuration(o.Dedup); err != nil {
+			return
+		}
+	}
+	if out.Sampling, err = o.Sampling.ToLogging(); err != nil {
+		return
+	}
+	if out.Buffer, err = o.Buffer.ToLogging(); err != nil {
+		return
+	}
+	for _, path := range o.Paths {
+		out.OutPaths = append(out.OutPaths, o.Rotate.SinkURL(dir, path))
+	}
+	return
+}
+
+// ToLogging 转为logging包的采样配置
+func (s *SamplingConfig) ToLogging() (*logging.Sampling, error) {
+	if s == nil {
+		return nil, nil
+	}
+	var err error
+	sampling := &logging.Sampling{First: s.First, Thereafter: s.Thereafter}
+	if s.Interval != "" {
+		sampling.Interval, err = time.ParseDuration(s.Interval)
+	}
+	return sampling, err
+}
+
+// ToLogging 转为logging包的缓冲配置
+func (b *BufferConfig) ToLogging() (*logging.Buffer, error) {
+	if b == nil {
+		return nil, nil
+	}
+	var err error
+	buffer := &logging.Buffer{
+		Size: b.Size, FlushLevel: b.FlushLevel,
+		Block: strings.EqualFold(b.WhenFull, "block"),
+	}
+	if b.FlushInterval != "" {
+		buffer.FlushInterval, err = time.ParseDuration(b.FlushInterval)
+	}
+	return buffer, err
+}
+
+// SinkURL 生成输出地址，文件路径加上目录，有轮转配置时使用rotate地址
+func (r *RotateConfig) SinkURL(dir, path string) string {
+	if path == "stdout" || path == "stderr" || strings.Contains(path, "://") {
+		return path
+	}
+	if dir != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	if r == nil {
+		return path
+	}
+	return "rotate://" + filepath.ToSlash(path) + "?" + r.Query().Encode()
+}
+
+// Query 转为rotate地址的参数
+func (r *RotateConfig) Query() url.Values {
+	q := url.Values{}
+	setInt := func(key string, val int) {
+		if val > 0 {
+			q.Set(key, strconv.Itoa(val))
+		}
+	}
+	setBool := func(key string, val *bool) {
+		if val != nil {
+			q.Set(key, strconv.FormatBool(*val))
+		}
+	}
+	setInt("size", r.MaxSize)
+	setInt("min", r.Minutely)
+	setInt("age", r.MaxAge)
+	setInt("bak", r.MaxBackups)
+	setInt("total", r.MaxTotalSize)
+	setBool("comp", r.Compress)
+	setBool("local", r.LocalTime)
+	if r.Cycle != "" {
+		q.Set("cycle", r.Cycle)
+	}
+	if r.TimeZone != "" {
+		q.Set("tz", r.TimeZone)
+	}
+	return q
+}
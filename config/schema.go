@@ -0,0 +1,422 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// durationPattern time.ParseDuration能解析的文字
+const durationPattern = `^-?([0-9]+(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+$`
+
+// FieldDocs 配置项的说明，键为点号连接的名称，字段的doc标签优先
+var FieldDocs = map[string]string{
+	"debug":                            "调试模式",
+	"app":                              "应用配置",
+	"app.name":                         "应用名称",
+	"app.version":                      "应用版本",
+	"app.memory_limit":                 "软内存上限，单位MB，环境变量GOMEMLIMIT优先",
+	"log":                              "日志配置，指定文件夹或URL文件，或者使用output块分别配置多个输出",
+	"log.log_level":                    "最低日志级别",
+	"log.log_file":                     "单个日志文件或URL，$FILE会被去掉",
+	"log.log_dir":                      "日志目录，没有output块时写入其中的access.log和error.log",
+	"log.encoding":                     "日志格式",
+	"log.time_format":                  "时间格式",
+	"log.level_case":                   "级别名称的大小写",
+	"log.crash_logs":                   "崩溃报告中保留的最近日志条数，负数时不保留",
+	"log.output":                       "日志输出，按级别范围写入一个或多个地址",
+	"log.output.start":                 "最低级别，包含",
+	"log.output.stop":                  "最高级别，包含",
+	"log.output.paths":                 "输出的文件或URL，相对路径基于log_dir",
+	"log.output.encoding":              "日志格式，默认同log.encoding",
+	"log.output.dedup":                 "重复日志的去重窗口，例如10s",
+	"log.output.rotate":                "日志文件轮转",
+	"log.output.rotate.max_size":       "单个文件的最大尺寸，单位MB",
+	"log.output.rotate.cycle":          "按时间轮转的周期",
+	"log.output.rotate.minutely":       "按分钟轮转的间隔",
+	"log.output.rotate.max_age":        "备份保留的天数",
+	"log.output.rotate.max_backups":    "备份保留的个数",
+	"log.output.rotate.max_total_size": "全部备份的总尺寸，单位MB",
+	"log.output.rotate.compress":       "是否压缩备份",
+	"log.output.rotate.local_time":     "备份文件名是否使用本地时间",
+	"log.output.rotate.time_zone":      "轮转使用的时区，例如Asia/Shanghai",
+	"log.output.sampling":              "日志采样",
+	"log.output.sampling.interval":     "采样周期",
+	"log.output.sampling.first":        "每个周期内前几条相同的日志全部记录",
+	"log.output.sampling.thereafter":   "之后每隔几条记录一条，0表示不再记录",
+	"log.output.buffer":                "异步缓冲写入",
+	"log.output.buffer.size":           "缓冲的日志条数",
+	"log.output.buffer.flush_interval": "定时写入的间隔",
+	"log.output.buffer.flush_level":    "达到此级别时立即写入",
+	"log.output.buffer.when_full":      "缓冲满时丢弃或阻塞",
+	"log.redact":                       "日志脱敏",
+	"log.redact.keys":                  "需要脱敏的字段名",
+	"log.redact.patterns":              "需要脱敏的正则表达式",
+	"log.redact.rules":                 "启用的内置规则，为空时全部启用，none表示全部禁用",
+}
+
+// FieldDefaults 没有设置时实际使用的默认值，键为点号连接的名称
+var FieldDefaults = map[string]any{
+	"log.log_level":                    "debug",
+	"log.encoding":                     "console",
+	"log.time_format":                  "2006-01-02 15:04:05",
+	"log.level_case":                   "cap",
+	"log.crash_logs":                   DefaultCrashLogs,
+	"log.output.sampling.interval":     "1s",
+	"log.output.buffer.size":           1024,
+	"log.output.buffer.flush_interval": "1s",
+	"log.output.buffer.flush_level":    "error",
+	"log.output.buffer.when_full":      "drop",
+}
+
+// SchemaField 配置项的描述
+type SchemaField struct {
+	Key      string         // 点号连接的名称
+	Name     string         // 配置项名称
+	Type     string         // string、bool、integer、number、array或block
+	Doc      string         // 说明
+	Default  any            // 默认值，为空时没有
+	Required bool           // 是否必填
+	Repeated bool           // 配置块可以有多个
+	Labels   []string       // 配置块的标签名称
+	Rules    string         // validate标签
+	Fields   []*SchemaField // 配置块的内容
+	Open     bool           // 配置块中还可以有其他配置
+}
+
+// ConfigSchema 全部配置项的描述
+type ConfigSchema struct {
+	Fields []*SchemaField
+	Open   bool // 顶层还可以有其他配置
+}
+
+// NewConfigSchema 根据RootConfig和用户的剩余配置生成描述，remain和appRemain可以为空
+// 字段值作为默认值，没有值时使用default标签，然后是FieldDefaults
+func NewConfigSchema(remain, appRemain any) *ConfigSchema {
+	root := &RootConfig{App: &AppConfig{}}
+	s := &ConfigSchema{Open: remain == nil}
+	s.Fields = schemaFields(root, "")
+	for _, field := range s.Fields {
+		if field.Key == "app" {
+			field.Open = appRemain == nil
+			if appRemain != nil {
+				field.Fields = append(field.Fields, schemaFields(appRemain, "app.")...)
+				field.Open = hasRemain(appRemain)
+			}
+		}
+	}
+	if remain != nil {
+		s.Fields = append(s.Fields, schemaFields(remain, "")...)
+		s.Open = hasRemain(remain)
+	}
+	return s
+}
+
+// schemaFields 按hcl标签读取结构体的字段
+func schemaFields(obj any, prefix string) (result []*SchemaField) {
+	fields, opts := hclFields(obj)
+	for i, field := range fields {
+		opt := opts[i]
+		if opt.ConvType == "label" {
+			continue
+		}
+		f := &SchemaField{
+			Key: prefix + opt.Name, Name: opt.Name,
+			Rules: field.GetTag("validate"),
+		}
+		if f.Doc = field.GetTag("doc"); f.Doc == "" {
+			f.Doc = FieldDocs[f.Key]
+		}
+		if isBlock(field.Type) {
+			f.Type, f.Repeated = "block", field.Type.Kind() == reflect.Slice
+			vt := field.Type
+			for vt.Kind() == reflect.Slice || vt.Kind() == reflect.Pointer {
+				vt = vt.Elem()
+			}
+			block := reflect.New(vt).Interface()
+			if field.Type.Kind() == reflect.Pointer && !field.Value.IsNil() {
+				block = field.Value.Interface()
+			}
+			f.Labels = blockLabels(block)
+			f.Fields = schemaFields(block, f.Key+".")
+			f.Open = hasRemain(block)
+		} else {
+			f.Type = schemaType(field.Type)
+			f.Required = opt.ConvType != "optional" || strings.Contains(","+f.Rules+",", ",required,")
+			if !field.IsEmptyValue() {
+				f.Default = reflect.Indirect(field.Value).Interface()
+			} else if def := field.GetTag("default"); def != "" {
+				f.Default = parseDefault(def, f.Type)
+			} else if def, ok := FieldDefaults[f.Key]; ok {
+				f.Default = def
+			}
+		}
+		result = append(result, f)
+	}
+	return
+}
+
+// parseDefault 按类型解析default标签，解析不了时保留文字
+func parseDefault(def, typ string) any {
+	if typ == "string" {
+		return def
+	}
+	var value any
+	dec := json.NewDecoder(strings.NewReader(def))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return def
+	}
+	return normalize(value)
+}
+
+// blockLabels 配置块的标签名称
+func blockLabels(obj any) (labels []string) {
+	_, opts := hclFields(obj)
+	for _, opt := range opts {
+		if opt.ConvType == "label" {
+			labels = append(labels, opt.Name)
+		}
+	}
+	return
+}
+
+// hasRemain 结构体是否有remain字段
+func hasRemain(obj any) bool {
+	vt := reflect.Indirect(reflect.ValueOf(obj)).Type()
+	for i := 0; i < vt.NumField(); i++ {
+		if _, opt, _ := strings.Cut(vt.Field(i).Tag.Get("hcl"), ","); opt == "remain" {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaType 字段类型对应的JSON Schema类型
+func schemaType(vt reflect.Type) string {
+	if vt.Kind() == reflect.Pointer {
+		vt = vt.Elem()
+	}
+	switch vt.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map:
+		return "object"
+	}
+	return "string"
+}
+
+// JSONSchema 生成JSON Schema，用于编辑器检查JSON和YAML格式的配置文件
+func (s *ConfigSchema) JSONSchema() ([]byte, error) {
+	doc := objectSchema(s.Fields, s.Open)
+	props := doc["properties"].(map[string]any) // 解析配置文件时处理的内容
+	props["include"] = map[string]any{"type": "array", "items": map[string]any{"type": "string"},
+		"description": "包含的其他配置文件，支持通配符"}
+	props["locals"] = map[string]any{"type": "object", "description": "局部值"}
+	props["variable"] = map[string]any{"type": "object", "description": "变量，可以有默认值"}
+	doc["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	doc["title"] = "config"
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// objectSchema 一组配置项的JSON Schema
+func objectSchema(fields []*SchemaField, open bool) map[string]any {
+	props := make(map[string]any, len(fields))
+	var required []string
+	for _, f := range fields {
+		props[f.Name] = fieldSchema(f)
+		if f.Required {
+			required = append(required, f.Name)
+		}
+	}
+	result := map[string]any{"type": "object", "properties": props, "additionalProperties": open}
+	if len(required) > 0 {
+		result["required"] = required
+	}
+	return result
+}
+
+// fieldSchema 一个配置项的JSON Schema
+func fieldSchema(f *SchemaField) map[string]any {
+	if f.Type == "block" {
+		result := objectSchema(f.Fields, f.Open)
+		for range f.Labels { // 带标签的配置块按标签嵌套
+			result = map[string]any{"type": "object", "additionalProperties": result}
+		}
+		if f.Repeated && len(f.Labels) == 0 {
+			result = map[string]any{"oneOf": []any{result, map[string]any{"type": "array", "items": result}}}
+		}
+		if f.Doc != "" {
+			result["description"] = f.Doc
+		}
+		return result
+	}
+	typ := f.Type
+	if typ == "bool" {
+		typ = "boolean"
+	}
+	result := map[string]any{"type": typ}
+	if typ == "array" {
+		result["items"] = map[string]any{"type": "string"}
+	}
+	if f.Doc != "" {
+		result["description"] = f.Doc
+	}
+	if f.Default != nil {
+		result["default"] = f.Default
+	}
+	for _, rule := range splitRules(f.Rules) {
+		name, arg, _ := strings.Cut(rule, "=")
+		switch name {
+		case "min", "max":
+			num, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				continue
+			}
+			key := map[string]string{"string": "Length", "array": "Items"}[typ]
+			if key == "" {
+				result[map[string]string{"min": "minimum", "max": "maximum"}[name]] = num
+			} else {
+				result[name+key] = int(num)
+			}
+		case "oneof":
+			result["enum"] = strings.Fields(arg)
+		case "regex":
+			result["pattern"] = arg
+		case "duration":
+			result["pattern"] = durationPattern
+		case "url":
+			result["format"] = "uri"
+		}
+	}
+	return result
+}
+
+// ExampleHCL 生成带注释的示例配置，可选的配置项被注释掉
+func (s *ConfigSchema) ExampleHCL() []byte {
+	f := hclwrite.NewEmptyFile()
+	writeExample(f.Body(), s.Fields)
+	return f.Bytes()
+}
+
+// writeExample 写入一组配置项
+func writeExample(body *hclwrite.Body, fields []*SchemaField) {
+	for i, f := range fields {
+		if f.Type == "block" {
+			if i > 0 {
+				body.AppendNewline()
+			}
+			writeComment(body, f.Doc)
+			block := body.AppendNewBlock(f.Name, f.Labels)
+			writeExample(block.Body(), f.Fields)
+			continue
+		}
+		writeComment(body, f.Doc)
+		value := exampleValue(f)
+		if f.Required {
+			body.SetAttributeRaw(f.Name, value)
+		} else {
+			writeComment(body, f.Name+" = "+string(value.Bytes()))
+		}
+	}
+}
+
+// writeComment 写入注释
+func writeComment(body *hclwrite.Body, doc string) {
+	if doc != "" {
+		body.AppendUnstructuredTokens(hclwrite.Tokens{
+			{Type: hclsyntax.TokenComment, Bytes: []byte("# " + doc + "\n")},
+		})
+	}
+}
+
+// exampleValue 默认值或者类型的示例值
+func exampleValue(f *SchemaField) hclwrite.Tokens {
+	value := f.Default
+	if value == nil {
+		if _, arg, ok := strings.Cut(f.Rules, "oneof="); ok {
+			value, _, _ = strings.Cut(arg, " ")
+		}
+	}
+	if value == nil {
+		value = map[string]any{"bool": false, "integer": 0, "number": 0,
+			"array": []string{}, "object": map[string]any{}}[f.Type]
+	}
+	if value == nil {
+		value = ""
+	}
+	if str, ok := value.(string); ok && f.Type != "string" { // default标签中的非字符串值
+		return hclwrite.Tokens{{Type: hclsyntax.TokenIdent, Bytes: []byte(str)}}
+	}
+	v, err := ctyValue(value)
+	if err != nil {
+		v = cty.StringVal(fmt.Sprint(value))
+	}
+	return hclwrite.TokensForValue(v)
+}
+
+// Markdown 生成Markdown格式的配置项参考表
+func (s *ConfigSchema) Markdown() string {
+	var buf strings.Builder
+	buf.WriteString("| 配置项 | 类型 | 必填 | 默认值 | 规则 | 说明 |\n")
+	buf.WriteString("| --- | --- | --- | --- | --- | --- |\n")
+	var walk func(fields []*SchemaField)
+	walk = func(fields []*SchemaField) {
+		for _, f := range fields {
+			typ, required, def := f.Type, "", ""
+			if f.Required {
+				required = "是"
+			}
+			if f.Default != nil {
+				def = "`" + fmt.Sprint(f.Default) + "`"
+			}
+			if f.Type == "block" {
+				if len(f.Labels) > 0 {
+					typ += " \"" + strings.Join(f.Labels, "\" \"") + "\""
+				}
+				if f.Repeated {
+					typ += "，可多个"
+				}
+			}
+			rules := ""
+			if f.Rules != "" {
+				rules = "`" + f.Rules + "`"
+			}
+			doc := strings.ReplaceAll(f.Doc, "|", `\|`)
+			fmt.Fprintf(&buf, "| `%s` | %s | %s | %s | %s | %s |\n", f.Key, typ, required, def,
+				strings.ReplaceAll(rules, "|", `\|`), doc)
+			walk(f.Fields)
+		}
+	}
+	walk(s.Fields)
+	return buf.String()
+}
+
+// Keys 全部配置项的名称，已排序
+func (s *ConfigSchema) Keys() []string {
+	var keys []string
+	var walk func(fields []*SchemaField)
+	walk = func(fields []*SchemaField) {
+		for _, f := range fields {
+			keys = append(keys, f.Key)
+			walk(f.Fields)
+		}
+	}
+	walk(s.Fields)
+	sort.Strings(keys)
+	return keys
+}
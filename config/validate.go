@@ -0,0 +1,257 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/azhai/gozzo/mapper"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// ValidationError 一个配置项的验证错误
+type ValidationError struct {
+	Key     string
+	Rule    string
+	Message string
+	Range   *hcl.Range // 配置文件中的位置，没有时为空
+}
+
+// Error 实现error接口
+func (e *ValidationError) Error() string {
+	if e.Range == nil {
+		return fmt.Sprintf("%s: %s", e.Key, e.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Range, e.Key, e.Message)
+}
+
+// ValidationErrors 全部验证错误
+type ValidationErrors []*ValidationError
+
+// Error 实现error接口，每行一个错误
+func (errs ValidationErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ValidateStruct 按validate标签验证配置，body用于找出配置项在文件中的位置，可以为空
+// 规则以逗号分隔，例如 validate:"required,min=1,max=100"，支持 required、min、max、
+// oneof（空格分隔）、regex（必须放在最后）、file（文件存在）、duration 和 url
+// 没有设置的配置项只检查required，文件中设置为空值或零值时仍然检查min、max、oneof和regex
+func ValidateStruct(obj any, body hcl.Body) error {
+	var errs ValidationErrors
+	validateStruct(obj, body, "", nil, &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// validateStruct 验证一个结构体，包括其中的配置块
+func validateStruct(obj any, body hcl.Body, prefix string, defRange *hcl.Range, errs *ValidationErrors) {
+	fields, opts := hclFields(obj)
+	attrs, blocks := bodyContent(obj, body)
+	if defRange == nil && body != nil {
+		missing := body.MissingItemRange()
+		defRange = &missing
+	}
+	for i, field := range fields {
+		name, key := opts[i].Name, prefix+opts[i].Name
+		if isBlock(field.Type) {
+			validateBlocks(field, blocks[name], key, defRange, errs)
+			continue
+		}
+		rules := field.GetTag("validate")
+		if rules == "" || rules == "-" {
+			continue
+		}
+		rng := defRange
+		attr, present := attrs[name]
+		if present {
+			rng = attr.Expr.Range().Ptr()
+		}
+		for _, rule := range splitRules(rules) {
+			if msg := checkRule(field, rule, present); msg != "" {
+				*errs = append(*errs, &ValidationError{Key: key, Rule: rule, Message: msg, Range: rng})
+				break // 同一个配置项只报告第一个错误
+			}
+		}
+	}
+}
+
+// validateBlocks 验证单个或多个配置块
+func validateBlocks(field *mapper.StructField, blocks []*hcl.Block, key string,
+	defRange *hcl.Range, errs *ValidationErrors) {
+	value := field.Value
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return
+		}
+		var body hcl.Body
+		rng := defRange
+		if len(blocks) > 0 {
+			body, rng = blocks[0].Body, blocks[0].DefRange.Ptr()
+		}
+		validateStruct(value.Interface(), body, key+".", rng, errs)
+		return
+	}
+	if value.Kind() != reflect.Slice {
+		return
+	}
+	for i := 0; i < value.Len(); i++ {
+		item := value.Index(i)
+		if item.Kind() != reflect.Pointer {
+			item = item.Addr()
+		} else if item.IsNil() {
+			continue
+		}
+		var body hcl.Body
+		rng := defRange
+		if i < len(blocks) {
+			body, rng = blocks[i].Body, blocks[i].DefRange.Ptr()
+		}
+		validateStruct(item.Interface(), body, fmt.Sprintf("%s[%d].", key, i), rng, errs)
+	}
+}
+
+// bodyContent 配置文件中的属性和配置块
+func bodyContent(obj any, body hcl.Body) (map[string]*hcl.Attribute, map[string][]*hcl.Block) {
+	blocks := make(map[string][]*hcl.Block)
+	if body == nil {
+		return nil, blocks
+	}
+	schema, _ := gohcl.ImpliedBodySchema(obj)
+	content, _, _ := body.PartialContent(schema)
+	if content == nil {
+		return nil, blocks
+	}
+	for _, block := range content.Blocks {
+		blocks[block.Type] = append(blocks[block.Type], block)
+	}
+	return content.Attributes, blocks
+}
+
+// splitRules 拆分规则，regex之后的内容都属于正则表达式
+func splitRules(rules string) (result []string) {
+	for rules != "" {
+		if strings.HasPrefix(rules, "regex=") {
+			return append(result, rules)
+		}
+		var rule string
+		rule, rules, _ = strings.Cut(rules, ",")
+		if rule = strings.TrimSpace(rule); rule != "" {
+			result = append(result, rule)
+		}
+		rules = strings.TrimLeft(rules, " ")
+	}
+	return
+}
+
+// checkRule 检查一条规则，通过时返回空字符串，present表示配置项在文件中出现
+func checkRule(field *mapper.StructField, rule string, present bool) string {
+	name, arg, _ := strings.Cut(rule, "=")
+	value := reflect.Indirect(field.Value)
+	isEmpty := field.IsEmptyValue() || (value.Kind() == reflect.Slice || value.Kind() == reflect.Map) && value.Len() == 0
+	if name == "required" {
+		if isEmpty {
+			return "is required"
+		}
+		return ""
+	}
+	if isEmpty { // 没有设置的配置项只检查required，设置为空值时还要检查取值范围
+		switch name {
+		case "min", "max", "oneof", "regex":
+			if !present {
+				return ""
+			}
+		default:
+			return ""
+		}
+	}
+	switch name {
+	case "min", "max":
+		return checkRange(value, name, arg)
+	case "oneof":
+		text := fmt.Sprint(value.Interface())
+		for _, item := range strings.Fields(arg) {
+			if item == text {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of [%s], got %q", arg, text)
+	case "regex":
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return "invalid regex rule: " + err.Error()
+		}
+		if text := fmt.Sprint(value.Interface()); !re.MatchString(text) {
+			return fmt.Sprintf("%q does not match %s", text, arg)
+		}
+	case "file":
+		if _, err := os.Stat(value.String()); err != nil {
+			return fmt.Sprintf("file %s does not exist", value.String())
+		}
+	case "duration":
+		if _, err := time.ParseDuration(value.String()); err != nil {
+			return fmt.Sprintf("%q is not a valid duration", value.String())
+		}
+	case "url":
+		if u, err := url.Parse(value.String()); err != nil || u.Scheme == "" {
+			return fmt.Sprintf("%q is not a valid URL", value.String())
+		}
+	default:
+		return "unknown validate rule " + name
+	}
+	return ""
+}
+
+// checkRange 检查最小最大值，字符串、数组和哈希表检查长度
+func checkRange(value reflect.Value, name, arg string) string {
+	var (
+		actual, limit float64
+		err           error
+		what          = "value"
+	)
+	switch value.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		actual, what = float64(value.Len()), "length"
+		limit, err = strconv.ParseFloat(arg, 64)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		actual = float64(value.Int())
+		if value.Type() == durationType {
+			var d time.Duration
+			d, err = time.ParseDuration(arg)
+			limit = float64(d)
+		} else {
+			limit, err = strconv.ParseFloat(arg, 64)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		actual = float64(value.Uint())
+		limit, err = strconv.ParseFloat(arg, 64)
+	case reflect.Float32, reflect.Float64:
+		actual = value.Float()
+		limit, err = strconv.ParseFloat(arg, 64)
+	default:
+		return "cannot check " + name + " of " + value.Kind().String()
+	}
+	if err != nil {
+		return fmt.Sprintf("invalid %s rule: %s", name, arg)
+	}
+	if name == "min" && actual < limit {
+		return fmt.Sprintf("%s must be at least %s", what, arg)
+	} else if name == "max" && actual > limit {
+		return fmt.Sprintf("%s must be at most %s", what, arg)
+	}
+	return ""
+}
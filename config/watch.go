@@ -0,0 +1,220 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultWatchInterval 默认检查配置文件的间隔
+const DefaultWatchInterval = 3 * time.Second
+
+// Snapshot 某一时刻的配置
+type Snapshot struct {
+	Root    *RootConfig
+	Remain  any // 用户的剩余配置
+	Version int // 重新读取的次数，初次读取为0
+}
+
+// LogChanged 日志配置是否变化
+func (s *Snapshot) LogChanged(other *Snapshot) bool {
+	if s == nil || other == nil {
+		return s != other
+	}
+	return !reflect.DeepEqual(s.Root.Log, other.Root.Log)
+}
+
+// Watcher 定时检查配置文件的修改时间，变化时重新读取、验证并替换，然后通知订阅者
+type Watcher struct {
+	File      string
+	Loader    *Loader                                  // 不为空时使用分层读取，同时检查本地配置文件
+	NewRemain func() any                               // 创建用户的剩余配置，为空时不解析
+	Validate  func(root *RootConfig, remain any) error // 额外的验证，失败时保留原配置
+	OnError   func(err error)                          // 重新读取失败时调用
+	AutoLog   bool                                     // 日志配置变化时重新执行ReplaceLog，默认开启
+	current   atomic.Pointer[Snapshot]
+	stamps    map[string]time.Time
+	subs      []func(old, cur *Snapshot)
+	stop      chan struct{}
+	mu        sync.Mutex
+}
+
+// NewWatcher 读取配置文件并创建监视器，newRemain为空时不解析剩余配置
+func NewWatcher(file string, newRemain func() any) (*Watcher, error) {
+	w := &Watcher{File: file, NewRemain: newRemain, AutoLog: true}
+	snap, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+	w.current.Store(snap)
+	w.stamps = w.modTimes()
+	return w, nil
+}
+
+// Watch 使用分层读取创建监视器
+func (l *Loader) Watch(newRemain func() any) (*Watcher, error) {
+	w := &Watcher{File: l.File, Loader: l, NewRemain: newRemain, AutoLog: true}
+	snap, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+	w.current.Store(snap)
+	w.stamps = w.modTimes()
+	return w, nil
+}
+
+// Current 当前的配置
+func (w *Watcher) Current() *Snapshot {
+	return w.current.Load()
+}
+
+// Subscribe 订阅配置变化，参数为原来和新的配置
+func (w *Watcher) Subscribe(fn func(old, cur *Snapshot)) {
+	w.mu.Lock()
+	w.subs = append(w.subs, fn)
+	w.mu.Unlock()
+}
+
+// Start 在后台定时检查，interval为0时使用默认间隔
+func (w *Watcher) Start(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	w.mu.Lock()
+	if w.stop != nil {
+		w.mu.Unlock()
+		return
+	}
+	w.stop = make(chan struct{})
+	stop := w.stop
+	w.mu.Unlock()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if _, err := w.safeReload(); err != nil && w.OnError != nil {
+					w.OnError(err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止后台检查
+func (w *Watcher) Stop() {
+	w.mu.Lock()
+	if w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+	w.mu.Unlock()
+}
+
+// safeReload 在后台协程中重新读取，订阅者panic时转为错误
+func (w *Watcher) safeReload() (changed bool, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("reload config: panic: %v", v)
+		}
+	}()
+	return w.Reload(false)
+}
+
+// Reload 文件有变化或force时重新读取，返回是否替换了配置，
+// 日志替换失败时配置仍然替换，同时返回错误
+func (w *Watcher) Reload(force bool) (bool, error) {
+	w.mu.Lock()
+	stamps := w.modTimes()
+	if !force && reflect.DeepEqual(stamps, w.stamps) {
+		w.mu.Unlock()
+		return false, nil
+	}
+	w.stamps = stamps // 出错时也不再重复读取，等待下次修改
+	snap, err := w.load()
+	if err != nil {
+		w.mu.Unlock()
+		return false, err
+	}
+	old := w.current.Load()
+	snap.Version = old.Version + 1
+	w.current.Store(snap)
+	for file, stamp := range w.modTimes() { // 新包含的文件
+		if _, ok := stamps[file]; !ok {
+			stamps[file] = stamp
+		}
+	}
+	subs := append([]func(old, cur *Snapshot){}, w.subs...)
+	w.mu.Unlock()
+
+	if w.AutoLog && snap.Root.Log != nil && old.LogChanged(snap) {
+		err = ReplaceLog(snap.Root.Log)
+	}
+	for _, fn := range subs {
+		fn(old, snap)
+	}
+	return true, err
+}
+
+// load 读取并验证配置
+func (w *Watcher) load() (snap *Snapshot, err error) {
+	snap = &Snapshot{}
+	if w.NewRemain != nil {
+		snap.Remain = w.NewRemain()
+	}
+	if w.Loader != nil {
+		snap.Root, err = w.Loader.Load(snap.Remain)
+	} else {
+		snap.Root, err = ReadConfigFile(w.File, snap.Remain)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = validateLog(snap.Root.Log); err == nil && w.Validate != nil {
+		err = w.Validate(snap.Root, snap.Remain)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// modTimes 配置文件的修改时间，包括当前配置读取过的包含文件
+func (w *Watcher) modTimes() map[string]time.Time {
+	files := []string{w.File}
+	if w.Loader != nil {
+		files = []string{w.Loader.File, w.Loader.LocalFile()}
+	}
+	if snap := w.current.Load(); snap != nil && snap.Root != nil {
+		files = append(files, snap.Root.Files()...)
+	}
+	stamps := make(map[string]time.Time, len(files))
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			stamps[file] = info.ModTime()
+		}
+	}
+	return stamps
+}
+
+// validateLog 检查日志配置能否转换
+func validateLog(cfg *LogConfig) error {
+	if cfg == nil || !cfg.IsCustom() {
+		return nil
+	}
+	logCfg, err := cfg.ToLogging()
+	if err == nil && logCfg.Redaction != nil {
+		_, err = logCfg.Redaction.Compile()
+	}
+	if err != nil {
+		return errors.Join(errors.New("invalid log config"), err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package fiberjwt
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/azhai/gozzo/cryptogy"
+	"github.com/gofiber/fiber/v3"
+)
+
+// DefaultContextKey 校验通过的载荷保存在Locals中的键名
+const DefaultContextKey = "jwt"
+
+// Config 中间件配置，JWT不能为空
+type Config struct {
+	JWT          *cryptogy.JWT
+	NewClaims    func() cryptogy.IClaims // 创建载荷，默认为 &cryptogy.Claims{}
+	Cookie       string                  // 请求头没有Bearer令牌时读取的Cookie名，为空时不读
+	Query        string                  // 再读取的查询参数名，为空时不读
+	ContextKey   string
+	Skip         func(c fiber.Ctx) bool             // 返回真时跳过校验
+	ErrorHandler func(c fiber.Ctx, err error) error // 默认返回401，不暴露具体原因
+}
+
+// New 创建校验JWT的中间件，令牌依次从Authorization请求头、Cookie和查询参数中读取
+func New(cfg Config) fiber.Handler {
+	if cfg.JWT == nil {
+		panic("fiberjwt: JWT is required")
+	}
+	if cfg.NewClaims == nil {
+		cfg.NewClaims = func() cryptogy.IClaims {
+			return &cryptogy.Claims{}
+		}
+	}
+	if cfg.ContextKey == "" {
+		cfg.ContextKey = DefaultContextKey
+	}
+	if cfg.ErrorHandler == nil {
+		cfg.ErrorHandler = func(c fiber.Ctx, err error) error {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+			return fiber.NewError(fiber.StatusUnauthorized, "invalid token")
+		}
+	}
+	return func(c fiber.Ctx) error {
+		if cfg.Skip != nil && cfg.Skip(c) {
+			return c.Next()
+		}
+		token := lookupToken(c, cfg)
+		if token == "" {
+			return cfg.ErrorHandler(c, errors.New("missing token"))
+		}
+		claims := cfg.NewClaims()
+		if err := cfg.JWT.Parse(token, claims); err != nil {
+			return cfg.ErrorHandler(c, err)
+		}
+		c.Locals(cfg.ContextKey, claims)
+		return c.Next()
+	}
+}
+
+// lookupToken 读取令牌
+func lookupToken(c fiber.Ctx, cfg Config) string {
+	auth := c.Get(fiber.HeaderAuthorization)
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	if cfg.Cookie != "" {
+		if token := c.Cookies(cfg.Cookie); token != "" {
+			return token
+		}
+	}
+	if cfg.Query != "" {
+		return c.Query(cfg.Query)
+	}
+	return ""
+}
+
+// GetClaims 读取中间件保存的载荷，key为空时使用DefaultContextKey
+func GetClaims[T cryptogy.IClaims](c fiber.Ctx, key string) (T, bool) {
+	if key == "" {
+		key = DefaultContextKey
+	}
+	claims, ok := c.Locals(key).(T)
+	return claims, ok
+}
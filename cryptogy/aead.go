@@ -0,0 +1,339 @@
+package cryptogy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// 信封格式的版本和算法标识
+const (
+	EnvelopeVersion = 1
+
+	AlgAESGCM           byte = 1
+	AlgChaCha20Poly1305 byte = 2
+
+	StreamChunkSize = 64 * 1024 // 流式加密每段明文的长度
+)
+
+var (
+	ErrCipherTooShort  = errors.New("cipher text too short")
+	ErrInvalidEnvelope = errors.New("invalid envelope")
+	ErrUnknownKey      = errors.New("unknown key id")
+	ErrTruncatedStream = errors.New("truncated stream")
+)
+
+// AEADCipher 认证加密，支持AES-GCM和ChaCha20-Poly1305
+// 每次加密使用随机nonce，放在密文的前面
+type AEADCipher struct {
+	alg byte
+	cipher.AEAD
+}
+
+// NewAEADCipher 创建认证加密，mode为GCM（密钥16、24或32字节）或CHACHA20（密钥32字节）
+func NewAEADCipher(mode string, key []byte) (*AEADCipher, error) {
+	var (
+		c   = &AEADCipher{}
+		err error
+	)
+	switch strings.ToUpper(mode) {
+	case "GCM", "AES-GCM":
+		var block cipher.Block
+		if block, err = aes.NewCipher(key); err == nil {
+			c.alg = AlgAESGCM
+			c.AEAD, err = cipher.NewGCM(block)
+		}
+	case "CHACHA20", "CHACHA20-POLY1305":
+		c.alg = AlgChaCha20Poly1305
+		c.AEAD, err = chacha20poly1305.New(key)
+	default:
+		err = fmt.Errorf("unsupported aead mode %q", mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Alg 算法标识
+func (c *AEADCipher) Alg() byte {
+	return c.alg
+}
+
+// Encrypt 加密，没有附加数据
+func (c *AEADCipher) Encrypt(origData []byte) ([]byte, error) {
+	return c.SealData(origData, nil)
+}
+
+// Decrypt 解密，没有附加数据
+func (c *AEADCipher) Decrypt(cipherText []byte) ([]byte, error) {
+	return c.OpenData(cipherText, nil)
+}
+
+// SealData 加密，输出为 nonce + 密文 + 认证标签，附加数据不加密但参与认证
+func (c *AEADCipher) SealData(origData, aad []byte) ([]byte, error) {
+	size := c.NonceSize()
+	nonce := make([]byte, size, size+len(origData)+c.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return c.Seal(nonce, nonce, origData, aad), nil
+}
+
+// OpenData 解密并校验，附加数据需要和加密时相同
+func (c *AEADCipher) OpenData(cipherText, aad []byte) ([]byte, error) {
+	size := c.NonceSize()
+	if len(cipherText) < size+c.Overhead() {
+		return nil, ErrCipherTooShort
+	}
+	return c.Open(nil, cipherText[:size], cipherText[size:], aad)
+}
+
+// chunkNonce 每一段的nonce，由随机前缀、段序号和是否最后一段组成
+func chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, len(prefix)+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[len(prefix):], counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// readChunk 读取一段，同时判断是否最后一段
+func readChunk(r *bufio.Reader, buf []byte) (n int, last bool, err error) {
+	n, err = io.ReadFull(r, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return n, true, nil
+	} else if err != nil {
+		return
+	}
+	if _, err = r.Peek(1); errors.Is(err, io.EOF) {
+		return n, true, nil
+	}
+	return
+}
+
+// EncryptStream 分段加密大文件，输出为随机前缀和各段密文，截断、重排或丢失段都会解密失败
+func (c *AEADCipher) EncryptStream(dst io.Writer, src io.Reader, aad []byte) error {
+	prefix := make([]byte, c.NonceSize()-5)
+	if _, err := rand.Read(prefix); err != nil {
+		return err
+	}
+	if _, err := dst.Write(prefix); err != nil {
+		return err
+	}
+	r := bufio.NewReader(src)
+	buf := make([]byte, StreamChunkSize, StreamChunkSize+c.Overhead())
+	for counter := uint32(0); ; counter++ {
+		n, last, err := readChunk(r, buf)
+		if err != nil {
+			return err
+		}
+		sealed := c.Seal(buf[:0], chunkNonce(prefix, counter, last), buf[:n], aad)
+		if _, err = dst.Write(sealed); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		if counter == ^uint32(0) {
+			return errors.New("stream too large")
+		}
+	}
+}
+
+// DecryptStream 分段解密EncryptStream的输出，出错时已经写入的明文不可信
+func (c *AEADCipher) DecryptStream(dst io.Writer, src io.Reader, aad []byte) error {
+	prefix := make([]byte, c.NonceSize()-5)
+	if _, err := io.ReadFull(src, prefix); err != nil {
+		return ErrTruncatedStream
+	}
+	r := bufio.NewReader(src)
+	buf := make([]byte, StreamChunkSize+c.Overhead())
+	for counter := uint32(0); ; counter++ {
+		n, last, err := readChunk(r, buf)
+		if err != nil {
+			return err
+		}
+		if n < c.Overhead() {
+			return ErrTruncatedStream
+		}
+		plain, err := c.Open(buf[:0], chunkNonce(prefix, counter, last), buf[:n], aad)
+		if err != nil {
+			return err
+		}
+		if _, err = dst.Write(plain); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// EnvelopeCipher 带版本和密钥ID的信封加密，用于轮换密钥
+// 格式为 版本(1) + 算法(1) + ID长度(1) + 密钥ID + nonce + 密文，头部参与认证
+type EnvelopeCipher struct {
+	keys   map[string]*AEADCipher
+	active string
+	mu     sync.RWMutex
+}
+
+// NewEnvelopeCipher 创建信封加密，加入的第一个密钥为当前密钥
+func NewEnvelopeCipher() *EnvelopeCipher {
+	return &EnvelopeCipher{keys: make(map[string]*AEADCipher)}
+}
+
+// AddKey 加入密钥，旧密钥保留用于解密
+func (e *EnvelopeCipher) AddKey(id string, c *AEADCipher) error {
+	if id == "" || len(id) > 255 {
+		return fmt.Errorf("invalid key id %q", id)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.keys[id] = c
+	if e.active == "" {
+		e.active = id
+	}
+	return nil
+}
+
+// Rotate 加入新密钥并作为当前密钥
+func (e *EnvelopeCipher) Rotate(id string, c *AEADCipher) error {
+	if err := e.AddKey(id, c); err != nil {
+		return err
+	}
+	return e.SetActive(id)
+}
+
+// SetActive 修改加密使用的密钥
+func (e *EnvelopeCipher) SetActive(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.keys[id]; !ok {
+		return fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	e.active = id
+	return nil
+}
+
+// RemoveKey 删除不再使用的密钥，不能删除当前密钥
+func (e *EnvelopeCipher) RemoveKey(id string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if id != e.active {
+		delete(e.keys, id)
+	}
+}
+
+// ActiveKey 当前密钥的ID
+func (e *EnvelopeCipher) ActiveKey() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.active
+}
+
+// header 当前密钥和信封头部
+func (e *EnvelopeCipher) header() (*AEADCipher, []byte, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	c := e.keys[e.active]
+	if c == nil {
+		return nil, nil, ErrUnknownKey
+	}
+	head := append([]byte{EnvelopeVersion, c.alg, byte(len(e.active))}, e.active...)
+	return c, head, nil
+}
+
+// readHeader 读取信封头部，找到对应的密钥
+func (e *EnvelopeCipher) readHeader(r io.Reader) (*AEADCipher, []byte, error) {
+	head := make([]byte, 3)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, nil, ErrInvalidEnvelope
+	}
+	if head[0] != EnvelopeVersion {
+		return nil, nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidEnvelope, head[0])
+	}
+	id := make([]byte, head[2])
+	if _, err := io.ReadFull(r, id); err != nil {
+		return nil, nil, ErrInvalidEnvelope
+	}
+	e.mu.RLock()
+	c := e.keys[string(id)]
+	e.mu.RUnlock()
+	if c == nil {
+		return nil, nil, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	if c.alg != head[1] {
+		return nil, nil, fmt.Errorf("%w: algorithm mismatch", ErrInvalidEnvelope)
+	}
+	return c, append(head, id...), nil
+}
+
+// withAAD 头部和附加数据拼接为认证数据
+func withAAD(head, aad []byte) []byte {
+	return append(append(make([]byte, 0, len(head)+len(aad)), head...), aad...)
+}
+
+// KeyID 信封使用的密钥ID，不解密
+func KeyID(envelope []byte) (string, error) {
+	if len(envelope) < 3 || len(envelope) < 3+int(envelope[2]) {
+		return "", ErrInvalidEnvelope
+	}
+	return string(envelope[3 : 3+envelope[2]]), nil
+}
+
+// Seal 用当前密钥加密，aad可以为空
+func (e *EnvelopeCipher) Seal(origData, aad []byte) ([]byte, error) {
+	c, head, err := e.header()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := c.SealData(origData, withAAD(head, aad))
+	if err != nil {
+		return nil, err
+	}
+	return append(head, sealed...), nil
+}
+
+// Open 按信封中的密钥ID解密
+func (e *EnvelopeCipher) Open(envelope, aad []byte) ([]byte, error) {
+	r := bytes.NewReader(envelope)
+	c, head, err := e.readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	return c.OpenData(envelope[len(head):], withAAD(head, aad))
+}
+
+// EncryptStream 用当前密钥分段加密，先写入信封头部
+func (e *EnvelopeCipher) EncryptStream(dst io.Writer, src io.Reader, aad []byte) error {
+	c, head, err := e.header()
+	if err != nil {
+		return err
+	}
+	if _, err = dst.Write(head); err != nil {
+		return err
+	}
+	return c.EncryptStream(dst, src, withAAD(head, aad))
+}
+
+// DecryptStream 读取信封头部，用对应的密钥分段解密
+func (e *EnvelopeCipher) DecryptStream(dst io.Writer, src io.Reader, aad []byte) error {
+	c, head, err := e.readHeader(src)
+	if err != nil {
+		return err
+	}
+	return c.DecryptStream(dst, src, withAAD(head, aad))
+}
@@ -50,13 +50,15 @@ func PKCS7Unpadding(origData []byte) []byte {
 	return origData[:(length - unpadding)]
 }
 
-// AES加密，支持模式CBC、CFB、CTR、OFB，不支持ECB和GCM
+// AES加密，支持模式CBC、CFB、CTR、OFB和GCM，不支持ECB
 // 其中CBC模式一般需要填充，用法: c.SetPaddingFunc("PKCS5")
+// GCM模式使用随机nonce并校验完整性，不需要填充，见AEADCipher
 type AESCipher struct {
 	modeName  string
 	iv        []byte
 	Padding   PaddingFunc
 	Unpadding UnpaddingFunc
+	aead      *AEADCipher
 	cipher.Block
 }
 
@@ -67,6 +69,9 @@ func NewAESCipher(mode string, key []byte) (*AESCipher, error) {
 		c.Block = block
 		c.iv = key[:c.BlockSize()]
 	}
+	if err == nil && c.modeName == "GCM" {
+		c.aead, err = NewAEADCipher(c.modeName, key)
+	}
 	return c, err
 }
 
@@ -110,6 +115,9 @@ func (c *AESCipher) GetDecrypter() cipher.BlockMode {
 }
 
 func (c *AESCipher) Encrypt(origData []byte) ([]byte, error) {
+	if c.aead != nil {
+		return c.aead.Encrypt(origData)
+	}
 	if c.Padding != nil {
 		origData = c.Padding(origData, c.BlockSize())
 	}
@@ -123,6 +131,9 @@ func (c *AESCipher) Encrypt(origData []byte) ([]byte, error) {
 }
 
 func (c *AESCipher) Decrypt(cipherText []byte) ([]byte, error) {
+	if c.aead != nil {
+		return c.aead.Decrypt(cipherText)
+	}
 	origData := make([]byte, len(cipherText))
 	if c.modeName == "CBC" {
 		c.GetDecrypter().CryptBlocks(origData, cipherText)
@@ -1,11 +1,24 @@
 package cryptogy
 
 import (
+	"bytes"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -155,3 +168,515 @@ func TestRsaSha256Sign(t *testing.T) {
 		t.Logf("RSA-SHA256(data%d) = (bin%d) %x", i, len(signed), signed)
 	}
 }
+
+func TestPasswordCiphers(t *testing.T) {
+	ciphers := []ICipher{
+		NewArgon2Cipher(1024, 1, 1), NewBcryptCipher(bcrypt.MinCost), NewScryptCipher(10, 8, 1),
+	}
+	for _, c := range ciphers {
+		hashed := c.CreatePassword("secret")
+		assert.True(t, c.VerifyPassword("secret", hashed))
+		assert.False(t, c.VerifyPassword("Secret", hashed))
+		assert.False(t, c.(IRehasher).NeedsRehash(hashed))
+		t.Logf("%s = %s", HashID(hashed), hashed)
+	}
+	strong := NewArgon2Cipher(2048, 1, 1)
+	assert.True(t, strong.NeedsRehash(ciphers[0].CreatePassword("secret")))
+
+	// 篡改过的哈希参数超出上限，直接校验失败
+	hashed := ciphers[0].CreatePassword("secret")
+	tampered := strings.Replace(hashed, "m=1024,", "m=4194304,", 1)
+	assert.False(t, ciphers[0].VerifyPassword("secret", tampered))
+	hashed = ciphers[2].CreatePassword("secret")
+	tampered = strings.Replace(hashed, "ln=10,", "ln=30,", 1)
+	assert.False(t, ciphers[2].VerifyPassword("secret", tampered))
+	hashed = ciphers[1].CreatePassword("secret")
+	tampered = strings.Replace(hashed, "$04$", "$31$", 1)
+	assert.False(t, ciphers[1].VerifyPassword("secret", tampered))
+}
+
+func TestCheckPassword(t *testing.T) {
+	legacy := Cipher().CreatePassword("secret")
+	ok, rehash := CheckPassword("secret", legacy)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+	ok, rehash = CheckPassword("wrong", legacy)
+	assert.False(t, ok)
+	assert.False(t, rehash)
+
+	scrypted := NewScryptCipher(10, 8, 1).CreatePassword("secret")
+	ok, rehash = CheckPassword("secret", scrypted)
+	assert.True(t, ok)
+	assert.True(t, rehash) // 不是默认算法
+
+	hashed := CreatePassword("secret")
+	assert.Equal(t, Argon2idID, HashID(hashed))
+	ok, rehash = CheckPassword("secret", hashed)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+	assert.False(t, VerifyPassword("secret", "$unknown$abc"))
+	assert.Error(t, SetDefaultCipher("md5"))
+}
+
+func TestAeadEncrypt(t *testing.T) {
+	key := []byte(RandSalt(32))
+	for _, mode := range []string{"GCM", "CHACHA20"} {
+		c, err := NewAEADCipher(mode, key)
+		assert.NoError(t, err)
+		for i, data := range origDatas {
+			secret, err := c.SealData([]byte(data), []byte("user:1"))
+			assert.NoError(t, err)
+			plain, err := c.OpenData(secret, []byte("user:1"))
+			assert.NoError(t, err)
+			assert.Equal(t, data, string(plain))
+			_, err = c.OpenData(secret, []byte("user:2"))
+			assert.Error(t, err)
+			t.Logf("%s(data%d) = (bin%d) %x", mode, i, len(secret), secret)
+		}
+	}
+	c, err := NewAESCipher("GCM", key)
+	assert.NoError(t, err)
+	secret, err := c.Encrypt([]byte(origDatas[1]))
+	assert.NoError(t, err)
+	plain, err := c.Decrypt(secret)
+	assert.NoError(t, err)
+	assert.Equal(t, origDatas[1], string(plain))
+}
+
+func TestEnvelopeRotate(t *testing.T) {
+	e := NewEnvelopeCipher()
+	old, _ := NewAEADCipher("GCM", []byte(RandSalt(32)))
+	assert.NoError(t, e.AddKey("k1", old))
+	sealed, err := e.Seal([]byte("Hello World"), nil)
+	assert.NoError(t, err)
+
+	latest, _ := NewAEADCipher("CHACHA20", []byte(RandSalt(32)))
+	assert.NoError(t, e.Rotate("k2", latest))
+	plain, err := e.Open(sealed, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello World", string(plain))
+	resealed, err := e.Seal(plain, nil)
+	assert.NoError(t, err)
+	id, _ := KeyID(resealed)
+	assert.Equal(t, "k2", id)
+
+	e.RemoveKey("k1")
+	_, err = e.Open(sealed, nil)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	resealed[len(resealed)-1] ^= 1
+	_, err = e.Open(resealed, nil)
+	assert.Error(t, err)
+}
+
+func TestEnvelopeStream(t *testing.T) {
+	e := NewEnvelopeCipher()
+	c, _ := NewAEADCipher("GCM", []byte(RandSalt(32)))
+	assert.NoError(t, e.AddKey("k1", c))
+	for _, size := range []int{0, 100, StreamChunkSize, StreamChunkSize*2 + 7} {
+		data := []byte(strings.Repeat("x", size))
+		var secret, plain bytes.Buffer
+		assert.NoError(t, e.EncryptStream(&secret, bytes.NewReader(data), []byte("file.txt")))
+		encrypted := secret.Bytes()
+		assert.NoError(t, e.DecryptStream(&plain, bytes.NewReader(encrypted), []byte("file.txt")))
+		assert.Equal(t, string(data), plain.String())
+		if size > StreamChunkSize { // 去掉最后一段
+			cut := encrypted[:len(encrypted)-7-c.Overhead()]
+			assert.Error(t, e.DecryptStream(io.Discard, bytes.NewReader(cut), []byte("file.txt")))
+		}
+	}
+}
+
+type opaqueSigner struct {
+	crypto.Signer
+}
+
+type userClaims struct {
+	Claims
+	Role string `json:"role"`
+}
+
+func TestJWTAlgorithms(t *testing.T) {
+	rsaKey, err := NewRSAKey("rsa", NewRSACipher(privKey, pubKey))
+	assert.NoError(t, err)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	esKey, err := NewSignerKey("ec", ecKey)
+	assert.NoError(t, err)
+	_, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	edKey, err := NewSignerKey("ed", edPriv)
+	assert.NoError(t, err)
+	opaqueKey, err := NewSignerKey("opaque", opaqueSigner{ecKey}) // 不是*ecdsa.PrivateKey
+	assert.NoError(t, err)
+	keys := []*JWTKey{NewHMACKey("hs", []byte("secret")), rsaKey, esKey, edKey, opaqueKey}
+	for _, key := range keys {
+		j := NewJWT(NewJWTKeySet(key))
+		j.Issuer, j.Audience, j.TTL = "gozzo", "admin", time.Minute
+		token, err := j.Sign(&userClaims{Claims: Claims{Subject: "1"}, Role: "root"})
+		assert.NoError(t, err)
+		claims := &userClaims{}
+		assert.NoError(t, j.Parse(token, claims))
+		assert.Equal(t, "root", claims.Role)
+		assert.Equal(t, Audience{"admin"}, claims.Audience)
+		other, _ := j.Sign(&userClaims{Claims: Claims{Subject: "2"}, Role: "root"})
+		forged := other[:strings.LastIndex(other, ".")] + token[strings.LastIndex(token, "."):]
+		assert.ErrorIs(t, j.Parse(forged, claims), ErrTokenSignature)
+		t.Logf("%s = %s", key.Alg, token)
+	}
+}
+
+func TestJWTClaims(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	old, latest := NewHMACKey("k1", []byte("old")), NewHMACKey("k2", []byte("new"))
+	keys := NewJWTKeySet(old, latest)
+	j := NewJWT(keys)
+	j.Issuer, j.Leeway = "gozzo", 5*time.Second
+	j.Now = func() time.Time { return now }
+	token, err := j.Sign(&Claims{ExpiresAt: now.Unix() - 3, NotBefore: now.Unix() - 60})
+	assert.NoError(t, err)
+	assert.NoError(t, j.Parse(token, &Claims{})) // 在时钟误差内
+
+	assert.NoError(t, keys.SetActive("k2"))
+	assert.NoError(t, j.Parse(token, &Claims{})) // 旧密钥仍能校验
+	j.Leeway = 0
+	assert.ErrorIs(t, j.Parse(token, &Claims{}), ErrTokenExpired)
+	token, _ = j.Sign(&Claims{NotBefore: now.Unix() + 60})
+	assert.ErrorIs(t, j.Parse(token, &Claims{}), ErrTokenNotValidYet)
+	j.Audience = "admin"
+	token, _ = j.Sign(&Claims{Audience: Audience{"guest"}})
+	assert.ErrorIs(t, j.Parse(token, &Claims{}), ErrTokenAudience)
+	keys.Remove("k1")
+	token, _ = NewJWT(NewJWTKeySet(old)).Sign(&Claims{})
+	assert.ErrorIs(t, j.Parse(token, &Claims{}), ErrTokenUnverifiable)
+
+	// 有效期为永久的JWT，设置了TTL或者RequireExp时不接受
+	j.Audience = ""
+	token, _ = j.Sign(&Claims{})
+	assert.NoError(t, j.Parse(token, &Claims{}))
+	j.RequireExp = true
+	assert.ErrorIs(t, j.Parse(token, &Claims{}), ErrTokenNoExpiry)
+	j.RequireExp, j.TTL = false, time.Minute
+	assert.ErrorIs(t, j.Parse(token, &Claims{}), ErrTokenNoExpiry)
+	token, _ = j.Sign(&Claims{})
+	assert.NoError(t, j.Parse(token, &Claims{}))
+}
+
+func TestKeyRingPEM(t *testing.T) {
+	ring := NewKeyRing()
+	for _, kind := range []string{KeyTypeRSA, KeyTypeEC, KeyTypeEd25519} {
+		entry, err := ring.Generate(kind, kind, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, kind, entry.Type())
+		formats := []string{KeyFormatPKCS8}
+		if kind == KeyTypeRSA {
+			formats = append(formats, KeyFormatPKCS1)
+		} else if kind == KeyTypeEC {
+			formats = append(formats, KeyFormatSEC1)
+		}
+		for _, format := range formats {
+			data, err := ring.ExportPEM(kind, true, format, nil)
+			assert.NoError(t, err)
+			imported, err := ring.ImportPEM(kind+format, data, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, entry.Public, imported.Public)
+		}
+		data, err := ring.ExportPEM(kind, false, KeyFormatPKIX, nil)
+		assert.NoError(t, err)
+		imported, err := ring.ImportPEM(kind+"pub", data, nil)
+		assert.NoError(t, err)
+		assert.Nil(t, imported.Private)
+	}
+	assert.Equal(t, KeyTypeRSA, ring.Active().ID)
+}
+
+func TestKeyRingEncrypted(t *testing.T) {
+	PBKDF2Iterations = 1000
+	key, err := GenerateKey(KeyTypeEC, 384)
+	assert.NoError(t, err)
+	data, err := MarshalPrivateKeyPEM(key, KeyFormatPKCS8, []byte("passphrase"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "ENCRYPTED PRIVATE KEY")
+	parsed, err := ParsePrivateKeyPEM(data, []byte("passphrase"))
+	assert.NoError(t, err)
+	assert.Equal(t, key.Public(), parsed.Public())
+	_, err = ParsePrivateKeyPEM(data, []byte("wrong"))
+	assert.Error(t, err)
+	_, err = MarshalPrivateKeyPEM(key, KeyFormatSEC1, []byte("passphrase"))
+	assert.Error(t, err)
+
+	c := NewRSACipher(privKey, pubKey)
+	priv, err := c.GetPrivateKey()
+	assert.NoError(t, err)
+	data, err = MarshalPrivateKeyPEM(priv, KeyFormatPKCS8, nil)
+	assert.NoError(t, err)
+	secret, err := c.Encrypt([]byte("Hello World"))
+	assert.NoError(t, err)
+	plain, err := NewRSACipher(string(data), "").Decrypt(secret) // PKCS8私钥
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello World", string(plain))
+}
+
+func TestKeyRingJWK(t *testing.T) {
+	ring := NewKeyRing()
+	for _, kind := range []string{KeyTypeRSA, KeyTypeEC, KeyTypeEd25519} {
+		entry, err := ring.Generate(kind+"gen", kind, 0)
+		assert.NoError(t, err)
+		jwk, err := NewJWK(entry.Private, kind)
+		assert.NoError(t, err)
+		data, _ := json.Marshal(jwk)
+		imported, err := ring.ImportJWK("", data)
+		assert.NoError(t, err)
+		assert.Equal(t, kind, imported.ID)
+		assert.Equal(t, entry.Public, imported.Public)
+		_, err = ring.ImportJWK("", data)
+		assert.ErrorContains(t, err, "already exists") // 不替换同名密钥
+		data, _ = json.Marshal(jwk.PublicJWK())
+		imported, err = ring.ImportJWK(kind+"pub", data)
+		assert.NoError(t, err)
+		assert.Nil(t, imported.Private)
+	}
+	set, err := ring.JWKS()
+	assert.NoError(t, err)
+	assert.Len(t, set.Keys, 9)
+	assert.False(t, set.Get(KeyTypeRSA).IsPrivate())
+}
+
+func TestKeyRingRotate(t *testing.T) {
+	ring := NewKeyRing()
+	_, err := ring.Generate("k1", KeyTypeEd25519, 0)
+	assert.NoError(t, err)
+	keys, err := ring.JWTKeySet()
+	assert.NoError(t, err)
+	token, err := NewJWT(keys).Sign(&Claims{Subject: "1"})
+	assert.NoError(t, err)
+
+	_, err = ring.Rotate("k2", KeyTypeEC, 256)
+	assert.NoError(t, err)
+	assert.Equal(t, "k2", ring.Active().ID)
+	keys, err = ring.JWTKeySet()
+	assert.NoError(t, err)
+	j := NewJWT(keys)
+	assert.NoError(t, j.Parse(token, &Claims{})) // 旧密钥仍能校验
+	token, err = j.Sign(&Claims{})
+	assert.NoError(t, err)
+	assert.Contains(t, token, jwtEncoding.EncodeToString([]byte(`{"alg":"ES256"`))[:10])
+	ring.Remove("k2")
+	assert.NotNil(t, ring.Get("k2")) // 不能删除当前密钥
+	_, err = ring.Add("k2", ring.Get("k1").Public)
+	assert.ErrorContains(t, err, "public-only") // 不能用公钥替换当前密钥
+	_, err = ring.Rotate("k2", KeyTypeEd25519, 0)
+	assert.Error(t, err) // 不能用同名的私钥替换当前密钥
+	assert.Equal(t, KeyTypeEC, ring.Active().Type())
+
+	// JWT只支持P-256，P-384的密钥不用于JWT，是当前密钥时返回错误
+	_, err = ring.Generate("k3", KeyTypeEC, 384)
+	assert.NoError(t, err)
+	keys, err = ring.JWTKeySet()
+	assert.NoError(t, err)
+	assert.Nil(t, keys.Get("k3"))
+	assert.NotNil(t, keys.Get("k1"))
+	assert.NoError(t, ring.SetActive("k3"))
+	_, err = ring.JWTKeySet()
+	assert.Error(t, err)
+}
+
+// 用openssl生成的测试向量，密钥为privKey和pubKey，明文为 Hello World
+// openssl pkeyutl -encrypt -pubin -inkey pub.pem -pkeyopt rsa_padding_mode:oaep -pkeyopt rsa_oaep_md:sha256 -pkeyopt rsa_mgf1_md:sha256
+// openssl dgst -sha256 -sign priv.pem -sigopt rsa_padding_mode:pss -sigopt rsa_pss_saltlen:32
+const (
+	opensslOAEP = "VUpuqZVi8zg9Lkr3QV+35YZx6GuTNLw/bMilr0f1DmEg/l3CTXliRKliN2l0Tr+l9vqG/MKSwXwojH4avoCU1Kq9DWAKvkkxHBgvDVHd0W/9ASGeUa+7rucMKSLCkX1m/6fxIH/YfWEnfsh6sTQJhT3XiRUcRv+RmdyLPeHLAZGP3HDCRxIXlwEMEbvcy6W9wCIeFUyuziOm81SpEhxCZkc28tkFMwSVQsdQWz44FxkW/r2LC0OThxL4gGaY9asl/jCZ7Of5K3xWCCIwcq7kHFvJNQmuTKMP54W5nxYxVefcaFhpO3hQBS7TZnUuLjglztR9kMYL64Ub75ub9gV9ywqGF/gRXapP8NwUhylKGrVprMrHD6WNR6dMGQK9yXGKEHP9SRySDO/8NS/ZdTdyw1gjU0t72Zj/R5SQK2ck9yYa70Pj22nT7w2ZjOTLeIJ5CuRo3UExT1ZK4ZKdgZsfe3YZ2HNBHusJiUidVy+fm9XqQa9lMww2wSB70EUMSiJJy0EA3rl2qQwJgOl399vk0kcr9oOOVSyYM55Rc2jsROj7yQuikYXpsCtb64axf9zc+Vkqej6qafJm1zb9535aoyE1hOsoeUXR5Epi20J7uBR2jkD6mNR+HOCrcIET8JzzD3S9KP27aIzaNQPjRuhRm7Vdcj4uf/8LWoET9UxFOaQ="
+	opensslPSS  = "m3s/xmMHZ9qojc9Lp7ia2yroDU8bAMChpbNrR4iu+rMDpLOBsP38Lytn40w4F+AZeb1F00Yt1vGYox36jwL5hUGjTGR7atre9sMsawFFnSOe49KKsOJE5UgQJRP+mZ2+XUcSdhzNE43AE4aew0uiEfE+twxGuwhHJDk+NLRD8pgkUkinhYF8cDILVBN90rE+xIV7rKOh8ewkTowZFxoWLlPrNRep/sNxg1s7iWyN2tshFqQAZNEjukic77O4nNW27UZJ3HDTbggurfTID4I5lLlxwH3ZudpPkh7SDng1VlHW8vTI4VCuRDfVbaaN6KmP5a3Qvu3kCFSRgwfjwklFNMeQRz7JbdeDgzPTQaO/bJeF3SscUD9L70KsghWc/+hDewQNFsM/KMx+k8EKEndWhJjkXYk68/AHFY6w5ZdLaPUhbJQQdCdUzgrTa/Bqs7q0Vr0vKyhNh0aBZMVtgyIKtR+ursO1nmFon0OMq1QtBmFS7otL0A96ZjqiMPCV8fds9xNgdptd1NivOp2sAewhYowjtPBlEnGEssmCM/rK4MkWUG5dWA6rLcfT4ZXq5v7oXoOt8WWHZsYlBByqCGigqVyeXIe0VjiXlo+TiuJ6cZeOD+5PFm9RaxGJLGihuxlA4jmI/TU2G3yx33/KgVh6w9apmkc0roWDclxRCmy18vw="
+)
+
+func TestRsaOaepEncrypt(t *testing.T) {
+	c := NewRSACipher(privKey, pubKey)
+	secret, _ := base64.StdEncoding.DecodeString(opensslOAEP)
+	plain, err := c.DecryptOAEP(crypto.SHA256, secret, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello World", string(plain))
+	for _, hash := range []crypto.Hash{crypto.SHA1, crypto.SHA256, crypto.SHA512} {
+		secret, err = c.EncryptOAEP(hash, []byte(origDatas[1]), []byte("label"))
+		assert.NoError(t, err)
+		plain, err = c.DecryptOAEP(hash, secret, []byte("label"))
+		assert.NoError(t, err)
+		assert.Equal(t, origDatas[1], string(plain))
+		_, err = c.DecryptOAEP(hash, secret, nil)
+		assert.Error(t, err)
+	}
+}
+
+func TestRsaPssSign(t *testing.T) {
+	c := NewRSACipher(privKey, pubKey)
+	signed, _ := base64.StdEncoding.DecodeString(opensslPSS)
+	assert.NoError(t, c.VerifyPSS(crypto.SHA256, []byte("Hello World"), signed))
+	assert.Error(t, c.Verify(crypto.SHA256, []byte("Hello World"), signed))
+	for i, data := range origDatas {
+		signed, err := c.SignPSS(crypto.SHA384, []byte(data))
+		assert.NoError(t, err)
+		assert.NoError(t, c.VerifyPSS(crypto.SHA384, []byte(data), signed))
+		assert.Error(t, c.VerifyPSS(crypto.SHA256, []byte(data), signed))
+		t.Logf("RSA-PSS-SHA384(data%d) = (bin%d) %x", i, len(signed), signed)
+	}
+}
+
+func TestRsaHybridEncrypt(t *testing.T) {
+	c := NewRSACipher(privKey, pubKey)
+	large := []byte(strings.Repeat(origDatas[2], 100))
+	_, err := c.Encrypt(large)
+	assert.Error(t, err) // 超过密钥长度
+	for _, data := range append(origDatas, string(large)) {
+		secret, err := c.EncryptHybrid([]byte(data))
+		assert.NoError(t, err)
+		plain, err := c.DecryptHybrid(secret)
+		assert.NoError(t, err)
+		assert.Equal(t, data, string(plain))
+		secret[5] ^= 1 // 修改包装的密钥
+		_, err = c.DecryptHybrid(secret)
+		assert.Error(t, err)
+	}
+}
+
+func TestRequestSign(t *testing.T) {
+	signer := NewRequestSigner("partner", "s3cret")
+	verifier := NewRequestVerifier(map[string]string{"partner": "s3cret"}, nil)
+	body := `{"order":"A001","amount":100}`
+	req := httptest.NewRequest("POST", "https://api.example.com/v1/orders?b=2&a=1&a=0&q=x%20y", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	assert.NoError(t, signer.Sign(req))
+	keyID, err := verifier.Verify(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "partner", keyID)
+	data, _ := io.ReadAll(req.Body) // 请求体可以再次读取
+	assert.Equal(t, body, string(data))
+
+	req.Body = io.NopCloser(strings.NewReader(body))
+	_, err = verifier.Verify(req)
+	assert.ErrorIs(t, err, ErrNonceReused)
+
+	for _, change := range []func(r *http.Request){
+		func(r *http.Request) { r.Body = io.NopCloser(strings.NewReader(`{"order":"A001","amount":1}`)) },
+		func(r *http.Request) { r.URL.RawQuery = "a=2&b=2" },
+		func(r *http.Request) { r.Header.Set("Content-Type", "text/plain") },
+		func(r *http.Request) { r.Method = "PUT" },
+	} {
+		req = httptest.NewRequest("POST", "https://api.example.com/v1/orders?b=2&a=1", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		assert.NoError(t, signer.Sign(req))
+		change(req)
+		_, err = verifier.Verify(req)
+		assert.ErrorIs(t, err, ErrSignatureInvalid)
+	}
+
+	signer.Now = func() time.Time { return time.Now().Add(-10 * time.Minute) }
+	req = httptest.NewRequest("GET", "https://api.example.com/v1/orders", nil)
+	assert.NoError(t, signer.Sign(req))
+	_, err = verifier.Verify(req)
+	assert.ErrorIs(t, err, ErrSignatureExpired)
+	req.Header.Del("Authorization")
+	_, err = verifier.Verify(req)
+	assert.ErrorIs(t, err, ErrSignatureMissing)
+
+	// 签名的请求头缺少必须的content-type
+	req = httptest.NewRequest("POST", "https://api.example.com/v1/orders", strings.NewReader(body))
+	assert.NoError(t, NewRequestSigner("partner", "s3cret", "host").Sign(req))
+	_, err = verifier.Verify(req)
+	assert.ErrorIs(t, err, ErrSignatureInvalid)
+
+	verifier.MaxBodySize = 16
+	req = httptest.NewRequest("POST", "https://api.example.com/v1/orders", strings.NewReader(body))
+	assert.NoError(t, NewRequestSigner("partner", "s3cret").Sign(req))
+	_, err = verifier.Verify(req)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+}
+
+func TestSignedURL(t *testing.T) {
+	signer := NewRequestSigner("cdn", "s3cret")
+	verifier := NewRequestVerifier(map[string]string{"cdn": "s3cret"}, nil)
+	link, err := signer.SignURL("https://files.example.com/report 2024.pdf?inline=1", time.Hour)
+	assert.NoError(t, err)
+	u, _ := url.Parse(link)
+	keyID, err := verifier.VerifyURL(u)
+	assert.NoError(t, err)
+	assert.Equal(t, "cdn", keyID)
+	_, err = verifier.VerifyURL(u) // 有效期内可以重复使用
+	assert.NoError(t, err)
+
+	u, _ = url.Parse(strings.Replace(link, "inline=1", "inline=0", 1))
+	_, err = verifier.VerifyURL(u)
+	assert.ErrorIs(t, err, ErrSignatureInvalid)
+	link, _ = signer.SignURL("https://files.example.com/report.pdf", -time.Minute)
+	u, _ = url.Parse(link)
+	_, err = verifier.VerifyURL(u)
+	assert.ErrorIs(t, err, ErrSignatureExpired)
+}
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226 附录D的测试向量
+	expected := []string{"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489"}
+	h, err := NewHOTP(otpEncoding.EncodeToString([]byte("12345678901234567890")))
+	assert.NoError(t, err)
+	for i, code := range expected {
+		assert.Equal(t, code, h.Code(uint64(i)))
+	}
+	next, ok := h.Verify("969429", 1) // 向后查找
+	assert.True(t, ok)
+	assert.Equal(t, uint64(4), next)
+	_, ok = h.Verify("755224", next)
+	assert.False(t, ok)
+	h.Issuer, h.Account = "Gozzo", "admin@example.com"
+	uri, err := h.URI(4)
+	assert.NoError(t, err)
+	assert.Equal(t, "otpauth://hotp/Gozzo:admin@example.com?algorithm=SHA1&counter=4&digits=6"+
+		"&issuer=Gozzo&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", uri)
+
+	// 不支持的位数和算法不退回默认值
+	h.Digits = 10
+	assert.Empty(t, h.Code(0))
+	_, ok = h.Verify("", 0)
+	assert.False(t, ok)
+	_, err = h.URI(0)
+	assert.ErrorContains(t, err, "digits")
+	h.Digits, h.Algorithm = 8, "MD5"
+	assert.Empty(t, h.Code(0))
+	_, err = h.URI(0)
+	assert.ErrorContains(t, err, "algorithm")
+}
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 附录B的测试向量
+	vectors := []struct {
+		algo, secret string
+		at           int64
+		code         string
+	}{
+		{"SHA1", "12345678901234567890", 59, "94287082"},
+		{"SHA256", "12345678901234567890123456789012", 1111111109, "68084774"},
+		{"SHA512", strings.Repeat("1234567890", 6) + "1234", 20000000000, "47863826"},
+	}
+	for _, v := range vectors {
+		totp, err := NewTOTP(otpEncoding.EncodeToString([]byte(v.secret)))
+		assert.NoError(t, err)
+		totp.Algorithm, totp.Digits = v.algo, 8
+		assert.Equal(t, v.code, totp.At(time.Unix(v.at, 0)))
+	}
+
+	secret, err := GenerateOTPSecret(0)
+	assert.NoError(t, err)
+	assert.Len(t, secret, 32)
+	totp, err := NewTOTP(strings.ToLower(secret))
+	assert.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+	totp.Now = func() time.Time { return now }
+	code := totp.At(now.Add(-30 * time.Second)) // 上一个时间步
+	assert.True(t, totp.Verify(code))
+	assert.False(t, totp.Verify(code)) // 只能使用一次
+	other, err := NewTOTP(secret)
+	assert.NoError(t, err)
+	other.Now = totp.Now
+	assert.False(t, other.Verify(code)) // 其他实例同样不能再次使用
+	assert.False(t, totp.Verify(totp.At(now.Add(-90*time.Second))))
+	uri, err := totp.URI()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/?algorithm=SHA1&digits=6&period=30&secret="))
+	_, err = NewTOTP("not base32!")
+	assert.ErrorIs(t, err, ErrInvalidSecret)
+}
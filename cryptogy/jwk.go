@@ -0,0 +1,238 @@
+package cryptogy
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// JWK RFC 7517格式的密钥，支持RSA、EC和OKP(Ed25519)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	D   string `json:"d,omitempty"`
+	P   string `json:"p,omitempty"`
+	Q   string `json:"q,omitempty"`
+	DP  string `json:"dp,omitempty"`
+	DQ  string `json:"dq,omitempty"`
+	QI  string `json:"qi,omitempty"`
+}
+
+// JWKSet JWK集合
+type JWKSet struct {
+	Keys []*JWK `json:"keys"`
+}
+
+// Get 按kid找到JWK
+func (s *JWKSet) Get(kid string) *JWK {
+	for _, key := range s.Keys {
+		if key.Kid == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+// ParseJWK 解析JSON格式的JWK
+func ParseJWK(data []byte) (*JWK, error) {
+	jwk := &JWK{}
+	if err := json.Unmarshal(data, jwk); err != nil {
+		return nil, err
+	}
+	return jwk, nil
+}
+
+// encodeInt 大整数编码，size大于0时左侧补0到固定长度
+func encodeInt(n *big.Int, size int) string {
+	if size > 0 {
+		return jwtEncoding.EncodeToString(n.FillBytes(make([]byte, size)))
+	}
+	return jwtEncoding.EncodeToString(n.Bytes())
+}
+
+// decodeInt 解码大整数
+func decodeInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("jwk: missing parameter")
+	}
+	buf, err := jwtEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(buf), nil
+}
+
+// NewJWK 私钥或公钥转为JWK，私钥包含全部参数，用PublicJWK去掉私有部分
+func NewJWK(key any, kid string) (*JWK, error) {
+	jwk := &JWK{Kid: kid, Use: "sig"}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if len(k.Primes) != 2 {
+			return nil, errors.New("jwk: multi-prime RSA key is not supported")
+		}
+		k.Precompute()
+		jwk, _ = NewJWK(&k.PublicKey, kid)
+		jwk.D = encodeInt(k.D, 0)
+		jwk.P, jwk.Q = encodeInt(k.Primes[0], 0), encodeInt(k.Primes[1], 0)
+		jwk.DP, jwk.DQ = encodeInt(k.Precomputed.Dp, 0), encodeInt(k.Precomputed.Dq, 0)
+		jwk.QI = encodeInt(k.Precomputed.Qinv, 0)
+	case *rsa.PublicKey:
+		jwk.Kty, jwk.Alg = "RSA", AlgRS256
+		jwk.N, jwk.E = encodeInt(k.N, 0), encodeInt(big.NewInt(int64(k.E)), 0)
+	case *ecdsa.PrivateKey:
+		var err error
+		if jwk, err = NewJWK(&k.PublicKey, kid); err != nil {
+			return nil, err
+		}
+		jwk.D = encodeInt(k.D, (k.Curve.Params().BitSize+7)/8)
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk.Kty, jwk.Crv = "EC", k.Curve.Params().Name
+		switch jwk.Crv {
+		case "P-256":
+			jwk.Alg = AlgES256
+		case "P-384":
+			jwk.Alg = "ES384"
+		case "P-521":
+			jwk.Alg = "ES512"
+		default:
+			return nil, fmt.Errorf("jwk: unsupported curve %s", jwk.Crv)
+		}
+		jwk.X, jwk.Y = encodeInt(k.X, size), encodeInt(k.Y, size) //nolint:staticcheck
+	case ed25519.PrivateKey:
+		jwk, _ = NewJWK(k.Public(), kid)
+		jwk.D = jwtEncoding.EncodeToString(k.Seed())
+	case ed25519.PublicKey:
+		jwk.Kty, jwk.Crv, jwk.Alg = "OKP", "Ed25519", AlgEdDSA
+		jwk.X = jwtEncoding.EncodeToString(k)
+	default:
+		return nil, fmt.Errorf("jwk: unsupported key type %T", key)
+	}
+	return jwk, nil
+}
+
+// IsPrivate 是否包含私钥
+func (k *JWK) IsPrivate() bool {
+	return k.D != ""
+}
+
+// PublicJWK 去掉私有部分
+func (k *JWK) PublicJWK() *JWK {
+	pub := *k
+	pub.D, pub.P, pub.Q, pub.DP, pub.DQ, pub.QI = "", "", "", "", "", ""
+	return &pub
+}
+
+// Key 转为私钥或公钥，私钥是crypto.Signer
+func (k *JWK) Key() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		return k.rsaKey()
+	case "EC":
+		return k.ecKey()
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("jwk: unsupported curve %s", k.Crv)
+		}
+		if k.IsPrivate() {
+			seed, err := jwtEncoding.DecodeString(k.D)
+			if err != nil || len(seed) != ed25519.SeedSize {
+				return nil, errors.New("jwk: invalid Ed25519 private key")
+			}
+			return ed25519.NewKeyFromSeed(seed), nil
+		}
+		pub, err := jwtEncoding.DecodeString(k.X)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			return nil, errors.New("jwk: invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(pub), nil
+	}
+	return nil, fmt.Errorf("jwk: unsupported key type %q", k.Kty)
+}
+
+// rsaKey 转为RSA密钥
+func (k *JWK) rsaKey() (any, error) {
+	n, err := decodeInt(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := decodeInt(k.E)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsInt64() || e.Int64() > 1<<31-1 {
+		return nil, errors.New("jwk: invalid RSA exponent")
+	}
+	pub := &rsa.PublicKey{N: n, E: int(e.Int64())}
+	if !k.IsPrivate() {
+		return pub, nil
+	}
+	priv := &rsa.PrivateKey{PublicKey: *pub}
+	if priv.D, err = decodeInt(k.D); err != nil {
+		return nil, err
+	}
+	p, err := decodeInt(k.P)
+	if err != nil {
+		return nil, err
+	}
+	q, err := decodeInt(k.Q)
+	if err != nil {
+		return nil, err
+	}
+	priv.Primes = []*big.Int{p, q}
+	if err = priv.Validate(); err != nil {
+		return nil, err
+	}
+	priv.Precompute()
+	return priv, nil
+}
+
+// ecKey 转为EC密钥
+func (k *JWK) ecKey() (any, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("jwk: unsupported curve %s", k.Crv)
+	}
+	x, err := decodeInt(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeInt(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	pub := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+	if !curve.IsOnCurve(x, y) { //nolint:staticcheck
+		return nil, errors.New("jwk: point is not on curve")
+	}
+	if !k.IsPrivate() {
+		return pub, nil
+	}
+	d, err := decodeInt(k.D)
+	if err != nil {
+		return nil, err
+	}
+	if cx, cy := curve.ScalarBaseMult(d.Bytes()); cx.Cmp(x) != 0 || cy.Cmp(y) != 0 { //nolint:staticcheck
+		return nil, errors.New("jwk: private key does not match public key")
+	}
+	return &ecdsa.PrivateKey{PublicKey: *pub, D: d}, nil
+}
@@ -0,0 +1,397 @@
+package cryptogy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWT签名算法
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	ErrTokenMalformed    = errors.New("token is malformed")
+	ErrTokenSignature    = errors.New("token signature is invalid")
+	ErrTokenExpired      = errors.New("token is expired")
+	ErrTokenNoExpiry     = errors.New("token has no expiration")
+	ErrTokenNotValidYet  = errors.New("token is not valid yet")
+	ErrTokenIssuer       = errors.New("token has invalid issuer")
+	ErrTokenAudience     = errors.New("token has invalid audience")
+	ErrTokenUnverifiable = errors.New("token is unverifiable")
+
+	jwtEncoding = base64.RawURLEncoding
+)
+
+// IClaims JWT的载荷，自定义的载荷内嵌Claims即可
+type IClaims interface {
+	StandardClaims() *Claims
+}
+
+// Claims JWT的标准字段，时间为Unix秒数
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+}
+
+// StandardClaims 实现IClaims
+func (c *Claims) StandardClaims() *Claims {
+	return c
+}
+
+// Audience 受众，只有一个时输出为字符串
+type Audience []string
+
+// MarshalJSON 一个受众时输出字符串
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// UnmarshalJSON 接受字符串或字符串数组
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// jwtHeader JWT的头部
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// JWTKey 签名或校验JWT的密钥，只有公钥时只能校验
+type JWTKey struct {
+	ID      string
+	Alg     string
+	secret  *MacHash
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// NewHMACKey 创建HS256密钥
+func NewHMACKey(id string, secret []byte) *JWTKey {
+	mac := NewMacHash(sha256.New).SetKey(string(secret))
+	return &JWTKey{ID: id, Alg: AlgHS256, secret: mac}
+}
+
+// NewSignerKey 用私钥创建密钥，按私钥类型选择RS256、ES256或EdDSA
+func NewSignerKey(id string, priv crypto.Signer) (*JWTKey, error) {
+	key, err := NewVerifierKey(id, priv.Public())
+	if err == nil {
+		key.private = priv
+	}
+	return key, err
+}
+
+// NewVerifierKey 用公钥创建只能校验的密钥
+func NewVerifierKey(id string, pub crypto.PublicKey) (*JWTKey, error) {
+	key := &JWTKey{ID: id, public: pub}
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		key.Alg = AlgRS256
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("ES256 needs curve P-256, not %s", k.Curve.Params().Name)
+		}
+		key.Alg = AlgES256
+	case ed25519.PublicKey:
+		key.Alg = AlgEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+	return key, nil
+}
+
+// NewRSAKey 用RSACipher中的PEM密钥创建RS256密钥，没有私钥时只能校验
+func NewRSAKey(id string, c RSACipher) (*JWTKey, error) {
+	if c.privateKey != nil || len(c.privKey) > 0 {
+		priv, err := c.GetPrivateKey()
+		if err != nil {
+			return nil, err
+		}
+		return NewSignerKey(id, priv)
+	}
+	pub, err := c.GetPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return NewVerifierKey(id, pub)
+}
+
+// CanSign 是否可以签名
+func (k *JWTKey) CanSign() bool {
+	return k.secret != nil || k.private != nil
+}
+
+// Sign 签名
+func (k *JWTKey) Sign(data []byte) ([]byte, error) {
+	if !k.CanSign() {
+		return nil, fmt.Errorf("key %q can only verify", k.ID)
+	}
+	hashed := sha256.Sum256(data)
+	switch k.Alg {
+	case AlgHS256:
+		return k.secret.MacSum(string(data)), nil
+	case AlgRS256:
+		return k.private.Sign(rand.Reader, hashed[:], crypto.SHA256)
+	case AlgES256: // 私钥可能在HSM或KMS中，只能通过crypto.Signer签名
+		der, err := k.private.Sign(rand.Reader, hashed[:], crypto.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		var es struct{ R, S *big.Int }
+		if rest, err := asn1.Unmarshal(der, &es); err != nil {
+			return nil, err
+		} else if len(rest) > 0 || es.R.BitLen() > 256 || es.S.BitLen() > 256 {
+			return nil, errors.New("invalid ECDSA signature")
+		}
+		sig := make([]byte, 64) // r和s各32字节，不是ASN.1格式
+		es.R.FillBytes(sig[:32])
+		es.S.FillBytes(sig[32:])
+		return sig, nil
+	case AlgEdDSA:
+		return k.private.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+	return nil, fmt.Errorf("unsupported algorithm %s", k.Alg)
+}
+
+// Verify 校验签名
+func (k *JWTKey) Verify(data, sig []byte) bool {
+	hashed := sha256.Sum256(data)
+	switch k.Alg {
+	case AlgHS256:
+		return hmac.Equal(sig, k.secret.MacSum(string(data)))
+	case AlgRS256:
+		return rsa.VerifyPKCS1v15(k.public.(*rsa.PublicKey), crypto.SHA256, hashed[:], sig) == nil
+	case AlgES256:
+		if len(sig) != 64 {
+			return false
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(k.public.(*ecdsa.PublicKey), hashed[:], r, s)
+	case AlgEdDSA:
+		return ed25519.Verify(k.public.(ed25519.PublicKey), data, sig)
+	}
+	return false
+}
+
+// JWTKeySet 按kid查找的密钥集合，新签发的JWT使用当前密钥
+type JWTKeySet struct {
+	keys   map[string]*JWTKey
+	active string
+	mu     sync.RWMutex
+}
+
+// NewJWTKeySet 创建密钥集合，第一个可以签名的密钥为当前密钥
+func NewJWTKeySet(keys ...*JWTKey) *JWTKeySet {
+	s := &JWTKeySet{keys: make(map[string]*JWTKey)}
+	for _, key := range keys {
+		s.Add(key)
+	}
+	return s
+}
+
+// Add 加入密钥，同名的会被替换
+func (s *JWTKeySet) Add(key *JWTKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key.ID] = key
+	if s.active == "" && key.CanSign() {
+		s.active = key.ID
+	}
+}
+
+// Remove 删除密钥
+func (s *JWTKeySet) Remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, id)
+	if s.active == id {
+		s.active = ""
+	}
+}
+
+// SetActive 修改签名使用的密钥
+func (s *JWTKeySet) SetActive(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownKey, id)
+	} else if !key.CanSign() {
+		return fmt.Errorf("key %q can only verify", id)
+	}
+	s.active = id
+	return nil
+}
+
+// Get 按kid找到密钥
+func (s *JWTKeySet) Get(id string) *JWTKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keys[id]
+}
+
+// Active 当前签名的密钥
+func (s *JWTKeySet) Active() *JWTKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keys[s.active]
+}
+
+// JWT 签发和校验JWT
+type JWT struct {
+	Keys       *JWTKeySet
+	Issuer     string        // 签发时填入，校验时要求相同，为空时不校验
+	Audience   string        // 签发时填入，校验时要求包含，为空时不校验
+	TTL        time.Duration // 签发时没有exp则按此设置有效期
+	RequireExp bool          // 校验时要求有exp，TTL大于0时总是要求
+	Leeway     time.Duration // 校验时间时允许的时钟误差
+	Now        func() time.Time
+}
+
+// NewJWT 创建JWT签发和校验
+func NewJWT(keys *JWTKeySet) *JWT {
+	return &JWT{Keys: keys, Now: time.Now}
+}
+
+// now 当前时间
+func (j *JWT) now() time.Time {
+	if j.Now == nil {
+		return time.Now()
+	}
+	return j.Now()
+}
+
+// Sign 用当前密钥签发，填入空缺的iss、aud、iat和exp
+func (j *JWT) Sign(claims IClaims) (string, error) {
+	key := j.Keys.Active()
+	if key == nil {
+		return "", errors.New("no active key to sign")
+	}
+	std, now := claims.StandardClaims(), j.now()
+	if std.Issuer == "" {
+		std.Issuer = j.Issuer
+	}
+	if len(std.Audience) == 0 && j.Audience != "" {
+		std.Audience = Audience{j.Audience}
+	}
+	if std.IssuedAt == 0 {
+		std.IssuedAt = now.Unix()
+	}
+	if std.ExpiresAt == 0 && j.TTL > 0 {
+		std.ExpiresAt = now.Add(j.TTL).Unix()
+	}
+	head, err := json.Marshal(jwtHeader{Alg: key.Alg, Typ: "JWT", Kid: key.ID})
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signing := jwtEncoding.EncodeToString(head) + "." + jwtEncoding.EncodeToString(body)
+	sig, err := key.Sign([]byte(signing))
+	if err != nil {
+		return "", err
+	}
+	return signing + "." + jwtEncoding.EncodeToString(sig), nil
+}
+
+// Parse 校验签名和标准字段，载荷解析到claims中
+// 头部的alg需要和kid对应密钥的算法一致，不接受none
+func (j *JWT) Parse(token string, claims IClaims) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrTokenMalformed
+	}
+	var head jwtHeader
+	if err := decodeSegment(parts[0], &head); err != nil {
+		return err
+	}
+	key := j.Keys.Get(head.Kid)
+	if key == nil && head.Kid == "" {
+		key = j.Keys.Active()
+	}
+	if key == nil {
+		return fmt.Errorf("%w: %w %q", ErrTokenUnverifiable, ErrUnknownKey, head.Kid)
+	} else if head.Alg != key.Alg {
+		return fmt.Errorf("%w: algorithm %q", ErrTokenUnverifiable, head.Alg)
+	}
+	sig, err := jwtEncoding.DecodeString(parts[2])
+	if err != nil {
+		return ErrTokenMalformed
+	}
+	if !key.Verify([]byte(parts[0]+"."+parts[1]), sig) {
+		return ErrTokenSignature
+	}
+	if err = decodeSegment(parts[1], claims); err != nil {
+		return err
+	}
+	return j.Validate(claims.StandardClaims())
+}
+
+// Validate 校验exp、nbf、iss和aud
+func (j *JWT) Validate(c *Claims) error {
+	now, leeway := j.now().Unix(), int64(j.Leeway/time.Second)
+	if c.ExpiresAt == 0 && (j.RequireExp || j.TTL > 0) {
+		return ErrTokenNoExpiry
+	}
+	if c.ExpiresAt != 0 && now > c.ExpiresAt+leeway {
+		return ErrTokenExpired
+	}
+	if c.NotBefore != 0 && now < c.NotBefore-leeway {
+		return ErrTokenNotValidYet
+	}
+	if j.Issuer != "" && c.Issuer != j.Issuer {
+		return ErrTokenIssuer
+	}
+	if j.Audience != "" && !slices.Contains(c.Audience, j.Audience) {
+		return ErrTokenAudience
+	}
+	return nil
+}
+
+// decodeSegment 解码JWT的一段JSON
+func decodeSegment(seg string, v any) error {
+	data, err := jwtEncoding.DecodeString(seg)
+	if err == nil {
+		err = json.Unmarshal(data, v)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrTokenMalformed, err)
+	}
+	return nil
+}
@@ -0,0 +1,563 @@
+package cryptogy
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// 密钥类型
+const (
+	KeyTypeRSA     = "RSA"
+	KeyTypeEC      = "EC"
+	KeyTypeEd25519 = "Ed25519"
+)
+
+// PEM格式
+const (
+	KeyFormatPKCS1 = "PKCS1" // 只用于RSA
+	KeyFormatPKCS8 = "PKCS8" // 私钥的通用格式，可以加密
+	KeyFormatSEC1  = "SEC1"  // 只用于EC私钥
+	KeyFormatPKIX  = "PKIX"  // 公钥的通用格式
+)
+
+var (
+	ErrIncorrectPassphrase = errors.New("incorrect passphrase")
+
+	// PBKDF2Iterations 加密私钥时的迭代次数
+	PBKDF2Iterations = 100000
+
+	oidPBES2      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// GenerateKey 产生私钥，RSA的bits默认2048，EC的bits为256、384或521，默认256
+func GenerateKey(kind string, bits int) (crypto.Signer, error) {
+	switch strings.ToUpper(kind) {
+	case "RSA":
+		if bits == 0 {
+			bits = 2048
+		}
+		return rsa.GenerateKey(rand.Reader, bits)
+	case "EC", "ECDSA":
+		curve, err := ecCurve(bits)
+		if err != nil {
+			return nil, err
+		}
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	case "ED25519", "EDDSA":
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	}
+	return nil, fmt.Errorf("unsupported key type %q", kind)
+}
+
+// ecCurve 按位数选择椭圆曲线
+func ecCurve(bits int) (elliptic.Curve, error) {
+	switch bits {
+	case 0, 256:
+		return elliptic.P256(), nil
+	case 384:
+		return elliptic.P384(), nil
+	case 521:
+		return elliptic.P521(), nil
+	}
+	return nil, fmt.Errorf("unsupported curve size %d", bits)
+}
+
+// KeyType 密钥类型，私钥和公钥都可以
+func KeyType(key any) string {
+	switch key.(type) {
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return KeyTypeRSA
+	case *ecdsa.PrivateKey, *ecdsa.PublicKey:
+		return KeyTypeEC
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return KeyTypeEd25519
+	}
+	return ""
+}
+
+// ParsePrivateKeyPEM 解析PEM格式的私钥，支持PKCS1、SEC1、PKCS8和加密的PKCS8
+func ParsePrivateKeyPEM(data, passphrase []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("private key is not in pem format")
+	}
+	var (
+		key any
+		err error
+	)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		if x509.IsEncryptedPEMBlock(block) { //nolint:staticcheck
+			return nil, errors.New("legacy encrypted pem is not supported, use encrypted PKCS8")
+		}
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "ENCRYPTED PRIVATE KEY":
+		var der []byte
+		if der, err = decryptPKCS8(block.Bytes, passphrase); err == nil {
+			key, err = x509.ParsePKCS8PrivateKey(der)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported private key type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key %T", key)
+	}
+	return signer, nil
+}
+
+// ParsePublicKeyPEM 解析PEM格式的公钥，支持PKIX、PKCS1和证书
+func ParsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("public key is not in pem format")
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %q", block.Type)
+}
+
+// MarshalPrivateKeyPEM 输出PEM格式的私钥，有密码时只能用PKCS8格式
+func MarshalPrivateKeyPEM(key crypto.Signer, format string, passphrase []byte) ([]byte, error) {
+	if len(passphrase) > 0 && format != KeyFormatPKCS8 {
+		return nil, errors.New("only PKCS8 private key can be encrypted")
+	}
+	block := &pem.Block{}
+	var err error
+	switch format {
+	case KeyFormatPKCS1:
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("PKCS1 needs RSA key, not %T", key)
+		}
+		block.Type, block.Bytes = "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)
+	case KeyFormatSEC1:
+		ecKey, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("SEC1 needs EC key, not %T", key)
+		}
+		block.Type = "EC PRIVATE KEY"
+		block.Bytes, err = x509.MarshalECPrivateKey(ecKey)
+	case KeyFormatPKCS8:
+		block.Type = "PRIVATE KEY"
+		if block.Bytes, err = x509.MarshalPKCS8PrivateKey(key); err == nil && len(passphrase) > 0 {
+			block.Type = "ENCRYPTED PRIVATE KEY"
+			block.Bytes, err = encryptPKCS8(block.Bytes, passphrase)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported private key format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// MarshalPublicKeyPEM 输出PEM格式的公钥，格式为PKIX或PKCS1
+func MarshalPublicKeyPEM(key crypto.PublicKey, format string) ([]byte, error) {
+	block := &pem.Block{}
+	var err error
+	switch format {
+	case KeyFormatPKCS1:
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("PKCS1 needs RSA key, not %T", key)
+		}
+		block.Type, block.Bytes = "RSA PUBLIC KEY", x509.MarshalPKCS1PublicKey(rsaKey)
+	case KeyFormatPKIX, "":
+		block.Type = "PUBLIC KEY"
+		block.Bytes, err = x509.MarshalPKIXPublicKey(key)
+	default:
+		return nil, fmt.Errorf("unsupported public key format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// encryptedPrivateKeyInfo 加密的PKCS8私钥
+type encryptedPrivateKeyInfo struct {
+	Algo pkix.AlgorithmIdentifier
+	Data []byte
+}
+
+// pbes2Params PBES2的参数
+type pbes2Params struct {
+	KeyDerivation pkix.AlgorithmIdentifier
+	Encryption    pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params PBKDF2的参数
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// encryptPKCS8 用PBES2加密PKCS8私钥，即PBKDF2-HMAC-SHA256和AES-256-CBC，和openssl兼容
+func encryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	salt, iv := randBytes(16), randBytes(aes.BlockSize)
+	if salt == nil || iv == nil {
+		return nil, errors.New("failed to read random bytes")
+	}
+	key := pbkdf2.Key(passphrase, salt, PBKDF2Iterations, 32, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	data := PKCS7Padding(append([]byte{}, der...), aes.BlockSize)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	kdf, err := asn1.Marshal(pbkdf2Params{
+		Salt: salt, Iterations: PBKDF2Iterations,
+		PRF: pkix.AlgorithmIdentifier{Algorithm: oidHMACSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ivData, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivation: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdf}},
+		Encryption:    pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivData}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algo: pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		Data: data,
+	})
+}
+
+// decryptPKCS8 解密PBES2加密的PKCS8私钥，支持HMAC-SHA1/SHA256和AES-CBC
+func decryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	}
+	if !info.Algo.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported encryption %s, only PBES2", info.Algo.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algo.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	if !params.KeyDerivation.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation %s, only PBKDF2", params.KeyDerivation.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivation.Parameters.FullBytes, &kdf); err != nil {
+		return nil, err
+	}
+	prf := sha1.New
+	if kdf.PRF.Algorithm.Equal(oidHMACSHA256) {
+		prf = sha256.New
+	} else if len(kdf.PRF.Algorithm) > 0 && !kdf.PRF.Algorithm.Equal(oidHMACSHA1) {
+		return nil, fmt.Errorf("unsupported prf %s", kdf.PRF.Algorithm)
+	}
+	keyLen := 0
+	switch alg := params.Encryption.Algorithm; {
+	case alg.Equal(oidAES128CBC):
+		keyLen = 16
+	case alg.Equal(oidAES192CBC):
+		keyLen = 24
+	case alg.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, fmt.Errorf("unsupported cipher %s", alg)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.Encryption.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize || len(info.Data) == 0 || len(info.Data)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid encrypted private key")
+	}
+	block, err := aes.NewCipher(pbkdf2.Key(passphrase, kdf.Salt, kdf.Iterations, keyLen, prf))
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, len(info.Data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, info.Data)
+	padding := int(data[len(data)-1])
+	if padding == 0 || padding > aes.BlockSize ||
+		!bytes.Equal(data[len(data)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, ErrIncorrectPassphrase
+	}
+	return data[:len(data)-padding], nil
+}
+
+// KeyEntry 密钥环中的一个密钥，只有公钥时Private为空
+type KeyEntry struct {
+	ID      string
+	Private crypto.Signer
+	Public  crypto.PublicKey
+	Created time.Time
+}
+
+// Type 密钥类型
+func (e *KeyEntry) Type() string {
+	return KeyType(e.Public)
+}
+
+// RSACipher 转为使用已解析密钥的RSACipher
+func (e *KeyEntry) RSACipher() (RSACipher, error) {
+	pub, ok := e.Public.(*rsa.PublicKey)
+	if !ok {
+		return RSACipher{}, fmt.Errorf("key %q is not RSA", e.ID)
+	}
+	priv, _ := e.Private.(*rsa.PrivateKey)
+	return NewRSACipherWithKey(priv, pub), nil
+}
+
+// JWTKey 转为JWT的密钥
+func (e *KeyEntry) JWTKey() (*JWTKey, error) {
+	if e.Private != nil {
+		return NewSignerKey(e.ID, e.Private)
+	}
+	return NewVerifierKey(e.ID, e.Public)
+}
+
+// KeyRing 密钥环，解析后的密钥保存在内存中
+// 轮换时产生新的当前密钥，旧密钥保留用于校验，不再需要时删除
+type KeyRing struct {
+	entries map[string]*KeyEntry
+	active  string
+	mu      sync.RWMutex
+}
+
+// NewKeyRing 创建密钥环
+func NewKeyRing() *KeyRing {
+	return &KeyRing{entries: make(map[string]*KeyEntry)}
+}
+
+// Add 加入私钥或公钥，第一个私钥为当前密钥
+// 不替换同名密钥，需要替换时先删除，当前密钥不能删除和替换
+func (r *KeyRing) Add(id string, key any) (*KeyEntry, error) {
+	entry := &KeyEntry{ID: id, Created: time.Now()}
+	if signer, ok := key.(crypto.Signer); ok {
+		entry.Private, entry.Public = signer, signer.Public()
+	} else {
+		entry.Public = key
+	}
+	if entry.Type() == "" {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id == r.active && entry.Private == nil {
+		return nil, fmt.Errorf("cannot replace active key %q with a public-only key", id)
+	} else if _, ok := r.entries[id]; ok {
+		return nil, fmt.Errorf("key %q already exists", id)
+	}
+	r.entries[id] = entry
+	if r.active == "" && entry.Private != nil {
+		r.active = id
+	}
+	return entry, nil
+}
+
+// Generate 产生私钥并加入
+func (r *KeyRing) Generate(id, kind string, bits int) (*KeyEntry, error) {
+	key, err := GenerateKey(kind, bits)
+	if err != nil {
+		return nil, err
+	}
+	return r.Add(id, key)
+}
+
+// Rotate 产生新的私钥作为当前密钥，旧密钥保留
+func (r *KeyRing) Rotate(id, kind string, bits int) (*KeyEntry, error) {
+	entry, err := r.Generate(id, kind, bits)
+	if err == nil {
+		err = r.SetActive(id)
+	}
+	return entry, err
+}
+
+// SetActive 修改当前密钥，需要有私钥
+func (r *KeyRing) SetActive(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.entries[id]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownKey, id)
+	} else if entry.Private == nil {
+		return fmt.Errorf("key %q has no private key", id)
+	}
+	r.active = id
+	return nil
+}
+
+// Active 当前密钥
+func (r *KeyRing) Active() *KeyEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.entries[r.active]
+}
+
+// Get 按ID找到密钥
+func (r *KeyRing) Get(id string) *KeyEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.entries[id]
+}
+
+// Remove 删除密钥，不能删除当前密钥
+func (r *KeyRing) Remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id != r.active {
+		delete(r.entries, id)
+	}
+}
+
+// Entries 全部密钥，按创建时间排序
+func (r *KeyRing) Entries() []*KeyEntry {
+	r.mu.RLock()
+	result := make([]*KeyEntry, 0, len(r.entries))
+	for _, entry := range r.entries {
+		result = append(result, entry)
+	}
+	r.mu.RUnlock()
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Created.Equal(result[j].Created) {
+			return result[i].ID < result[j].ID
+		}
+		return result[i].Created.Before(result[j].Created)
+	})
+	return result
+}
+
+// ImportPEM 导入PEM格式的私钥或公钥
+func (r *KeyRing) ImportPEM(id string, data, passphrase []byte) (*KeyEntry, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("key is not in pem format")
+	}
+	var (
+		key any
+		err error
+	)
+	if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+		key, err = ParsePrivateKeyPEM(data, passphrase)
+	} else {
+		key, err = ParsePublicKeyPEM(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.Add(id, key)
+}
+
+// ExportPEM 导出PEM格式的私钥，private为假或者没有私钥时导出PKIX公钥
+func (r *KeyRing) ExportPEM(id string, private bool, format string, passphrase []byte) ([]byte, error) {
+	entry := r.Get(id)
+	if entry == nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	if private && entry.Private != nil {
+		return MarshalPrivateKeyPEM(entry.Private, format, passphrase)
+	}
+	return MarshalPublicKeyPEM(entry.Public, format)
+}
+
+// ImportJWK 导入JWK格式的私钥或公钥，ID为空时使用kid
+func (r *KeyRing) ImportJWK(id string, data []byte) (*KeyEntry, error) {
+	jwk, err := ParseJWK(data)
+	if err != nil {
+		return nil, err
+	}
+	key, err := jwk.Key()
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		id = jwk.Kid
+	}
+	return r.Add(id, key)
+}
+
+// JWKS 全部公钥的JWK集合，用于发布给校验方
+func (r *KeyRing) JWKS() (*JWKSet, error) {
+	set := &JWKSet{}
+	for _, entry := range r.Entries() {
+		jwk, err := NewJWK(entry.Public, entry.ID)
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
+
+// JWTKeySet 转为JWT的密钥集合，当前密钥用于签发
+func (r *KeyRing) JWTKeySet() (*JWTKeySet, error) {
+	set, active := NewJWTKeySet(), r.Active()
+	for _, entry := range r.Entries() {
+		key, err := entry.JWTKey()
+		if err != nil { // 跳过JWT不支持的密钥，例如P-384和P-521，当前密钥除外
+			if active != nil && entry.ID == active.ID {
+				return nil, err
+			}
+			continue
+		}
+		set.Add(key)
+	}
+	if active != nil {
+		if err := set.SetActive(active.ID); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
@@ -0,0 +1,236 @@
+package cryptogy
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSecret = errors.New("invalid otp secret")
+
+	// DefaultOTPStore NewTOTP默认使用的已用密码记录，同一进程内所有实例共享
+	DefaultOTPStore NonceStore = NewMemoryNonceStore()
+
+	otpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// GenerateOTPSecret 产生base32编码的随机密钥，size为字节数，默认20
+func GenerateOTPSecret(size int) (string, error) {
+	if size <= 0 {
+		size = 20
+	}
+	buf := randBytes(size)
+	if buf == nil {
+		return "", errors.New("failed to read random bytes")
+	}
+	return otpEncoding.EncodeToString(buf), nil
+}
+
+// OTP RFC 4226的一次性密码，HOTP和TOTP共用
+type OTP struct {
+	Secret    []byte
+	Digits    int    // 6到9位，通常为6或8位，默认6
+	Algorithm string // SHA1、SHA256或SHA512，默认SHA1
+	Issuer    string // 用于生成otpauth链接
+	Account   string
+}
+
+// NewOTP 用base32编码的密钥创建，忽略大小写、空格和补齐的等号
+func NewOTP(secret string) (*OTP, error) {
+	secret = strings.ToUpper(strings.Join(strings.Fields(secret), ""))
+	key, err := otpEncoding.DecodeString(strings.TrimRight(secret, "="))
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidSecret
+	}
+	return &OTP{Secret: key, Digits: 6, Algorithm: "SHA1"}, nil
+}
+
+// Validate 检查位数和算法，不支持的设置不能退回默认值，否则和otpauth链接中的不一致
+func (o *OTP) Validate() error {
+	if o.Digits != 0 && (o.Digits < 6 || o.Digits > 9) {
+		return fmt.Errorf("otp digits must be 6 to 9, not %d", o.Digits)
+	}
+	if o.hashFunc() == nil {
+		return fmt.Errorf("unsupported otp algorithm %q", o.Algorithm)
+	}
+	return nil
+}
+
+// digits 密码位数
+func (o *OTP) digits() int {
+	if o.Digits == 0 {
+		return 6
+	}
+	return o.Digits
+}
+
+// hashFunc 按算法名称选择哈希，不支持时返回nil
+func (o *OTP) hashFunc() NewHashFunc {
+	switch strings.ToUpper(o.Algorithm) {
+	case "", "SHA1":
+		return sha1.New
+	case "SHA256":
+		return sha256.New
+	case "SHA512":
+		return sha512.New
+	}
+	return nil
+}
+
+// Code 按计数生成密码，位数或算法不支持时返回空字符串
+func (o *OTP) Code(counter uint64) string {
+	if o.Validate() != nil {
+		return ""
+	}
+	digits := o.digits()
+	msg := binary.BigEndian.AppendUint64(nil, counter)
+	sum := NewMacHash(o.hashFunc()).SetKey(string(o.Secret)).MacSum(string(msg))
+	offset := sum[len(sum)-1] & 0x0f // 动态截断
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	code := value % uint32(math.Pow10(digits))
+	return fmt.Sprintf("%0*d", digits, code)
+}
+
+// check 校验密码，长度不同时直接失败
+func (o *OTP) check(code string, counter uint64) bool {
+	expected := o.Code(counter)
+	if expected == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(code), []byte(expected)) == 1
+}
+
+// URI 生成otpauth链接，用于生成二维码，typ为hotp或totp
+func (o *OTP) URI(typ string, params url.Values) (string, error) {
+	if err := o.Validate(); err != nil {
+		return "", err
+	}
+	label := url.PathEscape(o.Account)
+	if o.Issuer != "" {
+		label = url.PathEscape(o.Issuer) + ":" + label
+		params.Set("issuer", o.Issuer)
+	}
+	params.Set("secret", otpEncoding.EncodeToString(o.Secret))
+	if o.Algorithm != "" {
+		params.Set("algorithm", strings.ToUpper(o.Algorithm))
+	}
+	params.Set("digits", strconv.Itoa(o.digits()))
+	query := strings.ReplaceAll(params.Encode(), "+", "%20")
+	return "otpauth://" + typ + "/" + label + "?" + query, nil
+}
+
+// HOTP RFC 4226基于计数的一次性密码
+type HOTP struct {
+	*OTP
+	LookAhead int // 校验时向后查找的计数，用于重新同步
+}
+
+// NewHOTP 创建HOTP，默认向后查找10个
+func NewHOTP(secret string) (*HOTP, error) {
+	o, err := NewOTP(secret)
+	if err != nil {
+		return nil, err
+	}
+	return &HOTP{OTP: o, LookAhead: 10}, nil
+}
+
+// Verify 从counter开始校验，成功时返回下一个计数，需要保存
+func (h *HOTP) Verify(code string, counter uint64) (uint64, bool) {
+	for i := 0; i <= max(h.LookAhead, 0); i++ {
+		if h.check(code, counter+uint64(i)) {
+			return counter + uint64(i) + 1, true
+		}
+	}
+	return counter, false
+}
+
+// URI 生成otpauth://hotp链接
+func (h *HOTP) URI(counter uint64) (string, error) {
+	return h.OTP.URI("hotp", url.Values{"counter": {strconv.FormatUint(counter, 10)}})
+}
+
+// TOTP RFC 6238基于时间的一次性密码
+// 设置Used时同一个密码在有效期内只能使用一次，多个进程时应使用RedisNonceStore
+type TOTP struct {
+	*OTP
+	Period int // 时间步长，单位秒，默认30
+	Skew   int // 允许前后偏差的步数，默认1
+	Used   NonceStore
+	Now    func() time.Time
+}
+
+// NewTOTP 创建TOTP，使用共享的DefaultOTPStore记录已经使用的密码
+func NewTOTP(secret string) (*TOTP, error) {
+	o, err := NewOTP(secret)
+	if err != nil {
+		return nil, err
+	}
+	return &TOTP{OTP: o, Period: 30, Skew: 1, Used: DefaultOTPStore, Now: time.Now}, nil
+}
+
+// period 时间步长
+func (t *TOTP) period() int64 {
+	if t.Period <= 0 {
+		return 30
+	}
+	return int64(t.Period)
+}
+
+// counter 时间对应的计数
+func (t *TOTP) counter(at time.Time) uint64 {
+	return uint64(at.Unix() / t.period())
+}
+
+// now 当前时间
+func (t *TOTP) now() time.Time {
+	if t.Now == nil {
+		return time.Now()
+	}
+	return t.Now()
+}
+
+// At 生成指定时间的密码
+func (t *TOTP) At(at time.Time) string {
+	return t.Code(t.counter(at))
+}
+
+// Generate 生成当前的密码
+func (t *TOTP) Generate() string {
+	return t.At(t.now())
+}
+
+// Verify 校验当前的密码，允许前后Skew步的时钟偏差
+func (t *TOTP) Verify(code string) bool {
+	current := t.counter(t.now())
+	for i := -t.Skew; i <= t.Skew; i++ {
+		if i < 0 && current < uint64(-i) {
+			continue
+		}
+		counter := current + uint64(i)
+		if !t.check(code, counter) {
+			continue
+		}
+		if t.Used == nil {
+			return true
+		}
+		ttl := time.Duration(t.period()*int64(2*t.Skew+1)) * time.Second
+		return t.Used.Use(Md5Sum(string(t.Secret))+":"+strconv.FormatUint(counter, 10), ttl)
+	}
+	return false
+}
+
+// URI 生成otpauth://totp链接
+func (t *TOTP) URI() (string, error) {
+	return t.OTP.URI("totp", url.Values{"period": {strconv.FormatInt(t.period(), 10)}})
+}
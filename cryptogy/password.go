@@ -0,0 +1,301 @@
+package cryptogy
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// 密码哈希的算法标识，即PHC格式 $id$... 中的id
+const (
+	Argon2idID = "argon2id"
+	BcryptID   = "2a"
+	ScryptID   = "scrypt"
+)
+
+// 校验时哈希中记录的参数上限，防止篡改的哈希耗尽内存和CPU
+const (
+	MaxArgon2Memory  = 1024 * 1024 // 单位KB，即1GB
+	MaxArgon2Time    = 16
+	MaxArgon2Threads = 16
+	MaxBcryptCost    = 16
+	MaxScryptLogN    = 20
+	MaxScryptR       = 32
+	MaxScryptP       = 16
+)
+
+var (
+	ErrInvalidHash = errors.New("invalid password hash")
+
+	phcEncoding = base64.RawStdEncoding
+	cipherMutex sync.RWMutex
+	cipherTable = map[string]ICipher{}
+)
+
+// IRehasher 可选接口，判断密码哈希的参数是否已经过时
+type IRehasher interface {
+	NeedsRehash(cipherText string) bool
+}
+
+func init() {
+	RegisterCipher(NewArgon2Cipher(0, 0, 0), Argon2idID)
+	RegisterCipher(NewBcryptCipher(0), BcryptID, "2b", "2y")
+	RegisterCipher(NewScryptCipher(0, 0, 0), ScryptID)
+}
+
+// RegisterCipher 按算法标识注册密码算法，已有的同名算法会被替换
+func RegisterCipher(c ICipher, ids ...string) {
+	cipherMutex.Lock()
+	defer cipherMutex.Unlock()
+	for _, id := range ids {
+		cipherTable[id] = c
+	}
+}
+
+// GetCipher 按算法标识找到密码算法
+func GetCipher(id string) ICipher {
+	cipherMutex.RLock()
+	defer cipherMutex.RUnlock()
+	return cipherTable[id]
+}
+
+// HashID 密码哈希的算法标识，不是 $id$ 开头时为空，即旧的salt$hash格式
+func HashID(cipherText string) string {
+	if !strings.HasPrefix(cipherText, "$") {
+		return ""
+	}
+	id, _, _ := strings.Cut(cipherText[1:], "$")
+	return id
+}
+
+// FindCipher 找到可以校验这个密码哈希的算法，旧格式使用SaltPassword
+func FindCipher(cipherText string) ICipher {
+	id := HashID(cipherText)
+	if id == "" {
+		return Cipher()
+	}
+	return GetCipher(id)
+}
+
+// randBytes 产生随机字节
+func randBytes(size int) []byte {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return nil
+	}
+	return buf
+}
+
+// phcHash 解析后的PHC格式 $id[$v=version][$k=v,...]$salt$hash
+type phcHash struct {
+	id      string
+	version int
+	params  map[string]int
+	salt    []byte
+	hash    []byte
+}
+
+// parsePHC 解析PHC格式的密码哈希，参数只支持整数
+func parsePHC(cipherText, id string) (*phcHash, error) {
+	parts := strings.Split(cipherText, "$")
+	if len(parts) < 4 || parts[0] != "" || parts[1] != id {
+		return nil, ErrInvalidHash
+	}
+	var err error
+	h := &phcHash{id: id, params: make(map[string]int)}
+	fields := parts[2 : len(parts)-2]
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "v=") {
+		if h.version, err = strconv.Atoi(fields[0][2:]); err != nil {
+			return nil, ErrInvalidHash
+		}
+		fields = fields[1:]
+	}
+	if len(fields) > 1 {
+		return nil, ErrInvalidHash
+	}
+	if len(fields) == 1 {
+		for _, pair := range strings.Split(fields[0], ",") {
+			key, value, _ := strings.Cut(pair, "=")
+			if h.params[key], err = strconv.Atoi(value); err != nil {
+				return nil, ErrInvalidHash
+			}
+		}
+	}
+	if h.salt, err = phcEncoding.DecodeString(parts[len(parts)-2]); err != nil {
+		return nil, ErrInvalidHash
+	}
+	if h.hash, err = phcEncoding.DecodeString(parts[len(parts)-1]); err != nil {
+		return nil, ErrInvalidHash
+	}
+	return h, nil
+}
+
+// Argon2Cipher 使用argon2id的密码哈希，推荐用于新密码
+type Argon2Cipher struct {
+	Memory  uint32 // 单位KB
+	Time    uint32
+	Threads uint8
+	SaltLen int
+	KeyLen  uint32
+}
+
+// NewArgon2Cipher 参数为0时使用RFC 9106推荐的 m=64MB,t=3,p=4
+func NewArgon2Cipher(memory, time uint32, threads uint8) *Argon2Cipher {
+	c := &Argon2Cipher{Memory: memory, Time: time, Threads: threads, SaltLen: 16, KeyLen: 32}
+	if c.Memory == 0 {
+		c.Memory = 64 * 1024
+	}
+	if c.Time == 0 {
+		c.Time = 3
+	}
+	if c.Threads == 0 {
+		c.Threads = 4
+	}
+	return c
+}
+
+// CreatePassword 设置密码，格式为 $argon2id$v=19$m=65536,t=3,p=4$salt$hash
+func (c *Argon2Cipher) CreatePassword(plainText string) string {
+	salt := randBytes(c.SaltLen)
+	if salt == nil {
+		return ""
+	}
+	hash := argon2.IDKey([]byte(plainText), salt, c.Time, c.Memory, c.Threads, c.KeyLen)
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", Argon2idID, argon2.Version,
+		c.Memory, c.Time, c.Threads, phcEncoding.EncodeToString(salt), phcEncoding.EncodeToString(hash))
+}
+
+// VerifyPassword 校验密码，使用哈希中记录的参数
+func (c *Argon2Cipher) VerifyPassword(plainText, cipherText string) bool {
+	h, err := parsePHC(cipherText, Argon2idID)
+	if err != nil || h.version != argon2.Version || len(h.hash) == 0 {
+		return false
+	}
+	m, t, p := h.params["m"], h.params["t"], h.params["p"]
+	if m <= 0 || m > MaxArgon2Memory || t <= 0 || t > MaxArgon2Time ||
+		p <= 0 || p > MaxArgon2Threads {
+		return false
+	}
+	hash := argon2.IDKey([]byte(plainText), h.salt, uint32(t), uint32(m), uint8(p), uint32(len(h.hash)))
+	return subtle.ConstantTimeCompare(hash, h.hash) == 1
+}
+
+// NeedsRehash 参数和当前设置不同时需要重新哈希
+func (c *Argon2Cipher) NeedsRehash(cipherText string) bool {
+	h, err := parsePHC(cipherText, Argon2idID)
+	if err != nil {
+		return true
+	}
+	return h.version != argon2.Version || h.params["m"] != int(c.Memory) ||
+		h.params["t"] != int(c.Time) || h.params["p"] != int(c.Threads) ||
+		len(h.salt) < c.SaltLen || len(h.hash) != int(c.KeyLen)
+}
+
+// BcryptCipher 使用bcrypt的密码哈希，密码最长72字节
+type BcryptCipher struct {
+	Cost int
+}
+
+// NewBcryptCipher cost为0时使用12
+func NewBcryptCipher(cost int) *BcryptCipher {
+	if cost == 0 {
+		cost = 12
+	}
+	return &BcryptCipher{Cost: cost}
+}
+
+// CreatePassword 设置密码，格式为 $2a$12$saltAndHash，密码超长时返回空字符串
+func (c *BcryptCipher) CreatePassword(plainText string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plainText), c.Cost)
+	if err != nil {
+		return ""
+	}
+	return string(hash)
+}
+
+// VerifyPassword 校验密码
+func (c *BcryptCipher) VerifyPassword(plainText, cipherText string) bool {
+	cost, err := bcrypt.Cost([]byte(cipherText))
+	if err != nil || cost > MaxBcryptCost {
+		return false
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(cipherText), []byte(plainText))
+	return err == nil
+}
+
+// NeedsRehash 强度和当前设置不同时需要重新哈希
+func (c *BcryptCipher) NeedsRehash(cipherText string) bool {
+	cost, err := bcrypt.Cost([]byte(cipherText))
+	return err != nil || cost != c.Cost
+}
+
+// ScryptCipher 使用scrypt的密码哈希
+type ScryptCipher struct {
+	LogN    int // N = 2^LogN
+	R, P    int
+	SaltLen int
+	KeyLen  int
+}
+
+// NewScryptCipher 参数为0时使用 N=2^15,r=8,p=1
+func NewScryptCipher(logN, r, p int) *ScryptCipher {
+	c := &ScryptCipher{LogN: logN, R: r, P: p, SaltLen: 16, KeyLen: 32}
+	if c.LogN == 0 {
+		c.LogN = 15
+	}
+	if c.R == 0 {
+		c.R = 8
+	}
+	if c.P == 0 {
+		c.P = 1
+	}
+	return c
+}
+
+// CreatePassword 设置密码，格式为 $scrypt$ln=15,r=8,p=1$salt$hash
+func (c *ScryptCipher) CreatePassword(plainText string) string {
+	salt := randBytes(c.SaltLen)
+	if salt == nil {
+		return ""
+	}
+	hash, err := scrypt.Key([]byte(plainText), salt, 1<<c.LogN, c.R, c.P, c.KeyLen)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("$%s$ln=%d,r=%d,p=%d$%s$%s", ScryptID, c.LogN, c.R, c.P,
+		phcEncoding.EncodeToString(salt), phcEncoding.EncodeToString(hash))
+}
+
+// VerifyPassword 校验密码，使用哈希中记录的参数
+func (c *ScryptCipher) VerifyPassword(plainText, cipherText string) bool {
+	h, err := parsePHC(cipherText, ScryptID)
+	if err != nil || len(h.hash) == 0 {
+		return false
+	}
+	ln, r, p := h.params["ln"], h.params["r"], h.params["p"]
+	if ln <= 0 || ln > MaxScryptLogN || r <= 0 || r > MaxScryptR ||
+		p <= 0 || p > MaxScryptP {
+		return false
+	}
+	hash, err := scrypt.Key([]byte(plainText), h.salt, 1<<ln, r, p, len(h.hash))
+	return err == nil && subtle.ConstantTimeCompare(hash, h.hash) == 1
+}
+
+// NeedsRehash 参数和当前设置不同时需要重新哈希
+func (c *ScryptCipher) NeedsRehash(cipherText string) bool {
+	h, err := parsePHC(cipherText, ScryptID)
+	if err != nil {
+		return true
+	}
+	return h.params["ln"] != c.LogN || h.params["r"] != c.R || h.params["p"] != c.P ||
+		len(h.salt) < c.SaltLen || len(h.hash) != c.KeyLen
+}
@@ -4,10 +4,11 @@ import (
 	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
-	"crypto/x509"
+	_ "crypto/sha512" // 注册SHA384和SHA512
+	"encoding/binary"
 	"encoding/pem"
 	"errors"
+	"fmt"
 )
 
 /*
@@ -86,14 +87,29 @@ UqWHmhg2z2Itx8B0m9cORIsCAwEAAQ==
 `
 */
 
-// RSA加密，支持模式PKCS#1 v1.5，不支持OAEP/PSS
+// RSA加密，支持PKCS#1 v1.5和OAEP加密，PKCS#1 v1.5和PSS签名
+// 超过密钥长度的数据使用EncryptHybrid，即RSA-OAEP包装随机的AES密钥
 // 用法: NewRSACipher(privKey, pubKey).Sign(crypto.SHA256, []byte("hello world"))
+// 创建时解析密钥并缓存，解析失败的在使用时返回错误
 type RSACipher struct {
 	privKey, pubKey []byte
+	privateKey      *rsa.PrivateKey
+	publicKey       *rsa.PublicKey
 }
 
 func NewRSACipher(privKey, pubKey string) RSACipher {
-	return RSACipher{privKey: []byte(privKey), pubKey: []byte(pubKey)}
+	c := RSACipher{privKey: []byte(privKey), pubKey: []byte(pubKey)}
+	c.privateKey, _ = c.GetPrivateKey()
+	c.publicKey, _ = c.GetPublicKey()
+	return c
+}
+
+// NewRSACipherWithKey 使用已解析的密钥，没有私钥时只能加密和校验
+func NewRSACipherWithKey(priv *rsa.PrivateKey, pub *rsa.PublicKey) RSACipher {
+	if pub == nil && priv != nil {
+		pub = &priv.PublicKey
+	}
+	return RSACipher{privateKey: priv, publicKey: pub}
 }
 
 // 解密pem格式的公钥/私钥
@@ -107,29 +123,43 @@ func (c RSACipher) GetBlock(key []byte, errmsg string) (*pem.Block, error) {
 }
 
 func (c RSACipher) GetPublicKey() (*rsa.PublicKey, error) {
-	block, err := c.GetBlock(c.pubKey, "public key error !")
-	if err != nil {
+	if c.publicKey != nil {
+		return c.publicKey, nil
+	} else if len(c.pubKey) == 0 && c.privateKey != nil {
+		return &c.privateKey.PublicKey, nil
+	}
+	if _, err := c.GetBlock(c.pubKey, "public key error !"); err != nil {
 		return nil, err
 	}
-	// 解析公钥
-	face, err := x509.ParsePKIXPublicKey(block.Bytes)
+	// 解析PKIX或PKCS1格式的公钥
+	face, err := ParsePublicKeyPEM(c.pubKey)
 	if err != nil {
 		return nil, err
 	}
 	// 类型断言
-	return face.(*rsa.PublicKey), nil
+	key, ok := face.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not RSA")
+	}
+	return key, nil
 }
 
 func (c RSACipher) GetPrivateKey() (*rsa.PrivateKey, error) {
-	block, err := c.GetBlock(c.privKey, "private key error!")
-	if err != nil {
+	if c.privateKey != nil {
+		return c.privateKey, nil
+	}
+	if _, err := c.GetBlock(c.privKey, "private key error!"); err != nil {
 		return nil, err
 	}
-	// 解析PKCS1格式的私钥
-	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	// 解析PKCS1或PKCS8格式的私钥
+	face, err := ParsePrivateKeyPEM(c.privKey, nil)
 	if err != nil {
 		return nil, err
 	}
+	key, ok := face.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not RSA")
+	}
 	return key, nil
 }
 
@@ -151,22 +181,134 @@ func (c RSACipher) Decrypt(cipherText []byte) ([]byte, error) {
 	return rsa.DecryptPKCS1v15(rand.Reader, key, cipherText)
 }
 
-// 签名
+// OAEP加密，hash同时用于MGF1，label可以为空，解密时需要相同
+func (c RSACipher) EncryptOAEP(hash crypto.Hash, origData, label []byte) ([]byte, error) {
+	key, err := c.GetPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if !hash.Available() {
+		return nil, fmt.Errorf("hash %s is unavailable", hash)
+	}
+	return rsa.EncryptOAEP(hash.New(), rand.Reader, key, origData, label)
+}
+
+// OAEP解密
+func (c RSACipher) DecryptOAEP(hash crypto.Hash, cipherText, label []byte) ([]byte, error) {
+	key, err := c.GetPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	if !hash.Available() {
+		return nil, fmt.Errorf("hash %s is unavailable", hash)
+	}
+	return rsa.DecryptOAEP(hash.New(), rand.Reader, key, cipherText, label)
+}
+
+// 混合加密任意长度的数据，随机的AES-256密钥用RSA-OAEP-SHA256包装，数据用AES-GCM加密
+// 输出为 包装密钥的长度(2字节) + 包装的密钥 + nonce + 密文
+func (c RSACipher) EncryptHybrid(origData []byte) ([]byte, error) {
+	secret := randBytes(32)
+	if secret == nil {
+		return nil, errors.New("failed to read random bytes")
+	}
+	wrapped, err := c.EncryptOAEP(crypto.SHA256, secret, nil)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := NewAEADCipher("GCM", secret)
+	if err != nil {
+		return nil, err
+	}
+	head := binary.BigEndian.AppendUint16(nil, uint16(len(wrapped)))
+	head = append(head, wrapped...)
+	sealed, err := aead.SealData(origData, head) // 包装的密钥参与认证
+	if err != nil {
+		return nil, err
+	}
+	return append(head, sealed...), nil
+}
+
+// 混合解密
+func (c RSACipher) DecryptHybrid(cipherText []byte) ([]byte, error) {
+	if len(cipherText) < 2 {
+		return nil, ErrCipherTooShort
+	}
+	size := 2 + int(binary.BigEndian.Uint16(cipherText))
+	if len(cipherText) < size {
+		return nil, ErrCipherTooShort
+	}
+	secret, err := c.DecryptOAEP(crypto.SHA256, cipherText[2:size], nil)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := NewAEADCipher("GCM", secret)
+	if err != nil {
+		return nil, err
+	}
+	return aead.OpenData(cipherText[size:], cipherText[:size])
+}
+
+// hashMessage 计算消息的哈希值
+func hashMessage(hash crypto.Hash, msg []byte) ([]byte, error) {
+	if !hash.Available() {
+		return nil, fmt.Errorf("hash %s is unavailable", hash)
+	}
+	h := hash.New()
+	h.Write(msg)
+	return h.Sum(nil), nil
+}
+
+// 签名，PKCS#1 v1.5
 func (c RSACipher) Sign(hash crypto.Hash, msg []byte) ([]byte, error) {
 	key, err := c.GetPrivateKey()
 	if err != nil {
 		return nil, err
 	}
-	hashed := sha256.Sum256(msg)
-	return rsa.SignPKCS1v15(rand.Reader, key, hash, hashed[:])
+	hashed, err := hashMessage(hash, msg)
+	if err != nil {
+		return nil, err
+	}
+	return rsa.SignPKCS1v15(rand.Reader, key, hash, hashed)
 }
 
-// 校验
+// 校验，PKCS#1 v1.5
 func (c RSACipher) Verify(hash crypto.Hash, msg, sig []byte) error {
 	key, err := c.GetPublicKey()
 	if err != nil {
 		return err
 	}
-	hashed := sha256.Sum256(msg)
-	return rsa.VerifyPKCS1v15(key, hash, hashed[:], sig)
+	hashed, err := hashMessage(hash, msg)
+	if err != nil {
+		return err
+	}
+	return rsa.VerifyPKCS1v15(key, hash, hashed, sig)
+}
+
+// PSS签名，salt长度等于哈希长度
+func (c RSACipher) SignPSS(hash crypto.Hash, msg []byte) ([]byte, error) {
+	key, err := c.GetPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	hashed, err := hashMessage(hash, msg)
+	if err != nil {
+		return nil, err
+	}
+	opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+	return rsa.SignPSS(rand.Reader, key, hash, hashed, opts)
+}
+
+// PSS校验，自动识别salt长度
+func (c RSACipher) VerifyPSS(hash crypto.Hash, msg, sig []byte) error {
+	key, err := c.GetPublicKey()
+	if err != nil {
+		return err
+	}
+	hashed, err := hashMessage(hash, msg)
+	if err != nil {
+		return err
+	}
+	opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto}
+	return rsa.VerifyPSS(key, hash, hashed, sig, opts)
 }
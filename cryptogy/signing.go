@@ -0,0 +1,382 @@
+package cryptogy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/azhai/gozzo/cache"
+)
+
+// 请求签名的算法名称和签名链接的参数名
+const (
+	SignatureScheme = "HMAC-SHA256"
+
+	URLParamKeyID     = "key_id"
+	URLParamExpires   = "expires"
+	URLParamSignature = "signature"
+)
+
+var (
+	ErrSignatureMissing = errors.New("signature is missing")
+	ErrSignatureInvalid = errors.New("signature is invalid")
+	ErrSignatureExpired = errors.New("signature is expired")
+	ErrNonceReused      = errors.New("nonce has been used")
+	ErrBodyTooLarge     = errors.New("request body too large")
+)
+
+// NonceStore 记录用过的nonce，用于防止重放
+type NonceStore interface {
+	// Use 记录nonce并保留ttl时间，已经用过或者出错时返回假
+	Use(nonce string, ttl time.Duration) bool
+}
+
+// MemoryNonceStore 保存在内存中的nonce，只适用于单个进程
+type MemoryNonceStore struct {
+	seen   map[string]time.Time
+	purged time.Time
+	mu     sync.Mutex
+}
+
+// NewMemoryNonceStore 创建内存中的nonce记录
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{seen: make(map[string]time.Time)}
+}
+
+// Use 实现NonceStore，定期清理过期的nonce
+func (m *MemoryNonceStore) Use(nonce string, ttl time.Duration) bool {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.purged) > ttl {
+		for key, expire := range m.seen {
+			if now.After(expire) {
+				delete(m.seen, key)
+			}
+		}
+		m.purged = now
+	}
+	if expire, ok := m.seen[nonce]; ok && now.Before(expire) {
+		return false
+	}
+	m.seen[nonce] = now.Add(ttl)
+	return true
+}
+
+// RedisNonceStore 保存在redis无序集合中的nonce，按时间分段，每段集合自动过期
+type RedisNonceStore struct {
+	ctx    context.Context
+	prefix string
+}
+
+// NewRedisNonceStore 创建redis中的nonce记录，prefix为集合键名的前缀
+func NewRedisNonceStore(ctx context.Context, prefix string) *RedisNonceStore {
+	return &RedisNonceStore{ctx: ctx, prefix: prefix}
+}
+
+// Use 实现NonceStore，同时检查上一段，redis出错时返回假
+func (r *RedisNonceStore) Use(nonce string, ttl time.Duration) bool {
+	secs := max(int(ttl/time.Second), 1)
+	bucket := time.Now().Unix() / int64(secs)
+	name := func(n int64) string {
+		return r.prefix + ":" + strconv.FormatInt(n, 10)
+	}
+	if cache.NewRedisSet(r.ctx, name(bucket-1), secs*2).IsMember(nonce) {
+		return false
+	}
+	return cache.NewRedisSet(r.ctx, name(bucket), secs*2).Add(nonce) == 1
+}
+
+// RequestSigner 给请求签名，签名放在Authorization请求头中，格式为
+// HMAC-SHA256 key_id="...",timestamp="...",nonce="...",headers="host;content-type",signature="..."
+type RequestSigner struct {
+	KeyID   string
+	Secret  string
+	Headers []string // 参与签名的请求头，默认为host和content-type
+	Now     func() time.Time
+}
+
+// NewRequestSigner 创建请求签名
+func NewRequestSigner(keyID, secret string, headers ...string) *RequestSigner {
+	if len(headers) == 0 {
+		headers = []string{"host", "content-type"}
+	}
+	return &RequestSigner{KeyID: keyID, Secret: secret, Headers: headers, Now: time.Now}
+}
+
+// now 当前时间
+func (s *RequestSigner) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
+	}
+	return s.Now()
+}
+
+// Sign 读取请求体计算哈希后放回，给请求加上签名
+func (s *RequestSigner) Sign(req *http.Request) error {
+	bodyHash, err := hashBody(req, 0)
+	if err != nil {
+		return err
+	}
+	headers := make([]string, len(s.Headers))
+	for i, name := range s.Headers {
+		headers[i] = strings.ToLower(name)
+	}
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+	nonce := RandSalt(32)
+	canonical := CanonicalRequest(req, headers, bodyHash)
+	sig := signString(s.Secret, stringToSign(s.KeyID, timestamp, nonce, canonical))
+	req.Header.Set("Authorization", fmt.Sprintf(`%s key_id="%s",timestamp="%s",nonce="%s",headers="%s",signature="%s"`,
+		SignatureScheme, s.KeyID, timestamp, nonce, strings.Join(headers, ";"), sig))
+	return nil
+}
+
+// SignURL 生成有效期内可以重复使用的签名链接，用于下载等GET请求
+func (s *RequestSigner) SignURL(rawURL string, expires time.Duration) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Del(URLParamSignature)
+	query.Set(URLParamKeyID, s.KeyID)
+	query.Set(URLParamExpires, strconv.FormatInt(s.now().Add(expires).Unix(), 10))
+	u.RawQuery = query.Encode()
+	canonical := http.MethodGet + "\n" + canonicalPath(u) + "\n" + canonicalQuery(query)
+	query.Set(URLParamSignature, signString(s.Secret, canonical))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// RequestVerifier 校验请求签名，时间戳需要在MaxSkew之内，nonce不能重复使用
+type RequestVerifier struct {
+	Keys            map[string]string // 密钥ID到密钥
+	MaxSkew         time.Duration
+	RequiredHeaders []string // 必须参与签名的请求头
+	MaxBodySize     int64    // 读取请求体的上限，不大于0时不限制
+	Nonces          NonceStore
+	Now             func() time.Time
+}
+
+// NewRequestVerifier 创建请求校验，nonces为空时使用内存记录
+// 默认host和content-type必须参与签名，请求体最多读取10MB
+func NewRequestVerifier(keys map[string]string, nonces NonceStore) *RequestVerifier {
+	if nonces == nil {
+		nonces = NewMemoryNonceStore()
+	}
+	return &RequestVerifier{
+		Keys: keys, MaxSkew: 5 * time.Minute, RequiredHeaders: []string{"host", "content-type"},
+		MaxBodySize: 10 << 20, Nonces: nonces, Now: time.Now,
+	}
+}
+
+// now 当前时间
+func (v *RequestVerifier) now() time.Time {
+	if v.Now == nil {
+		return time.Now()
+	}
+	return v.Now()
+}
+
+// secret 按密钥ID找到密钥
+func (v *RequestVerifier) secret(keyID string) (string, error) {
+	secret, ok := v.Keys[keyID]
+	if !ok || keyID == "" {
+		return "", fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	return secret, nil
+}
+
+// hasRequired 签名的请求头是否包含了所有必须的请求头
+func (v *RequestVerifier) hasRequired(headers []string) bool {
+	for _, required := range v.RequiredHeaders {
+		required = strings.ToLower(strings.TrimSpace(required))
+		found := false
+		for _, name := range headers {
+			if strings.ToLower(strings.TrimSpace(name)) == required {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Verify 校验请求的签名，返回密钥ID，请求体读取后会放回
+func (v *RequestVerifier) Verify(req *http.Request) (string, error) {
+	scheme, params, _ := strings.Cut(req.Header.Get("Authorization"), " ")
+	if scheme != SignatureScheme {
+		return "", ErrSignatureMissing
+	}
+	fields := parseAuthParams(params)
+	keyID, timestamp, nonce := fields["key_id"], fields["timestamp"], fields["nonce"]
+	if timestamp == "" || nonce == "" || fields["signature"] == "" {
+		return keyID, ErrSignatureMissing
+	}
+	secret, err := v.secret(keyID)
+	if err != nil {
+		return keyID, err
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return keyID, ErrSignatureInvalid
+	}
+	skew := v.now().Sub(time.Unix(ts, 0))
+	if skew > v.MaxSkew || skew < -v.MaxSkew {
+		return keyID, ErrSignatureExpired
+	}
+	headers := strings.Split(fields["headers"], ";")
+	if !v.hasRequired(headers) {
+		return keyID, ErrSignatureInvalid
+	}
+	bodyHash, err := hashBody(req, v.MaxBodySize)
+	if err != nil {
+		return keyID, err
+	}
+	canonical := CanonicalRequest(req, headers, bodyHash)
+	if !verifyString(secret, stringToSign(keyID, timestamp, nonce, canonical), fields["signature"]) {
+		return keyID, ErrSignatureInvalid
+	}
+	if !v.Nonces.Use(keyID+":"+nonce, 2*v.MaxSkew) { // 签名正确后再记录nonce
+		return keyID, ErrNonceReused
+	}
+	return keyID, nil
+}
+
+// VerifyURL 校验签名链接，返回密钥ID
+func (v *RequestVerifier) VerifyURL(u *url.URL) (string, error) {
+	query := u.Query()
+	keyID, sig := query.Get(URLParamKeyID), query.Get(URLParamSignature)
+	if sig == "" {
+		return keyID, ErrSignatureMissing
+	}
+	secret, err := v.secret(keyID)
+	if err != nil {
+		return keyID, err
+	}
+	expires, err := strconv.ParseInt(query.Get(URLParamExpires), 10, 64)
+	if err != nil {
+		return keyID, ErrSignatureInvalid
+	}
+	query.Del(URLParamSignature)
+	canonical := http.MethodGet + "\n" + canonicalPath(u) + "\n" + canonicalQuery(query)
+	if !verifyString(secret, canonical, sig) {
+		return keyID, ErrSignatureInvalid
+	}
+	if v.now().Unix() > expires {
+		return keyID, ErrSignatureExpired
+	}
+	return keyID, nil
+}
+
+// CanonicalRequest 规范化的请求，依次为方法、路径、排序的查询参数、请求头和请求体哈希，用换行分隔
+func CanonicalRequest(req *http.Request, headers []string, bodyHash string) string {
+	var buf strings.Builder
+	buf.WriteString(strings.ToUpper(req.Method) + "\n")
+	buf.WriteString(canonicalPath(req.URL) + "\n")
+	buf.WriteString(canonicalQuery(req.URL.Query()) + "\n")
+	for _, name := range headers {
+		if name = strings.ToLower(strings.TrimSpace(name)); name == "" {
+			continue
+		}
+		value := req.Header.Get(name)
+		if name == "host" {
+			if value = req.Host; value == "" {
+				value = req.URL.Host
+			}
+		}
+		buf.WriteString(name + ":" + strings.Join(strings.Fields(value), " ") + "\n")
+	}
+	buf.WriteString(strings.Join(headers, ";") + "\n")
+	buf.WriteString(bodyHash)
+	return buf.String()
+}
+
+// canonicalPath 转义后的路径，为空时是 /
+func canonicalPath(u *url.URL) string {
+	if path := u.EscapedPath(); path != "" {
+		return path
+	}
+	return "/"
+}
+
+// canonicalQuery 按名称和值排序的查询参数，空格编码为%20
+func canonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, queryEscape(key)+"="+queryEscape(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// queryEscape 按RFC 3986转义
+func queryEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// hashBody 请求体的sha256哈希，读取后放回请求中，limit大于0时超过limit字节返回错误
+func hashBody(req *http.Request, limit int64) (string, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		reader := io.Reader(req.Body)
+		if limit > 0 {
+			reader = io.LimitReader(req.Body, limit+1)
+		}
+		if body, err = io.ReadAll(reader); err != nil {
+			return "", err
+		}
+		_ = req.Body.Close()
+		if limit > 0 && int64(len(body)) > limit {
+			return "", ErrBodyTooLarge
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// stringToSign 签名的内容
+func stringToSign(keyID, timestamp, nonce, canonical string) string {
+	sum := sha256.Sum256([]byte(canonical))
+	return strings.Join([]string{SignatureScheme, keyID, timestamp, nonce, hex.EncodeToString(sum[:])}, "\n")
+}
+
+// signString HMAC-SHA256签名
+func signString(secret, text string) string {
+	return NewMacHash(sha256.New).SetKey(secret).Sign(text)
+}
+
+// verifyString 校验HMAC-SHA256签名
+func verifyString(secret, text, sig string) bool {
+	return NewMacHash(sha256.New).SetKey(secret).Verify(text, sig)
+}
+
+// parseAuthParams 解析 k="v",k2="v2" 格式的参数
+func parseAuthParams(params string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(params, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok {
+			result[key] = strings.Trim(value, `"`)
+		}
+	}
+	return result
+}
@@ -3,6 +3,7 @@ package cryptogy
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"fmt"
 	"strings"
 	"time"
 
@@ -10,7 +11,7 @@ import (
 )
 
 var (
-	ciper      = Cipher()
+	defaultID  = Argon2idID // 新密码使用的算法
 	saltPasswd ICipher
 )
 
@@ -19,6 +20,7 @@ type ICipher interface {
 	VerifyPassword(plainText, cipherText string) bool
 }
 
+// Cipher 旧的带salt值的sha256密码算法，只用于校验旧密码
 func Cipher() ICipher {
 	if saltPasswd == nil { // 8位salt值，用$符号分隔开
 		saltPasswd = NewSaltPassword(8, "$")
@@ -41,12 +43,49 @@ func Md5(data string) string {
 	return hex.EncodeToString(cipher)
 }
 
+// SetDefaultCipher 修改新密码使用的算法，算法需要已经注册
+func SetDefaultCipher(id string) error {
+	if GetCipher(id) == nil {
+		return fmt.Errorf("unknown password cipher %q", id)
+	}
+	cipherMutex.Lock()
+	defaultID = id
+	cipherMutex.Unlock()
+	return nil
+}
+
+// DefaultCipher 新密码使用的算法，默认为argon2id
+func DefaultCipher() ICipher {
+	cipherMutex.RLock()
+	defer cipherMutex.RUnlock()
+	return cipherTable[defaultID]
+}
+
+// CheckPassword 按哈希格式选择算法校验密码，同时返回是否需要用默认算法重新哈希
+// 旧的salt$hash格式、其他算法或者参数过时的哈希，校验通过后都需要重新哈希
+func CheckPassword(plainText, cipherText string) (ok, rehash bool) {
+	c := FindCipher(cipherText)
+	if c == nil || !c.VerifyPassword(plainText, cipherText) {
+		return false, false
+	}
+	if c != DefaultCipher() {
+		return true, true
+	}
+	if r, isRehasher := c.(IRehasher); isRehasher {
+		return true, r.NeedsRehash(cipherText)
+	}
+	return true, false
+}
+
+// VerifyPassword 校验密码，支持全部注册的算法和旧格式
 func VerifyPassword(plainText, cipherText string) bool {
-	return ciper.VerifyPassword(plainText, cipherText)
+	ok, _ := CheckPassword(plainText, cipherText)
+	return ok
 }
 
+// CreatePassword 用默认算法设置密码
 func CreatePassword(password string) string {
-	return ciper.CreatePassword(password)
+	return DefaultCipher().CreatePassword(password)
 }
 
 func CreateMd5Password(password string) string {
@@ -5,6 +5,7 @@ import (
 	"io"
 
 	"github.com/azhai/gozzo/logging"
+	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/log"
 	"go.uber.org/zap"
 )
@@ -28,6 +29,12 @@ func SetLogger(filename string) *FiberLogger {
 	return l
 }
 
+// NewObserved 创建记录在内存中的日志，用于测试中检查输出
+func NewObserved(level string) (*FiberLogger, *logging.ObservedLogs) {
+	obs := logging.NewObserver(level)
+	return WrapLogger(obs.Logger), obs
+}
+
 // WrapLogger 封装日志
 func WrapLogger(l *zap.SugaredLogger) *FiberLogger {
 	lvl := log.LevelInfo
@@ -37,6 +44,19 @@ func WrapLogger(l *zap.SugaredLogger) *FiberLogger {
 	return &FiberLogger{level: lvl, SugaredLogger: l}
 }
 
+// Recover 捕获处理请求时的panic，写入崩溃报告后返回500错误，panic的内容只写入日志和报告
+func Recover() fiber.Handler {
+	return func(c fiber.Ctx) (err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				logging.HandlePanic(v, false)
+				err = fiber.ErrInternalServerError
+			}
+		}()
+		return c.Next()
+	}
+}
+
 func (l *FiberLogger) Trace(v ...interface{}) {
 	l.Debug(v...)
 }
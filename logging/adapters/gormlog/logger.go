@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/azhai/gozzo/logging"
+	"github.com/azhai/gozzo/logging/adapters/sqltrace"
 	"go.uber.org/zap"
 	"gorm.io/gorm/logger"
 )
@@ -25,6 +26,7 @@ type GormLogger struct {
 	LogLevel                  logger.LogLevel
 	SlowThreshold             time.Duration
 	IgnoreRecordNotFoundError bool
+	Tracer                    *sqltrace.Tracer // 隐藏敏感参数并统计SQL
 	*zap.SugaredLogger
 }
 
@@ -34,6 +36,12 @@ func NewLogger(filename string) *GormLogger {
 	return WrapLogger(l)
 }
 
+// NewObserved 创建记录在内存中的日志，用于测试中检查输出
+func NewObserved(level string) (*GormLogger, *logging.ObservedLogs) {
+	obs := logging.NewObserver(level)
+	return WrapLogger(obs.Logger), obs
+}
+
 // WrapLogger 封装日志
 func WrapLogger(l *zap.SugaredLogger) *GormLogger {
 	lvl := logger.Info
@@ -41,7 +49,10 @@ func WrapLogger(l *zap.SugaredLogger) *GormLogger {
 		l, lvl = zap.NewNop().Sugar(), logger.Silent
 	}
 	s := 200 * time.Millisecond
-	return &GormLogger{LogLevel: lvl, SlowThreshold: s, SugaredLogger: l}
+	return &GormLogger{
+		LogLevel: lvl, SlowThreshold: s,
+		Tracer: sqltrace.NewTracer(), SugaredLogger: l,
+	}
 }
 
 // LogMode log mode
@@ -76,37 +87,67 @@ func (l *GormLogger) Error(_ context.Context, msg string, data ...any) {
 }
 
 // Trace print sql message
-func (l *GormLogger) Trace(_ context.Context, begin time.Time,
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time,
 	fc func() (string, int64), err error) {
 	if l.LogLevel <= logger.Silent {
 		return
 	}
 
-	elapsed := time.Since(begin)
-	microSec := float64(elapsed.Nanoseconds()) / 1e6
-	lineNo := logging.FileWithLineNum()
 	sql, rows := fc()
-	switch {
-	case err != nil && l.LogLevel >= logger.Error && !l.IsIgnoreNotFound(err):
-		if rows == -1 {
-			l.Infof(traceErrStr, lineNo, err, microSec, "-", sql)
-		} else {
-			l.Infof(traceErrStr, lineNo, err, microSec, rows, sql)
+	span := &sqltrace.Span{SQL: sql, Rows: rows, Duration: time.Since(begin), Err: err}
+	if !l.willLog(span) {
+		if l.Tracer != nil {
+			l.Tracer.Observe(span, l.SlowThreshold)
 		}
-	case elapsed > l.SlowThreshold && l.SlowThreshold != 0 && l.LogLevel >= logger.Warn:
+		return
+	}
+	if l.Tracer != nil {
+		l.Tracer.Finish(ctx, span, l.SlowThreshold)
+	} else {
+		span.Caller = logging.FileWithLineNum()
+		span.Slow = l.SlowThreshold > 0 && span.Duration >= l.SlowThreshold
+	}
+	l.traceSpan(span)
+}
+
+// willLog whether the span will be printed, checked before the costly tracing
+func (l *GormLogger) willLog(span *sqltrace.Span) bool {
+	if !l.SugaredLogger.Desugar().Core().Enabled(zap.InfoLevel) {
+		return false
+	}
+	if l.LogLevel == logger.Info {
+		return true
+	}
+	if err := span.Err; err != nil && l.LogLevel >= logger.Error && !l.IsIgnoreNotFound(err) {
+		return true
+	}
+	slow := l.SlowThreshold > 0 && span.Duration >= l.SlowThreshold
+	return slow && l.LogLevel >= logger.Warn
+}
+
+// traceSpan print the span with its fields
+func (l *GormLogger) traceSpan(span *sqltrace.Span) {
+	var (
+		format string
+		args   []any
+		rows   any = span.Rows
+	)
+	if span.Rows == -1 {
+		rows = "-"
+	}
+	microSec := float64(span.Duration.Nanoseconds()) / 1e6
+	switch err := span.Err; {
+	case err != nil && l.LogLevel >= logger.Error && !l.IsIgnoreNotFound(err):
+		format, args = traceErrStr, []any{span.Caller, err, microSec, rows, span.SQL}
+	case span.Slow && l.LogLevel >= logger.Warn:
 		slowLog := fmt.Sprintf("SLOW SQL >= %v", l.SlowThreshold)
-		if rows == -1 {
-			l.Infof(traceWarnStr, lineNo, slowLog, microSec, "-", sql)
-		} else {
-			l.Infof(traceWarnStr, lineNo, slowLog, microSec, rows, sql)
-		}
+		format, args = traceWarnStr, []any{span.Caller, slowLog, microSec, rows, span.SQL}
 	case l.LogLevel == logger.Info:
-		if rows == -1 {
-			l.Infof(traceStr, lineNo, microSec, "-", sql)
-		} else {
-			l.Infof(traceStr, lineNo, microSec, rows, sql)
-		}
+		format, args = traceStr, []any{span.Caller, microSec, rows, span.SQL}
+	default:
+		return
 	}
+	l.SugaredLogger.With(span.Fields()...).Infof(format, args...)
 }
 
 // IsIgnoreNotFound when we want to ignore NotFound Record error
@@ -0,0 +1,315 @@
+package sqltrace
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// RedactMask 敏感值的替代文字
+const RedactMask = "***"
+
+const (
+	tokenWord        = iota // 关键字或标识符
+	tokenString             // 字符串
+	tokenNumber             // 数字
+	tokenPlaceholder        // 参数占位符 ? 或 $1
+	tokenSymbol             // 其他符号
+)
+
+// token SQL中的一个词
+type token struct {
+	kind       int
+	text       string
+	start, end int    // 在原SQL中的位置，按字符计算
+	column     string // 值对应的字段名
+	argIdx     int    // 占位符对应的参数序号
+}
+
+// isValue 是否值
+func (t token) isValue() bool {
+	return t.kind == tokenString || t.kind == tokenNumber || t.kind == tokenPlaceholder
+}
+
+// is 是否某个关键字或符号，忽略大小写
+func (t token) is(word string) bool {
+	return strings.EqualFold(t.text, word)
+}
+
+// tokenize 将SQL拆分为词，忽略空白
+func tokenize(sql string) (tokens []token) {
+	rs := []rune(sql)
+	argIdx := 0
+	for i := 0; i < len(rs); {
+		r, start := rs[i], i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '\'' || r == '"' || r == '`':
+			for i++; i < len(rs); i++ {
+				if rs[i] == r {
+					if i+1 < len(rs) && rs[i+1] == r { // 连续两个引号是转义
+						i++
+						continue
+					}
+					break
+				}
+				if rs[i] == '\\' && r == '\'' {
+					i++
+				}
+			}
+			i++
+			kind := tokenString
+			if r != '\'' { // 双引号和反引号是标识符
+				kind = tokenWord
+			}
+			i = min(i, len(rs))
+			tokens = append(tokens, token{kind: kind, text: string(rs[start:i]), start: start, end: i})
+			continue
+		case r == '?' || r == '$' && i+1 < len(rs) && unicode.IsDigit(rs[i+1]):
+			for i++; i < len(rs) && unicode.IsDigit(rs[i]); i++ {
+			}
+			if r == '$' { // PostgreSQL的参数从1开始编号
+				argIdx, _ = strconv.Atoi(string(rs[start+1 : i]))
+				argIdx--
+			}
+			tokens = append(tokens, token{
+				kind: tokenPlaceholder, text: string(rs[start:i]),
+				start: start, end: i, argIdx: argIdx,
+			})
+			argIdx++
+			continue
+		case unicode.IsDigit(r) || r == '-' && i+1 < len(rs) && unicode.IsDigit(rs[i+1]) && isAfterOperator(tokens):
+			for i++; i < len(rs) && (unicode.IsDigit(rs[i]) || rs[i] == '.'); i++ {
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(rs[start:i]), start: start, end: i})
+			continue
+		case unicode.IsLetter(r) || r == '_':
+			for i++; i < len(rs) && isWordRune(rs[i]); i++ {
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: string(rs[start:i]), start: start, end: i})
+			continue
+		}
+		i++
+		if i < len(rs) && strings.ContainsRune("<>!", r) && strings.ContainsRune("=>", rs[i]) {
+			i++ // 两个字符的比较符
+		}
+		tokens = append(tokens, token{kind: tokenSymbol, text: string(rs[start:i]), start: start, end: i})
+	}
+	return
+}
+
+// isWordRune 标识符中的字符，包括表名前缀的点
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.'
+}
+
+// isAfterOperator 负号之前是运算符或括号，而不是减法
+func isAfterOperator(tokens []token) bool {
+	if len(tokens) == 0 {
+		return true
+	}
+	last := tokens[len(tokens)-1]
+	return last.kind == tokenSymbol && last.text != ")" || last.kind == tokenWord && isKeyword(last.text)
+}
+
+// isComparison 是否比较运算符
+func isComparison(t token) bool {
+	if t.kind == tokenSymbol {
+		switch t.text {
+		case "=", "<>", "!=", "<", ">", "<=", ">=":
+			return true
+		}
+	}
+	return t.is("LIKE")
+}
+
+// keywords 不会作为字段名的关键字
+var keywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "AND": true, "OR": true, "NOT": true,
+	"IN": true, "LIKE": true, "IS": true, "NULL": true, "SET": true, "VALUES": true,
+	"INTO": true, "UPDATE": true, "DELETE": true, "INSERT": true, "JOIN": true,
+	"ON": true, "LIMIT": true, "OFFSET": true, "ORDER": true, "GROUP": true, "BY": true,
+	"HAVING": true, "AS": true, "BETWEEN": true, "CASE": true, "WHEN": true, "THEN": true,
+}
+
+// isKeyword 是否关键字
+func isKeyword(word string) bool {
+	return keywords[strings.ToUpper(word)]
+}
+
+// columnName 去掉引号和表名前缀，转为小写
+func columnName(word string) string {
+	word = strings.Trim(word, "`\"")
+	if pos := strings.LastIndexByte(word, '.'); pos >= 0 {
+		word = word[pos+1:]
+	}
+	return strings.ToLower(strings.Trim(word, "`\""))
+}
+
+// bindColumns 找出每个值对应的字段名
+func bindColumns(tokens []token) {
+	var (
+		insertCols []string
+		inColumn   string
+		depth      int
+		valueIdx   int
+		inValues   bool
+	)
+	for i, t := range tokens {
+		switch {
+		case t.is("VALUES"):
+			inValues = true
+			continue
+		case t.kind == tokenSymbol && t.text == "(":
+			depth++
+			if inValues && depth == 1 {
+				valueIdx = 0
+			} else if i > 0 && tokens[i-1].is("IN") && i > 1 && tokens[i-2].kind == tokenWord {
+				inColumn = columnName(tokens[i-2].text)
+			}
+			continue
+		case t.kind == tokenSymbol && t.text == ")":
+			depth--
+			inColumn = ""
+			if i > 0 && depth == 0 && !inValues && len(insertCols) == 0 && tokens[0].is("INSERT") {
+				insertCols = collectColumns(tokens[:i])
+			}
+			continue
+		case t.kind == tokenSymbol && t.text == ",":
+			if inValues && depth == 1 {
+				valueIdx++
+			}
+			continue
+		case !t.isValue():
+			continue
+		}
+		if inValues && depth == 1 && valueIdx < len(insertCols) {
+			tokens[i].column = insertCols[valueIdx]
+		} else if inColumn != "" {
+			tokens[i].column = inColumn
+		} else if i > 1 && isComparison(tokens[i-1]) && tokens[i-2].kind == tokenWord {
+			tokens[i].column = columnName(tokens[i-2].text)
+		} else if i > 2 && tokens[i-1].is("LIKE") && tokens[i-2].is("NOT") {
+			tokens[i].column = columnName(tokens[i-3].text)
+		}
+	}
+}
+
+// collectColumns INSERT语句中括号内的字段列表
+func collectColumns(tokens []token) (cols []string) {
+	for i := len(tokens) - 1; i >= 0; i-- {
+		if tokens[i].kind == tokenSymbol && tokens[i].text == "(" {
+			for _, t := range tokens[i+1:] {
+				if t.kind == tokenWord {
+					cols = append(cols, columnName(t.text))
+				}
+			}
+			return
+		}
+	}
+	return
+}
+
+// Statement 解析后的SQL语句
+type Statement struct {
+	Operation string
+	Table     string
+	sql       []rune
+	tokens    []token
+}
+
+// ParseStatement 解析SQL语句，找出操作、表名和每个值对应的字段
+func ParseStatement(sql string) *Statement {
+	stmt := &Statement{sql: []rune(sql), tokens: tokenize(sql)}
+	bindColumns(stmt.tokens)
+	for i, t := range stmt.tokens {
+		if t.kind != tokenWord {
+			continue
+		}
+		if stmt.Operation == "" {
+			stmt.Operation = strings.ToUpper(t.text)
+		}
+		if stmt.Table == "" && i+1 < len(stmt.tokens) && stmt.tokens[i+1].kind == tokenWord {
+			if t.is("FROM") || t.is("INTO") || t.is("UPDATE") || t.is("JOIN") {
+				stmt.Table = strings.Trim(stmt.tokens[i+1].text, "`\"")
+			}
+		}
+	}
+	return stmt
+}
+
+// Redact 隐藏敏感字段的值，返回新的SQL和参数
+func (s *Statement) Redact(args []any, isSensitive func(column string) bool) (string, []any, bool) {
+	var (
+		buf              strings.Builder
+		redacted, copied bool
+		offset           int
+	)
+	for _, t := range s.tokens {
+		if !t.isValue() || t.column == "" || !isSensitive(t.column) {
+			continue
+		}
+		if t.kind != tokenPlaceholder {
+			buf.WriteString(string(s.sql[offset:t.start]))
+			buf.WriteString("'" + RedactMask + "'")
+			offset = t.end
+		} else if t.argIdx < len(args) {
+			if !copied { // 复制一份，不修改原有参数
+				args, copied = append([]any(nil), args...), true
+			}
+			args[t.argIdx] = RedactMask
+		}
+		redacted = true
+	}
+	if !redacted {
+		return string(s.sql), args, false
+	}
+	buf.WriteString(string(s.sql[offset:]))
+	return buf.String(), args, true
+}
+
+// Normalize 去掉具体的值，用于统计同类语句
+func (s *Statement) Normalize() string {
+	var buf strings.Builder
+	for i, t := range s.tokens {
+		text := t.text
+		if t.isValue() {
+			text = "?"
+			if i > 0 && s.tokens[i-1].text == "," && i > 1 && s.tokens[i-2].isValue() {
+				continue // 合并IN和VALUES中的多个值
+			}
+		} else if t.text == "," && i+1 < len(s.tokens) && s.tokens[i+1].isValue() &&
+			i > 0 && s.tokens[i-1].isValue() {
+			continue
+		} else if t.kind == tokenWord && isKeyword(t.text) {
+			text = strings.ToUpper(text)
+		}
+		writeToken(&buf, s.tokens, i, text)
+	}
+	return buf.String()
+}
+
+// writeToken 写入一个词，必要时前面加空格
+func writeToken(buf *strings.Builder, tokens []token, i int, text string) {
+	if buf.Len() > 0 && needSpace(tokens, i) {
+		buf.WriteByte(' ')
+	}
+	buf.WriteString(text)
+}
+
+// needSpace 两个词之间是否需要空格
+func needSpace(tokens []token, i int) bool {
+	if i == 0 {
+		return false
+	}
+	prev, cur := tokens[i-1], tokens[i]
+	if cur.kind == tokenSymbol && (cur.text == "," || cur.text == ")" || cur.text == ".") {
+		return false
+	}
+	if prev.kind == tokenSymbol && (prev.text == "(" || prev.text == ".") {
+		return false
+	}
+	return true
+}
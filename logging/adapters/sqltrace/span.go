@@ -0,0 +1,123 @@
+package sqltrace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/azhai/gozzo/logging"
+	"github.com/azhai/gozzo/match"
+)
+
+// DefaultSensitive 默认的敏感字段，支持通配符
+var DefaultSensitive = []string{
+	"*password*", "*passwd*", "*secret*", "*token*", "salt",
+	"*id_card*", "*idcard*", "*phone*", "*mobile*", "*bank_card*",
+}
+
+type traceKey struct{}
+
+// WithTraceID 在上下文中设置跟踪ID，同一个请求中的SQL可以关联起来
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceKey{}, traceID)
+}
+
+// TraceID 读取上下文中的跟踪ID
+func TraceID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if id, ok := ctx.Value(traceKey{}).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// NewID 产生随机的十六进制ID，跟踪ID用16字节，片段ID用8字节
+func NewID(size int) string {
+	buf := make([]byte, size)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Span 一次SQL执行的记录
+type Span struct {
+	TraceID   string
+	SpanID    string
+	Operation string
+	Table     string
+	SQL       string
+	Args      []any
+	Rows      int64 // -1表示未知
+	Duration  time.Duration
+	Caller    string
+	Slow      bool
+	Err       error
+}
+
+// Fields 转为日志的键值对
+func (s *Span) Fields() []any {
+	fields := []any{
+		"trace_id", s.TraceID, "span_id", s.SpanID,
+		"db.operation", s.Operation, "db.table", s.Table,
+		"duration_ms", float64(s.Duration.Nanoseconds()) / 1e6,
+		"caller", s.Caller,
+	}
+	if s.Rows >= 0 {
+		fields = append(fields, "db.rows", s.Rows)
+	}
+	if s.Slow {
+		fields = append(fields, "slow", true)
+	}
+	if s.Err != nil {
+		fields = append(fields, "error", s.Err.Error())
+	}
+	return fields
+}
+
+// Tracer 生成SQL执行记录，隐藏敏感参数并汇总统计
+type Tracer struct {
+	Sensitive match.Globs
+	Stats     *Stats
+}
+
+// NewTracer 创建跟踪器，没有指定敏感字段时使用默认的
+func NewTracer(sensitive ...string) *Tracer {
+	if len(sensitive) == 0 {
+		sensitive = DefaultSensitive
+	}
+	return &Tracer{Sensitive: match.NewGlobs(sensitive), Stats: NewStats()}
+}
+
+// IsSensitive 字段是否敏感
+func (t *Tracer) IsSensitive(column string) bool {
+	return t.Sensitive.MatchAny(column, false)
+}
+
+// Finish 补全执行记录，超过slow时标记为慢查询，并计入统计
+func (t *Tracer) Finish(ctx context.Context, span *Span, slow time.Duration) *Span {
+	if span.TraceID = TraceID(ctx); span.TraceID == "" {
+		span.TraceID = NewID(16)
+	}
+	span.SpanID = NewID(8)
+	if span.Caller == "" {
+		span.Caller = logging.FileWithLineNum()
+	}
+	stmt := ParseStatement(span.SQL)
+	span.Operation, span.Table = stmt.Operation, stmt.Table
+	span.SQL, span.Args, _ = stmt.Redact(span.Args, t.IsSensitive)
+	span.Slow = slow > 0 && span.Duration >= slow
+	if t.Stats != nil {
+		t.Stats.Add(stmt.Normalize(), span)
+	}
+	return span
+}
+
+// Observe 不记录日志时只计入统计，不产生ID也不隐藏参数
+func (t *Tracer) Observe(span *Span, slow time.Duration) {
+	span.Slow = slow > 0 && span.Duration >= slow
+	if t.Stats != nil {
+		t.Stats.Add(ParseStatement(span.SQL).Normalize(), span)
+	}
+}
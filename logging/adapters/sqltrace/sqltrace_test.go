@@ -0,0 +1,84 @@
+package sqltrace_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/azhai/gozzo/logging/adapters/sqltrace"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactLiteral(t *testing.T) {
+	sql := "SELECT * FROM `users` WHERE `users`.`phone` = '13800138000' AND age > 18 LIMIT 1"
+	stmt := sqltrace.ParseStatement(sql)
+	assert.Equal(t, "SELECT", stmt.Operation)
+	assert.Equal(t, "users", stmt.Table)
+	tracer := sqltrace.NewTracer()
+	redacted, _, ok := stmt.Redact(nil, tracer.IsSensitive)
+	assert.True(t, ok)
+	assert.Equal(t, "SELECT * FROM `users` WHERE `users`.`phone` = '***' AND age > 18 LIMIT 1", redacted)
+}
+
+func TestRedactArgs(t *testing.T) {
+	sql := "INSERT INTO user (name, password, salt) VALUES (?, ?, ?), (?, ?, ?)"
+	args := []any{"a", "p1", "s1", "b", "p2", "s2"}
+	stmt := sqltrace.ParseStatement(sql)
+	assert.Equal(t, "INSERT", stmt.Operation)
+	assert.Equal(t, "user", stmt.Table)
+	tracer := sqltrace.NewTracer()
+	redacted, newArgs, ok := stmt.Redact(args, tracer.IsSensitive)
+	assert.True(t, ok)
+	assert.Equal(t, sql, redacted)
+	assert.Equal(t, []any{"a", "***", "***", "b", "***", "***"}, newArgs)
+	assert.Equal(t, "p1", args[1]) // 原有参数不变
+
+	stmt = sqltrace.ParseStatement(`UPDATE "user" SET token = $2 WHERE id IN ($1)`)
+	_, newArgs, _ = stmt.Redact([]any{1, "abc"}, tracer.IsSensitive)
+	assert.Equal(t, []any{1, "***"}, newArgs)
+}
+
+func TestStats(t *testing.T) {
+	tracer := sqltrace.NewTracer()
+	ctx := sqltrace.WithTraceID(context.Background(), "trace-1")
+	for i := 1; i <= 3; i++ {
+		sql := "SELECT * FROM user WHERE id IN (1, 2, " + strings.Repeat("3, ", i) + "4)"
+		span := &sqltrace.Span{SQL: sql, Rows: 2, Duration: time.Duration(i) * time.Millisecond}
+		tracer.Finish(ctx, span, 2*time.Millisecond)
+		assert.Equal(t, "trace-1", span.TraceID)
+		assert.Equal(t, i >= 2, span.Slow)
+	}
+	items := tracer.Stats.Snapshot()
+	assert.Len(t, items, 1)
+	assert.Equal(t, "SELECT * FROM user WHERE id IN (?)", items[0].SQL)
+	assert.Equal(t, int64(3), items[0].Count)
+	assert.Equal(t, int64(2), items[0].Slows)
+	assert.Equal(t, 3*time.Millisecond, items[0].MaxTime)
+
+	var buf strings.Builder
+	assert.NoError(t, tracer.Stats.Dump(&buf, 10))
+	assert.Contains(t, buf.String(), "IN (?)")
+}
+
+func TestStatsLimit(t *testing.T) {
+	stats := sqltrace.NewStats()
+	stats.Limit = 2
+	for _, table := range []string{"a", "b", "c", "d"} {
+		stats.Add("SELECT * FROM "+table, &sqltrace.Span{Duration: time.Millisecond})
+	}
+	items := stats.Snapshot()
+	assert.Len(t, items, 3)
+	for _, item := range items {
+		if item.SQL == sqltrace.OtherSQL {
+			assert.Equal(t, int64(2), item.Count)
+		}
+	}
+
+	tracer := sqltrace.NewTracer()
+	span := &sqltrace.Span{SQL: "SELECT * FROM user WHERE id = 1", Duration: 3 * time.Millisecond}
+	tracer.Observe(span, 2*time.Millisecond)
+	assert.True(t, span.Slow)
+	assert.Empty(t, span.SpanID)
+	assert.Equal(t, int64(1), tracer.Stats.Snapshot()[0].Slows)
+}
@@ -0,0 +1,125 @@
+package sqltrace
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// StmtStat 同类语句的统计
+type StmtStat struct {
+	SQL       string
+	Count     int64
+	Errors    int64
+	Slows     int64
+	Rows      int64
+	TotalTime time.Duration
+	MaxTime   time.Duration
+}
+
+// AvgTime 平均耗时
+func (s StmtStat) AvgTime() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.TotalTime / time.Duration(s.Count)
+}
+
+// 统计的语句种类上限，超出后的新语句合并计入OtherSQL
+const (
+	DefaultStatsLimit = 1000
+	OtherSQL          = "(other)"
+)
+
+// Stats 按语句汇总执行次数和耗时
+type Stats struct {
+	Limit int // 语句种类上限，不大于0时使用DefaultStatsLimit
+	items map[string]*StmtStat
+	mu    sync.Mutex
+}
+
+// NewStats 创建统计
+func NewStats() *Stats {
+	return &Stats{Limit: DefaultStatsLimit, items: make(map[string]*StmtStat)}
+}
+
+// Add 计入一次执行
+func (s *Stats) Add(sql string, span *Span) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[sql]
+	if !ok {
+		limit := s.Limit
+		if limit <= 0 {
+			limit = DefaultStatsLimit
+		}
+		if len(s.items) >= limit {
+			sql = OtherSQL
+		}
+		if item, ok = s.items[sql]; !ok {
+			item = &StmtStat{SQL: sql}
+			s.items[sql] = item
+		}
+	}
+	item.Count++
+	item.TotalTime += span.Duration
+	if span.Duration > item.MaxTime {
+		item.MaxTime = span.Duration
+	}
+	if span.Rows > 0 {
+		item.Rows += span.Rows
+	}
+	if span.Err != nil {
+		item.Errors++
+	}
+	if span.Slow {
+		item.Slows++
+	}
+}
+
+// Snapshot 当前的统计，按总耗时从多到少排列
+func (s *Stats) Snapshot() []StmtStat {
+	s.mu.Lock()
+	result := make([]StmtStat, 0, len(s.items))
+	for _, item := range s.items {
+		result = append(result, *item)
+	}
+	s.mu.Unlock()
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].TotalTime > result[j].TotalTime
+	})
+	return result
+}
+
+// Reset 清空统计
+func (s *Stats) Reset() {
+	s.mu.Lock()
+	s.items = make(map[string]*StmtStat)
+	s.mu.Unlock()
+}
+
+// Dump 以表格输出统计，top大于0时只输出前几条
+func (s *Stats) Dump(w io.Writer, top int) error {
+	items := s.Snapshot()
+	if top > 0 && top < len(items) {
+		items = items[:top]
+	}
+	_, err := fmt.Fprintf(w, "%8s %6s %6s %10s %10s %10s  %s\n",
+		"count", "errors", "slows", "total(ms)", "avg(ms)", "max(ms)", "sql")
+	for _, item := range items {
+		if err != nil {
+			break
+		}
+		_, err = fmt.Fprintf(w, "%8d %6d %6d %10.3f %10.3f %10.3f  %s\n",
+			item.Count, item.Errors, item.Slows, toMillis(item.TotalTime),
+			toMillis(item.AvgTime()), toMillis(item.MaxTime), item.SQL)
+	}
+	return err
+}
+
+// toMillis 转为毫秒
+func toMillis(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / 1e6
+}
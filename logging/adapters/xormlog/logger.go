@@ -2,16 +2,20 @@ package xormlog
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/azhai/gozzo/logging"
+	"github.com/azhai/gozzo/logging/adapters/sqltrace"
 	"go.uber.org/zap"
 	"xorm.io/xorm/log"
 )
 
 // XormLogger xorm日志
 type XormLogger struct {
-	level   log.LogLevel
-	showSQL bool
+	level         log.LogLevel
+	showSQL       bool
+	SlowThreshold time.Duration
+	Tracer        *sqltrace.Tracer // 隐藏敏感参数并统计SQL
 	*zap.SugaredLogger
 }
 
@@ -21,13 +25,23 @@ func NewLogger(filename string) *XormLogger {
 	return WrapLogger(l)
 }
 
+// NewObserved 创建记录在内存中的日志，用于测试中检查输出
+func NewObserved(level string) (*XormLogger, *logging.ObservedLogs) {
+	obs := logging.NewObserver(level)
+	return WrapLogger(obs.Logger), obs
+}
+
 // WrapLogger 封装日志
 func WrapLogger(l *zap.SugaredLogger) *XormLogger {
 	lvl := log.LOG_INFO
 	if l == nil {
 		l, lvl = zap.NewNop().Sugar(), log.LOG_OFF
 	}
-	return &XormLogger{level: lvl, showSQL: true, SugaredLogger: l}
+	s := 200 * time.Millisecond
+	return &XormLogger{
+		level: lvl, showSQL: true, SlowThreshold: s,
+		Tracer: sqltrace.NewTracer(), SugaredLogger: l,
+	}
 }
 
 // AfterSQL implements ContextLogger
@@ -37,10 +51,35 @@ func (l *XormLogger) AfterSQL(ctx log.LogContext) {
 	if key, ok := v.(string); ok {
 		sessionPart = fmt.Sprintf(" [%s]", key)
 	}
+	span := &sqltrace.Span{
+		SQL: ctx.SQL, Args: ctx.Args, Rows: -1,
+		Duration: ctx.ExecuteTime, Err: ctx.Err,
+	}
+	if ctx.Result != nil {
+		if rows, err := ctx.Result.RowsAffected(); err == nil {
+			span.Rows = rows
+		}
+	}
+	if !l.SugaredLogger.Desugar().Core().Enabled(zap.InfoLevel) {
+		if l.Tracer != nil {
+			l.Tracer.Observe(span, l.SlowThreshold)
+		}
+		return
+	}
+	if l.Tracer != nil {
+		l.Tracer.Finish(ctx.Ctx, span, l.SlowThreshold)
+	} else {
+		span.Caller = logging.FileWithLineNum()
+		span.Slow = l.SlowThreshold > 0 && span.Duration >= l.SlowThreshold
+	}
+	if span.Slow {
+		sessionPart = " [SLOW]" + sessionPart
+	}
+	zl := l.SugaredLogger.With(span.Fields()...)
 	if ctx.ExecuteTime > 0 {
-		l.Infof("[SQL]%s %s %v - %v", sessionPart, ctx.SQL, ctx.Args, ctx.ExecuteTime)
+		zl.Infof("[SQL]%s %s %v - %v", sessionPart, span.SQL, span.Args, ctx.ExecuteTime)
 	} else {
-		l.Infof("[SQL]%s %s %v", sessionPart, ctx.SQL, ctx.Args)
+		zl.Infof("[SQL]%s %s %v", sessionPart, span.SQL, span.Args)
 	}
 }
 
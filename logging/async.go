@@ -0,0 +1,256 @@
+package logging
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultBufferSize    = 1024            // 默认缓冲条数
+	defaultFlushInterval = time.Second     // 默认刷新间隔
+	asyncWriteBufSize    = 256 * 1024      // 合并写入的字节数，只合并完整的日志
+	asyncStopTimeout     = 5 * time.Second // 停止时等待写完的时间
+)
+
+// ErrWriterStopped 异步写入已经停止
+var ErrWriterStopped = errors.New("async writer is stopped")
+
+var asyncWriters sync.Map // 运行中的异步写入，只用于查看统计，由所属的记录器负责停止
+
+// Buffer 异步缓冲写入配置
+type Buffer struct {
+	Size          int           // 缓冲的条数，默认1024
+	FlushInterval time.Duration // 定时刷新间隔，默认1秒
+	FlushLevel    string        // 达到此级别时立即刷新，默认error
+	Block         bool          // 缓冲满时等待，默认丢弃新的日志
+}
+
+// AsyncStats 异步写入的统计
+type AsyncStats struct {
+	Name    string
+	Written int64 // 已写入条数
+	Dropped int64 // 缓冲满或者写入失败时丢弃的条数
+	Flushes int64 // 刷新次数
+	Pending int   // 缓冲中等待写入的条数
+}
+
+// AsyncWriter 异步缓冲写入，由后台协程批量写入并定时刷新
+type AsyncWriter struct {
+	name     string
+	ws       zapcore.WriteSyncer
+	batch    []byte // 合并写入的日志，只在后台协程中使用
+	count    int    // batch中的日志条数
+	queue    chan []byte
+	syncReq  chan chan error
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	block    bool
+	interval time.Duration
+	level    zapcore.Level
+
+	written, dropped, flushes atomic.Int64
+}
+
+// NewAsyncWriter 创建异步写入，name用于统计
+func NewAsyncWriter(name string, ws zapcore.WriteSyncer, cfg *Buffer) *AsyncWriter {
+	size, interval, level := defaultBufferSize, defaultFlushInterval, "error"
+	if cfg.Size > 0 {
+		size = cfg.Size
+	}
+	if cfg.FlushInterval > 0 {
+		interval = cfg.FlushInterval
+	}
+	if cfg.FlushLevel != "" {
+		level = cfg.FlushLevel
+	}
+	w := &AsyncWriter{
+		name: name, ws: ws,
+		queue: make(chan []byte, size), syncReq: make(chan chan error),
+		stop: make(chan struct{}), done: make(chan struct{}),
+		block: cfg.Block, interval: interval,
+	}
+	_, w.level = GetZapLevel(level)
+	asyncWriters.Store(w, struct{}{})
+	go w.run()
+	return w
+}
+
+// Write 放入缓冲，zap会重用p，所以需要复制，停止后返回错误
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	select {
+	case <-w.stop:
+		return 0, ErrWriterStopped
+	default:
+	}
+	data := append([]byte(nil), p...)
+	if w.block {
+		select {
+		case w.queue <- data:
+			return len(p), nil
+		case <-w.done:
+			return 0, ErrWriterStopped
+		}
+	}
+	select {
+	case w.queue <- data:
+	case <-w.done:
+		return 0, ErrWriterStopped
+	default:
+		w.dropped.Add(1)
+	}
+	return len(p), nil
+}
+
+// Sync 写完缓冲中的日志并同步
+func (w *AsyncWriter) Sync() error {
+	reply := make(chan error, 1)
+	select {
+	case w.syncReq <- reply:
+		return <-reply
+	case <-w.done:
+		return w.ws.Sync()
+	}
+}
+
+// Stop 写完缓冲中的日志后停止
+func (w *AsyncWriter) Stop() (err error) {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+		select {
+		case <-w.done:
+		case <-time.After(asyncStopTimeout):
+			err = errors.New("timeout when stopping async writer")
+		}
+		asyncWriters.Delete(w)
+	})
+	return
+}
+
+// Stats 当前统计
+func (w *AsyncWriter) Stats() AsyncStats {
+	return AsyncStats{
+		Name: w.name, Written: w.written.Load(), Dropped: w.dropped.Load(),
+		Flushes: w.flushes.Load(), Pending: len(w.queue),
+	}
+}
+
+// WrapCore 日志达到指定级别时立即刷新
+func (w *AsyncWriter) WrapCore(core zapcore.Core) zapcore.Core {
+	return &flushCore{Core: core, writer: w}
+}
+
+// run 后台写入
+func (w *AsyncWriter) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case data := <-w.queue:
+			w.write(data)
+		case <-ticker.C:
+			_ = w.flush()
+		case reply := <-w.syncReq:
+			w.drain()
+			reply <- w.flush()
+		case <-w.stop:
+			w.drain()
+			_ = w.flush()
+			return
+		}
+	}
+}
+
+// write 合并一条日志，超出合并的字节数时先写入之前的日志，保证每次写入的都是完整的日志
+func (w *AsyncWriter) write(data []byte) {
+	if len(w.batch) > 0 && len(w.batch)+len(data) > asyncWriteBufSize {
+		_ = w.writeBatch()
+	}
+	w.batch = append(w.batch, data...)
+	w.count++
+}
+
+// writeBatch 写入合并的日志，失败时这些日志计为丢弃，不影响之后的写入
+func (w *AsyncWriter) writeBatch() error {
+	if w.count == 0 {
+		return nil
+	}
+	_, err := w.ws.Write(w.batch)
+	if err != nil {
+		w.dropped.Add(int64(w.count))
+	} else {
+		w.written.Add(int64(w.count))
+	}
+	if cap(w.batch) > 2*asyncWriteBufSize { // 不保留单条超大日志占用的内存
+		w.batch = nil
+	}
+	w.batch, w.count = w.batch[:0], 0
+	return err
+}
+
+// drain 写入缓冲中的全部日志
+func (w *AsyncWriter) drain() {
+	for {
+		select {
+		case data := <-w.queue:
+			w.write(data)
+		default:
+			return
+		}
+	}
+}
+
+// flush 刷新到文件
+func (w *AsyncWriter) flush() error {
+	if w.count == 0 {
+		return nil
+	}
+	w.flushes.Add(1)
+	if err := w.writeBatch(); err != nil {
+		return err
+	}
+	return w.ws.Sync()
+}
+
+// flushCore 写入高级别日志后刷新缓冲
+type flushCore struct {
+	zapcore.Core
+	writer *AsyncWriter
+}
+
+// With 增加字段
+func (c *flushCore) With(fields []zapcore.Field) zapcore.Core {
+	return &flushCore{Core: c.Core.With(fields), writer: c.writer}
+}
+
+// Check 检查是否需要记录
+func (c *flushCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write 写入后按级别刷新
+func (c *flushCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	err := c.Core.Write(ent, fields)
+	if err == nil && ent.Level >= c.writer.level {
+		err = c.writer.Sync()
+	}
+	return err
+}
+
+// GetAsyncStats 全部异步写入的统计
+func GetAsyncStats() []AsyncStats {
+	var result []AsyncStats
+	asyncWriters.Range(func(key, _ any) bool {
+		result = append(result, key.(*AsyncWriter).Stats())
+		return true
+	})
+	return result
+}
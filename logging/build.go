@@ -6,6 +6,9 @@ import (
 	"net/url"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -15,6 +18,21 @@ import (
 type Output struct {
 	Start, Stop string
 	OutPaths    []string
+	Encoding    string        // 编码，为空时使用全局编码
+	Sampling    *Sampling     // 采样，为空时不采样
+	DedupWindow time.Duration // 去重窗口，为0时不去重
+	Buffer      *Buffer       // 异步缓冲写入，为空时同步写入
+}
+
+// WrapCore 按配置为内核加上去重和采样
+func (o Output) WrapCore(core zapcore.Core) zapcore.Core {
+	core = NewDedupCore(core, o.DedupWindow)
+	return o.Sampling.Wrap(core)
+}
+
+// IsWrapped 是否需要包装内核
+func (o Output) IsWrapped() bool {
+	return o.DedupWindow > 0 || o.Buffer != nil || o.Sampling != nil && o.Sampling.First > 0
 }
 
 // LogConfig 日志配置
@@ -24,6 +42,7 @@ type LogConfig struct {
 	LevelCase  string
 	TimeFormat string
 	Outputs    []Output
+	Redaction  *Redaction // 脱敏，为空时不处理
 }
 
 // NewLogger 指定日志目录，普通和错误日志分文件存放
@@ -85,18 +104,133 @@ func (c *LogConfig) BuildLogger(dir string, opts ...zap.Option) (*zap.Logger, er
 		c.Development = true
 		c.Sampling = nil
 	}
+	if c.Redaction != nil {
+		if _, err := c.Redaction.Compile(); err != nil {
+			return nil, err
+		}
+	}
 	dir = strings.TrimSpace(dir)
-	if cores := c.BuildCores(dir); len(cores) > 1 {
-		opts = append(opts, ReplaceCores(cores))
+	cores, closers := c.buildCores(dir)
+	if len(cores) > 0 {
+		// 输出已经打开，由记录器的内核持有，避免zap再次打开同样的文件
+		paths := c.OutputPaths
+		c.OutputPaths = nil
+		defer func() { c.OutputPaths = paths }()
+		opts = append(opts, c.ownCores(cores, closers))
 	}
 	return c.Config.Build(opts...)
 }
 
+// ownCores 替换为多种输出的内核，并持有各个输出，关闭记录器时一起关闭
+func (c *LogConfig) ownCores(cores []zapcore.Core, closers []func() error) zap.Option {
+	return zap.WrapCore(func(zapcore.Core) zapcore.Core {
+		core := zapcore.NewTee(cores...)
+		if s := c.Config.Sampling; s != nil {
+			core = zapcore.NewSamplerWithOptions(core, time.Second, s.Initial, s.Thereafter)
+		}
+		return &ownerCore{Core: core, state: &ownerState{closers: closers}}
+	})
+}
+
+// CloseLogger 停止记录器的异步写入并关闭输出的文件，替换记录器后调用
+// 关闭后仍然持有这个记录器的地方，写入的日志转给当前的日志单例
+func CloseLogger(l *zap.SugaredLogger) error {
+	if l == nil {
+		return nil
+	}
+	_ = l.Sync()
+	if c, ok := l.Desugar().Core().(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// ownerState 记录器持有的输出，With产生的内核共用
+type ownerState struct {
+	closers []func() error
+	closed  atomic.Bool
+	once    sync.Once
+}
+
+// ownerCore 持有各个输出的内核，关闭后写入的日志转给当前的日志单例
+type ownerCore struct {
+	zapcore.Core
+	state  *ownerState
+	fields []zapcore.Field // With增加的字段，转给日志单例时带上
+}
+
+// With 增加字段
+func (c *ownerCore) With(fields []zapcore.Field) zapcore.Core {
+	return &ownerCore{
+		Core: c.Core.With(fields), state: c.state,
+		fields: append(c.fields[:len(c.fields):len(c.fields)], fields...),
+	}
+}
+
+// Check 检查是否需要记录，已经关闭时由日志单例检查
+func (c *ownerCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.state.closed.Load() {
+		return c.Core.Check(ent, ce)
+	}
+	l := getLogger()
+	if l == nil {
+		return ce
+	}
+	live := l.Desugar().Core()
+	if isClosedCore(live) { // 日志单例也已经关闭，例如退出程序时
+		return ce
+	}
+	if len(c.fields) > 0 {
+		live = live.With(c.fields)
+	}
+	return live.Check(ent, ce)
+}
+
+// Close 实现io.Closer，先停止异步写入再关闭文件，只执行一次
+func (c *ownerCore) Close() (err error) {
+	c.state.once.Do(func() {
+		c.state.closed.Store(true)
+		for _, fn := range c.state.closers {
+			if errClose := fn(); err == nil {
+				err = errClose
+			}
+		}
+	})
+	return
+}
+
+// isClosed 是否已经关闭
+func (c *ownerCore) isClosed() bool {
+	return c.state.closed.Load()
+}
+
+// isClosedCore 内核持有的输出是否已经关闭
+func isClosedCore(core zapcore.Core) bool {
+	c, ok := core.(interface{ isClosed() bool })
+	return ok && c.isClosed()
+}
+
 // IsNop 是否空日志
 func (c *LogConfig) IsNop() bool {
 	return len(c.Outputs) == 0 && len(c.OutputPaths) == 0
 }
 
+// IsWrapped 是否需要脱敏，或有输出需要包装内核或使用单独的编码
+func (c *LogConfig) IsWrapped() bool {
+	if c.Redaction != nil {
+		return true
+	}
+	for _, out := range c.Outputs {
+		if out.IsWrapped() {
+			return true
+		}
+		if out.Encoding != "" && !strings.EqualFold(out.Encoding, c.Encoding) {
+			return true
+		}
+	}
+	return false
+}
+
 // BuildLevel 当前日志的最低级别
 func (c *LogConfig) BuildLevel() zap.AtomicLevel {
 	var level zapcore.Level
@@ -105,40 +239,96 @@ func (c *LogConfig) BuildLevel() zap.AtomicLevel {
 	return c.Level
 }
 
-// BuildCores 产生记录器内核
+// BuildCores 产生记录器内核，打开的输出不会被关闭，需要关闭时使用BuildLogger
 func (c *LogConfig) BuildCores(dir string) []zapcore.Core {
+	cores, _ := c.buildCores(dir)
+	return cores
+}
+
+// buildCores 产生记录器内核，同时返回关闭各个输出的函数
+func (c *LogConfig) buildCores(dir string) ([]zapcore.Core, []func() error) {
 	var (
-		cores []zapcore.Core
-		ws    zapcore.WriteSyncer
-		err   error
+		cores   []zapcore.Core
+		closers []func() error
+		ws      zapcore.WriteSyncer
+		closeWs func()
+		err     error
 	)
 	enc := c.GetEncoder()
+	redactor := c.redactor()
 	for _, out := range c.Outputs {
 		enabler := GetLevelEnabler(out.Start, out.Stop, c.MinLevel)
 		if enabler == nil || len(out.OutPaths) == 0 {
 			continue
 		}
-		c.OutputPaths = GetLogPath(dir, out.OutPaths)
+		var paths []string
+		for _, path := range GetLogPath(dir, out.OutPaths) {
+			if !IsSocketURL(path) {
+				paths = append(paths, path)
+				continue
+			}
+			// syslog和journald直接使用日志记录，不经过编码和缓冲
+			if w, err := OpenEntryWriter(path); err == nil {
+				closers = append(closers, w.Close)
+				cores = append(cores, out.WrapCore(NewEntryCore(w, enabler, redactor)))
+			}
+		}
+		if c.OutputPaths = paths; len(paths) == 0 && len(out.OutPaths) > 0 {
+			continue
+		}
 		if len(c.OutputPaths) == 0 || c.OutputPaths[0] == "/dev/null" {
 			ws = zapcore.AddSync(io.Discard)
-		} else if ws, _, err = zap.Open(c.OutputPaths...); err != nil {
+		} else if ws, closeWs, err = zap.Open(c.OutputPaths...); err != nil {
 			continue
 		}
-		cores = append(cores, zapcore.NewCore(enc, ws, enabler))
+		var writer *AsyncWriter
+		if out.Buffer != nil {
+			writer = NewAsyncWriter(strings.Join(c.OutputPaths, ","), ws, out.Buffer)
+			ws = writer
+			closers = append(closers, writer.Stop)
+		}
+		if closeWs != nil {
+			fn := closeWs
+			closers = append(closers, func() error { fn(); return nil })
+			closeWs = nil
+		}
+		outEnc := enc
+		if out.Encoding != "" {
+			outEnc = c.Redaction.Wrap(NewEncoder(out.Encoding, c.Config.EncoderConfig))
+		}
+		core := zapcore.NewCore(outEnc, ws, enabler)
+		if writer != nil {
+			core = writer.WrapCore(core)
+		}
+		cores = append(cores, out.WrapCore(core))
 	}
-	return cores
+	return cores, closers
+}
+
+// redactor 脱敏处理，没有配置时为空
+func (c *LogConfig) redactor() *Redactor {
+	if c.Redaction == nil {
+		return nil
+	}
+	r, _ := c.Redaction.Compile()
+	return r
 }
 
 // GetEncoder 根据编码配置设置日志格式
 func (c *LogConfig) GetEncoder() zapcore.Encoder {
 	c.Config.EncoderConfig = NewEncoderConfig(c.TimeFormat, c.LevelCase)
-	if strings.ToLower(c.Encoding) == "json" {
-		return zapcore.NewJSONEncoder(c.Config.EncoderConfig)
+	return c.Redaction.Wrap(NewEncoder(c.Encoding, c.Config.EncoderConfig))
+}
+
+// NewEncoder 创建json或console格式的编码器
+func NewEncoder(encoding string, ec zapcore.EncoderConfig) zapcore.Encoder {
+	if strings.ToLower(encoding) == "json" {
+		return zapcore.NewJSONEncoder(ec)
 	}
-	return zapcore.NewConsoleEncoder(c.Config.EncoderConfig)
+	return zapcore.NewConsoleEncoder(ec)
 }
 
-// ReplaceCores 替换为多种输出的Core
+// ReplaceCores 替换为多种输出的Core，不持有输出
 func ReplaceCores(cores []zapcore.Core) zap.Option {
 	return zap.WrapCore(func(c zapcore.Core) zapcore.Core {
 		return zapcore.NewTee(cores...)
@@ -152,7 +342,7 @@ func GetLogPath(dir string, files []string) []string {
 	}
 	var err error
 	for i, file := range files {
-		if dir == "" && strings.HasPrefix(file, "std") {
+		if dir == "" && strings.HasPrefix(file, "std") || IsSocketURL(file) {
 			files[i] = file
 			continue
 		}
@@ -168,6 +358,11 @@ func GetLogPath(dir string, files []string) []string {
 	return files
 }
 
+// IsSocketURL 是否syslog或journald地址，不需要处理路径
+func IsSocketURL(file string) bool {
+	return strings.HasPrefix(file, "syslog://") || strings.HasPrefix(file, "journald://")
+}
+
 // GetAbsPath 使用真实的绝对路径
 func GetAbsPath(file string, onlyFile bool) (path string, err error) {
 	var u *url.URL
@@ -178,7 +373,7 @@ func GetAbsPath(file string, onlyFile bool) (path string, err error) {
 	if scheme = u.Scheme; scheme == "" {
 		scheme = "file"
 	}
-	if onlyFile && scheme == "file" {
+	if onlyFile && scheme == "file" || IsSocketURL(file) {
 		path = file
 		return // 只能处理文件类型
 	}
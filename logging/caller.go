@@ -9,6 +9,9 @@ import (
 
 var callerSourceDir string
 
+// CallerSkipPaths 查找调用者时跳过的路径，ORM内部的调用不算
+var CallerSkipPaths = []string{"/gorm.io/", "/xorm.io/"}
+
 func init() {
 	_, file, _, _ := runtime.Caller(0)
 	// compatible solution to get gorm source directory with various operating systems
@@ -29,9 +32,22 @@ func FileWithLineNum() string {
 	// the second caller usually from gorm internal, so set i start from 2
 	for i := 2; i < 15; i++ {
 		_, file, line, ok := runtime.Caller(i)
-		if ok && (!strings.HasPrefix(file, callerSourceDir) || strings.HasSuffix(file, "_test.go")) {
+		if ok && (!isSkipCaller(file) || strings.HasSuffix(file, "_test.go")) {
 			return file + ":" + strconv.FormatInt(int64(line), 10)
 		}
 	}
 	return ""
 }
+
+// isSkipCaller 是否本项目或ORM内部的文件
+func isSkipCaller(file string) bool {
+	if strings.HasPrefix(file, callerSourceDir) {
+		return true
+	}
+	for _, path := range CallerSkipPaths {
+		if strings.Contains(file, path) {
+			return true
+		}
+	}
+	return false
+}
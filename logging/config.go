@@ -26,10 +26,16 @@ var LogLevels = map[string]zapcore.Level{
 }
 
 func init() {
-	// 注册rotate文件
+	// 注册rotate文件、syslog和journald
 	if err := zap.RegisterSink("rotate", rotate); err != nil {
 		panic(err)
 	}
+	if err := zap.RegisterSink("syslog", syslog); err != nil {
+		panic(err)
+	}
+	if err := zap.RegisterSink("journald", journald); err != nil {
+		panic(err)
+	}
 }
 
 // GetZapLevel 转为zap的Level
@@ -67,7 +73,7 @@ func GetLevelEnabler(start, stop, min string) zapcore.LevelEnabler {
 
 func NewEncoderConfig(timeFormat, levelFormat string) zapcore.EncoderConfig {
 	ec := zap.NewDevelopmentEncoderConfig()
-	ec.EncodeCaller = nil
+	ec.CallerKey, ec.EncodeCaller = zapcore.OmitKey, nil // json编码时也不输出调用者
 	if timeFormat != "" {
 		ec.EncodeTime = zapcore.TimeEncoderOfLayout(timeFormat)
 	}
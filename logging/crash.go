@@ -0,0 +1,280 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const crashTimeFormat = "20060102-150405.000"
+
+var (
+	crashDir   atomic.Pointer[string]   // 崩溃报告的目录，为空时使用临时目录
+	recentLogs atomic.Pointer[RingCore] // 最近的日志，写入崩溃报告
+	crashSeq   atomic.Int64             // 报告文件的序号，避免同一毫秒内重名
+)
+
+// EnableCrashReport 设置崩溃报告的目录，并保留最近recent条日志，条数不变时沿用原有的日志
+func EnableCrashReport(dir string, recent int) {
+	SetCrashDir(dir)
+	if recent <= 0 {
+		recentLogs.Store(nil)
+		return
+	}
+	if ring := recentLogs.Load(); ring != nil && len(ring.ring.lines) == recent {
+		return
+	}
+	recentLogs.Store(NewRingCore(recent, zapcore.DebugLevel))
+	if l := getLogger(); l != nil { // 单例已经被替换时不再处理
+		defaultLogger.CompareAndSwap(l, withRecentLogs(l))
+	}
+}
+
+// SetCrashDir 设置崩溃报告的目录
+func SetCrashDir(dir string) {
+	crashDir.Store(&dir)
+}
+
+// getCrashDir 崩溃报告的目录
+func getCrashDir() string {
+	if dir := crashDir.Load(); dir != nil {
+		return *dir
+	}
+	return ""
+}
+
+// withRecentLogs 同时写入最近日志
+func withRecentLogs(l *zap.SugaredLogger) *zap.SugaredLogger {
+	ring := recentLogs.Load()
+	if ring == nil || l == nil {
+		return l
+	}
+	zl := l.Desugar().WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		if rt, ok := c.(*recentTee); ok { // 避免重复包装
+			c = rt.Core
+		}
+		return &recentTee{Core: c, ring: ring}
+	}))
+	return zl.Sugar()
+}
+
+// recentTee 同时写入原有内核和最近日志
+type recentTee struct {
+	zapcore.Core
+	ring *RingCore
+}
+
+// With 增加字段
+func (t *recentTee) With(fields []zapcore.Field) zapcore.Core {
+	return &recentTee{Core: t.Core.With(fields), ring: t.ring.With(fields).(*RingCore)}
+}
+
+// Close 关闭原有内核持有的输出
+func (t *recentTee) Close() error {
+	if c, ok := t.Core.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// isClosed 原有内核持有的输出是否已经关闭
+func (t *recentTee) isClosed() bool {
+	return isClosedCore(t.Core)
+}
+
+// Check 检查是否需要记录
+func (t *recentTee) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if t.isClosed() { // 转给日志单例，由它记入最近日志
+		return t.Core.Check(ent, ce)
+	}
+	return t.ring.Check(ent, t.Core.Check(ent, ce))
+}
+
+// Write 写入日志
+func (t *recentTee) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	err := t.Core.Write(ent, fields)
+	if errRing := t.ring.Write(ent, fields); err == nil {
+		err = errRing
+	}
+	return err
+}
+
+// RingCore 在内存中保留最近的若干条日志
+type RingCore struct {
+	zapcore.LevelEnabler
+	enc  zapcore.Encoder
+	ring *ringBuffer
+}
+
+// ringBuffer 环形缓冲
+type ringBuffer struct {
+	lines []string
+	next  int
+	full  bool
+	mu    sync.Mutex
+}
+
+// NewRingCore 创建保留size条日志的内核
+func NewRingCore(size int, enabler zapcore.LevelEnabler) *RingCore {
+	enc := zapcore.NewConsoleEncoder(NewEncoderConfig("2006-01-02 15:04:05.000", "cap"))
+	return &RingCore{
+		LevelEnabler: enabler, enc: enc,
+		ring: &ringBuffer{lines: make([]string, size)},
+	}
+}
+
+// With 增加字段
+func (c *RingCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return &RingCore{LevelEnabler: c.LevelEnabler, enc: enc, ring: c.ring}
+}
+
+// Check 检查是否需要记录
+func (c *RingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write 写入环形缓冲，覆盖最早的日志
+func (c *RingCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	line := strings.TrimRight(buf.String(), "\n")
+	buf.Free()
+	r := c.ring
+	r.mu.Lock()
+	r.lines[r.next] = line
+	if r.next++; r.next == len(r.lines) {
+		r.next, r.full = 0, true
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+// Sync 无需同步
+func (c *RingCore) Sync() error {
+	return nil
+}
+
+// Lines 最近的日志，从早到晚排列
+func (c *RingCore) Lines() []string {
+	r := c.ring
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]string(nil), r.lines[:r.next]...)
+	}
+	return append(append([]string(nil), r.lines[r.next:]...), r.lines[:r.next]...)
+}
+
+// CrashReport 一次panic的报告
+type CrashReport struct {
+	Time  time.Time
+	Panic any
+	Stack []byte // 发生panic的协程的调用栈
+	File  string // 报告文件，写入失败时为空
+}
+
+// Error 实现error接口
+func (r *CrashReport) Error() string {
+	return fmt.Sprintf("panic: %v", r.Panic)
+}
+
+// HandlePanic 处理recover()得到的值，写入崩溃报告并记录日志，rethrow时再次panic
+func HandlePanic(v any, rethrow bool) *CrashReport {
+	report := &CrashReport{Time: time.Now(), Panic: v, Stack: debug.Stack()}
+	file, err := report.WriteFile(getCrashDir())
+	if err == nil {
+		report.File = file
+	}
+	if logger := getLogger(); logger != nil {
+		kvs := []any{"panic", fmt.Sprint(v), "report", report.File}
+		if report.File == "" { // 没有报告文件时记下调用栈
+			kvs = append(kvs, "stack", string(report.Stack))
+		}
+		logger.Errorw("panic recovered", kvs...)
+	}
+	if rethrow {
+		panic(v)
+	}
+	return report
+}
+
+// Recover 在defer中直接调用，捕获panic，rethrow时写完报告后再次panic
+func Recover(rethrow bool) {
+	if v := recover(); v != nil {
+		HandlePanic(v, rethrow)
+	}
+}
+
+// Go 启动协程，捕获其中的panic
+func Go(fn func()) {
+	go func() {
+		defer Recover(false)
+		fn()
+	}()
+}
+
+// WriteFile 在目录下写入报告文件，包括调用栈、编译信息、最近日志和全部协程
+func (r *CrashReport) WriteFile(dir string) (string, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("crash-%s-%d-%d.log", r.Time.Format(crashTimeFormat), os.Getpid(), crashSeq.Add(1))
+	file := filepath.Join(dir, name)
+	return file, os.WriteFile(file, r.Bytes(), 0o644)
+}
+
+// Bytes 报告内容
+func (r *CrashReport) Bytes() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "time: %s\npanic: %v\npid: %d\nargs: %s\n",
+		r.Time.Format(time.RFC3339Nano), r.Panic, os.Getpid(), strings.Join(os.Args, " "))
+	fmt.Fprintf(&buf, "\n== stack ==\n%s", r.Stack)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		fmt.Fprintf(&buf, "\n== build ==\n%s", info)
+	} else {
+		fmt.Fprintf(&buf, "\n== build ==\ngo\t%s\n", runtime.Version())
+	}
+	if ring := recentLogs.Load(); ring != nil {
+		buf.WriteString("\n== recent logs ==\n")
+		for _, line := range ring.Lines() {
+			buf.WriteString(line + "\n")
+		}
+	}
+	fmt.Fprintf(&buf, "\n== goroutines ==\n%s", allStacks())
+	return buf.Bytes()
+}
+
+// allStacks 全部协程的调用栈
+func allStacks() []byte {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+}
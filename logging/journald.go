@@ -0,0 +1,160 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/form/v4"
+	"go.uber.org/zap"
+)
+
+// JournalSocket journald原生协议的默认套接字
+const JournalSocket = "/run/systemd/journal/socket"
+
+// journalReserved journald的可信字段，日志字段同名时加上FIELD_前缀，避免覆盖
+var journalReserved = map[string]bool{
+	"MESSAGE": true, "MESSAGE_ID": true, "PRIORITY": true, "SYSLOG_IDENTIFIER": true,
+	"SYSLOG_FACILITY": true, "SYSLOG_PID": true, "SYSLOG_TIMESTAMP": true, "SYSLOG_RAW": true,
+	"CODE_FILE": true, "CODE_LINE": true, "CODE_FUNC": true, "ERRNO": true, "TID": true,
+	"INVOCATION_ID": true, "USER_INVOCATION_ID": true, "UNIT": true, "USER_UNIT": true,
+	"DOCUMENTATION": true, "LOGGER": true, "STACKTRACE": true,
+}
+
+// journald 注册的journald地址，例如 journald:// 或 journald:///run/systemd/journal/socket?app=web
+func journald(u *url.URL) (zap.Sink, error) {
+	return NewJournalWriter(u)
+}
+
+// JournalWriter 使用journald原生协议写入系统日志
+type JournalWriter struct {
+	Socket     string `form:"-"`
+	AppName    string `form:"app"` // SYSLOG_IDENTIFIER，默认为程序名
+	TimeFormat string `form:"tf"`  // 解析日志时间的格式
+	conn       *net.UnixConn
+	mu         sync.Mutex
+}
+
+// NewJournalWriter 根据URL创建，没有路径时使用默认套接字
+func NewJournalWriter(u *url.URL) (*JournalWriter, error) {
+	w := &JournalWriter{Socket: u.Path}
+	if err := form.NewDecoder().Decode(w, u.Query()); err != nil {
+		return nil, err
+	}
+	if w.Socket == "" || w.Socket == "/" {
+		w.Socket = JournalSocket
+	}
+	if w.AppName == "" {
+		w.AppName = filepath.Base(os.Args[0])
+	}
+	return w, nil
+}
+
+// Write 解析编码后的日志再发送，只用于直接作为zap.Sink使用时
+func (w *JournalWriter) Write(p []byte) (int, error) {
+	if err := w.WriteEntry(parseEntry(p, w.TimeFormat)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteEntry 实现EntryWriter，每条日志作为一个数据报发送，超过套接字的上限时改为传递临时文件
+func (w *JournalWriter) WriteEntry(e *LogEntry) error {
+	data := w.Format(e)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		addr := &net.UnixAddr{Name: w.Socket, Net: "unixgram"}
+		conn, err := net.DialUnix("unixgram", nil, addr)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+	}
+	_, err := w.conn.Write(data)
+	if err != nil && isMsgTooLarge(err) {
+		err = sendJournalFile(w.conn, data)
+	}
+	return err
+}
+
+// Format 生成journald原生协议的数据
+func (w *JournalWriter) Format(e *LogEntry) []byte {
+	var buf bytes.Buffer
+	writeJournalField(&buf, "MESSAGE", e.Message)
+	writeJournalField(&buf, "PRIORITY", fmt.Sprint(entrySeverity(e)))
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", w.AppName)
+	if e.Name != "" {
+		writeJournalField(&buf, "LOGGER", e.Name)
+	}
+	if e.Caller != "" {
+		file, line, _ := strings.Cut(e.Caller, ":")
+		writeJournalField(&buf, "CODE_FILE", file)
+		writeJournalField(&buf, "CODE_LINE", line)
+	}
+	if e.Stack != "" {
+		writeJournalField(&buf, "STACKTRACE", e.Stack)
+	}
+	for _, key := range sortedKeys(e.Fields) {
+		if name := JournalFieldName(key); name != "" {
+			writeJournalField(&buf, name, fmt.Sprint(e.Fields[key]))
+		}
+	}
+	return buf.Bytes()
+}
+
+// Sync 无需同步
+func (w *JournalWriter) Sync() error {
+	return nil
+}
+
+// Close 关闭连接
+func (w *JournalWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// JournalFieldName 转为journald字段名，只能是大写字母、数字和下划线
+// 下划线开头的是journald自己添加的字段，忽略，和可信字段同名的加上FIELD_前缀
+func JournalFieldName(key string) string {
+	if strings.HasPrefix(key, "_") {
+		return ""
+	}
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return '_'
+	}, key)
+	name = strings.TrimLeft(name, "_0123456789")
+	if journalReserved[name] {
+		name = "FIELD_" + name
+	}
+	return name[:min(len(name), 64)]
+}
+
+// writeJournalField 写入一个字段，多行的值使用长度前缀
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		buf.WriteString(name + "=" + value + "\n")
+		return
+	}
+	buf.WriteString(name + "\n")
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value + "\n")
+}
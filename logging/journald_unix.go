@@ -0,0 +1,47 @@
+//go:build unix
+
+package logging
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+)
+
+// isMsgTooLarge 数据报是否超过了套接字的上限
+func isMsgTooLarge(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)
+}
+
+// sendJournalFile 数据写入删除后的临时文件，再通过套接字传递文件描述符，journald会读取文件内容
+func sendJournalFile(conn *net.UnixConn, data []byte) error {
+	dir := "/dev/shm"
+	if _, err := os.Stat(dir); err != nil {
+		dir = os.TempDir()
+	}
+	f, err := os.CreateTemp(dir, "journal.*")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = os.Remove(f.Name()); err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		return err
+	}
+	raw, err := conn.SyscallConn() // 已连接的数据报套接字不能用WriteMsgUnix
+	if err != nil {
+		return err
+	}
+	rights := syscall.UnixRights(int(f.Fd()))
+	errCtrl := raw.Write(func(fd uintptr) bool {
+		err = syscall.Sendmsg(int(fd), nil, rights, nil, 0)
+		return err != syscall.EAGAIN
+	})
+	if errCtrl != nil {
+		return errCtrl
+	}
+	return err
+}
@@ -0,0 +1,55 @@
+//go:build unix
+
+package logging_test
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/azhai/gozzo/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournaldLargeEntry(t *testing.T) {
+	dir, err := os.MkdirTemp("", "journal")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	zl := logging.NewLoggerURL("info", "journald://"+socket+"?app=test")
+	zl.Infow("large entry", "body", strings.Repeat("x", 1<<20)) // 超过数据报的上限
+
+	buf, oob := make([]byte, 4096), make([]byte, 64)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if !assert.NoError(t, err) {
+		return
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if !assert.NoError(t, err) || !assert.Len(t, msgs, 1) {
+		return
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if !assert.NoError(t, err) || !assert.Len(t, fds, 1) {
+		return
+	}
+	f := os.NewFile(uintptr(fds[0]), "journal")
+	defer f.Close()
+	_, _ = f.Seek(0, io.SeekStart)
+	data, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "MESSAGE=large entry\n"))
+	assert.Greater(t, len(data), 1<<20)
+}
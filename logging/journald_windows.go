@@ -0,0 +1,16 @@
+//go:build windows
+
+package logging
+
+import (
+	"errors"
+	"net"
+)
+
+func isMsgTooLarge(_ error) bool {
+	return false
+}
+
+func sendJournalFile(_ *net.UnixConn, _ []byte) error {
+	return errors.New("journald is not supported on windows")
+}
@@ -1,10 +1,25 @@
 package logging_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/azhai/gozzo/logging"
+	"github.com/azhai/gozzo/logging/adapters/gormlog"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 var (
@@ -23,3 +38,411 @@ func Test11Info(t *testing.T) {
 	logger.Errorf("now is %s", NowTime())
 	// assert.NoError(t, err)
 }
+
+func Test21Dedup(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	zl := zap.New(logging.NewDedupCore(core, time.Minute))
+	for i := 0; i < 100; i++ {
+		zl.Error("dependency is down")
+	}
+	zl.Warn("another message")
+	assert.Equal(t, 2, logs.Len())
+	assert.NoError(t, zl.Sync())
+	entries := logs.FilterMessage("dependency is down").All()
+	assert.Len(t, entries, 2)
+	assert.Equal(t, int64(99), entries[1].ContextMap()[logging.RepeatedKey])
+
+	// 子内核的重复次数由父内核补记，并带有子内核的字段
+	child := zl.With(zap.String("req", "r1"))
+	for i := 0; i < 10; i++ {
+		child.Error("dependency is down")
+	}
+	zl.Error("dependency is down")
+	assert.NoError(t, zl.Sync())
+	entries = logs.FilterMessage("dependency is down").All()
+	assert.Len(t, entries, 5)
+	assert.Equal(t, int64(9), entries[4].ContextMap()[logging.RepeatedKey])
+	assert.Equal(t, "r1", entries[4].ContextMap()["req"])
+}
+
+func Test22Sampling(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	s := &logging.Sampling{Interval: time.Minute, First: 3, Thereafter: 10}
+	zl := zap.New(s.Wrap(core))
+	for i := 0; i < 100; i++ {
+		zl.Error("dependency is down")
+	}
+	assert.Equal(t, 3+9, logs.Len())
+}
+
+func Test23Reader(t *testing.T) {
+	dir := t.TempDir()
+	backup, err := os.Create(filepath.Join(dir, "app-20240101-000000.log.gz"))
+	assert.NoError(t, err)
+	gz := gzip.NewWriter(backup)
+	_, _ = gz.Write([]byte(`{"L":"ERROR","T":"2023-12-31 23:59:59","M":"old error","uid":7,"order":9007199254740993}` + "\n"))
+	assert.NoError(t, gz.Close())
+	assert.NoError(t, backup.Close())
+
+	zl := logging.NewLoggerURL("debug", filepath.Join(dir, "app.log"))
+	zl.Infow("new info", "uid", 7)
+	zl.Errorw("new error", "uid", 8)
+	assert.NoError(t, zl.Sync())
+
+	reader, err := logging.NewLogReaderURL(filepath.Join(dir, "app.log"), "")
+	assert.NoError(t, err)
+	files, err := reader.Files()
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	var msgs []string
+	q := &logging.LogQuery{MinLevel: "warn"}
+	err = reader.Query(q, func(e *logging.LogEntry) bool {
+		msgs = append(msgs, e.Message)
+		return true
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old error", "new error"}, msgs)
+
+	msgs = msgs[:0]
+	q = &logging.LogQuery{Fields: map[string]string{"uid": "7"}}
+	err = reader.Query(q, func(e *logging.LogEntry) bool {
+		msgs = append(msgs, e.Message)
+		return true
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old error", "new info"}, msgs)
+
+	msgs = msgs[:0]
+	q = &logging.LogQuery{Fields: map[string]string{"order": "9007199254740993"}}
+	err = reader.Query(q, func(e *logging.LogEntry) bool {
+		msgs = append(msgs, e.Message)
+		return true
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old error"}, msgs)
+}
+
+// slowWriter 等待放行后才写入
+type slowWriter struct {
+	bytes.Buffer
+	gate chan struct{}
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	<-w.gate
+	return w.Buffer.Write(p)
+}
+
+func (w *slowWriter) Sync() error {
+	return nil
+}
+
+// failWriter 记录每次写入，fail为真时写入失败
+type failWriter struct {
+	writes []string
+	fail   bool
+}
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	if w.fail {
+		return 0, errors.New("disk is full")
+	}
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+func (w *failWriter) Sync() error {
+	return nil
+}
+
+func Test24AsyncWriter(t *testing.T) {
+	ws := &slowWriter{gate: make(chan struct{})}
+	w := logging.NewAsyncWriter("slow", ws, &logging.Buffer{Size: 2})
+	enc := zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig())
+	zl := zap.New(w.WrapCore(zapcore.NewCore(enc, w, zapcore.DebugLevel)))
+	for i := 0; i < 10; i++ {
+		zl.Info("waiting")
+	}
+	close(ws.gate)
+	assert.NoError(t, zl.Sync())
+	zl.Error("flush now")
+	stats := w.Stats()
+	assert.Greater(t, stats.Dropped, int64(0))
+	assert.Equal(t, int64(11), stats.Written+stats.Dropped)
+	assert.Contains(t, ws.String(), "flush now")
+	assert.NoError(t, w.Stop())
+	assert.Empty(t, logging.GetAsyncStats())
+	_, err := w.Write([]byte("stopped\n"))
+	assert.ErrorIs(t, err, logging.ErrWriterStopped)
+
+	// 每次写入的都是完整的日志，写入失败后的日志仍然可以写入
+	fw := &failWriter{fail: true}
+	w = logging.NewAsyncWriter("fail", fw, &logging.Buffer{Block: true})
+	_, _ = w.Write([]byte("lost\n"))
+	assert.Error(t, w.Sync())
+	fw.fail = false
+	line := strings.Repeat("x", 100*1024) + "\n"
+	for i := 0; i < 5; i++ {
+		_, _ = w.Write([]byte(line))
+	}
+	assert.NoError(t, w.Sync())
+	assert.Greater(t, len(fw.writes), 1)
+	for _, data := range fw.writes {
+		assert.Zero(t, len(data)%len(line))
+	}
+	stats = w.Stats()
+	assert.Equal(t, int64(1), stats.Dropped)
+	assert.Equal(t, int64(5), stats.Written)
+	assert.NoError(t, w.Stop())
+}
+
+func Test25CloseLogger(t *testing.T) {
+	cfg := logging.SingleFileConfig("info", "app.log")
+	cfg.Outputs[0].Buffer = &logging.Buffer{FlushInterval: time.Hour}
+	zl := logging.NewLoggerCustom(cfg, t.TempDir())
+	zl.Info("buffered")
+	assert.Len(t, logging.GetAsyncStats(), 1)
+	child := zl.With("req", "r1")
+	obs, restore := logging.ObserveLogger("info")
+	defer restore()
+	assert.NoError(t, logging.CloseLogger(zl))
+	assert.Empty(t, logging.GetAsyncStats())
+	data, err := os.ReadFile(cfg.Outputs[0].OutPaths[0])
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "buffered")
+
+	// 关闭后写入的日志转给日志单例，不会丢失
+	child.Info("after close")
+	entries := obs.FilterMessage("after close").All()
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "r1", entries[0].ContextMap()["req"])
+	}
+}
+
+type userInfo struct {
+	Name   string `json:"name"`
+	Mobile string `json:"mobile" log:"sensitive"`
+	Salt   string `json:"salt"`
+	Remark string `json:"remark"`
+}
+
+func Test26Redaction(t *testing.T) {
+	var buf bytes.Buffer
+	red := &logging.Redaction{Keys: []string{"*password*", "salt", "api_key"}}
+	ec := logging.NewEncoderConfig("", "cap")
+	enc := red.Wrap(logging.NewEncoder("json", ec))
+	zl := zap.New(zapcore.NewCore(enc, zapcore.AddSync(&buf), zapcore.DebugLevel))
+	zl = zl.With(zap.String("api_key", "abcdef"))
+	user := userInfo{Name: "alice", Mobile: "13812345678", Salt: "xyz", Remark: "mail alice@example.com"}
+	zl.Info("login from 13912345678", zap.String("password", "secret"), zap.Any("user", user))
+	out := buf.String()
+	assert.NotContains(t, out, "13912345678")
+	assert.NotContains(t, out, "13812345678")
+	assert.NotContains(t, out, "abcdef")
+	assert.NotContains(t, out, "alice@example.com")
+	assert.Contains(t, out, `"password":"***"`)
+	assert.Contains(t, out, `"mobile":"***"`)
+	assert.Contains(t, out, `"salt":"***"`)
+	assert.Contains(t, out, `"name":"alice"`)
+	assert.Contains(t, out, "13*******78")
+}
+
+// account 实现zapcore.ObjectMarshaler
+type account struct {
+	Password string
+	Emails   []string
+}
+
+func (a account) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("password", a.Password)
+	return enc.AddArray("emails", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+		for _, email := range a.Emails {
+			arr.AppendString(email)
+		}
+		return nil
+	}))
+}
+
+// cardNo 实现fmt.Stringer
+type cardNo string
+
+func (c cardNo) String() string {
+	return "card " + string(c)
+}
+
+// cardJSON 实现json.Marshaler
+type cardJSON string
+
+func (c cardJSON) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"card": string(c)})
+}
+
+func Test27RedactionMarshaler(t *testing.T) {
+	var buf bytes.Buffer
+	red := &logging.Redaction{}
+	enc := red.Wrap(logging.NewEncoder("json", logging.NewEncoderConfig("", "cap")))
+	zl := zap.New(zapcore.NewCore(enc, zapcore.AddSync(&buf), zapcore.DebugLevel))
+	acc := account{Password: "secret", Emails: []string{"bob@example.com"}}
+	zl.Info("card 4111111111111111, order 1700000000123456789",
+		zap.Object("account", acc), zap.Array("accounts", zapcore.ArrayMarshalerFunc(
+			func(arr zapcore.ArrayEncoder) error { return arr.AppendObject(acc) })))
+	out := buf.String()
+	assert.NotContains(t, out, "secret")
+	assert.NotContains(t, out, "bob@example.com")
+	assert.NotContains(t, out, "4111111111111111")
+	assert.Contains(t, out, "1700000000123456789")
+	assert.Contains(t, out, `"password":"***"`)
+
+	// 身份证号需要通过校验，Stringer和json.Marshaler的输出也要脱敏
+	buf.Reset()
+	zl.Info("id 11010519491231002X, order 110105194912310021",
+		zap.Stringer("card", cardNo("4111111111111111")),
+		zap.Any("cards", []any{cardJSON("4111111111111111"), cardNo("4111111111111111")}))
+	out = buf.String()
+	assert.NotContains(t, out, "11010519491231002X")
+	assert.Contains(t, out, "110105194912310021")
+	assert.NotContains(t, out, "4111111111111111")
+}
+
+func Test28Observer(t *testing.T) {
+	obs, restore := logging.ObserveLogger("info")
+	defer restore()
+	logging.Debug("hidden")
+	logging.Infow("user login", "uid", 42)
+	logging.Errorf("db is %s", "down")
+	obs.AssertMessage(t, "login")
+	obs.AssertNoMessage(t, "hidden")
+	obs.AssertLevelCount(t, "error", 1)
+	obs.AssertField(t, "uid", 42)
+
+	gl, gobs := gormlog.NewObserved("debug")
+	gl.Trace(context.Background(), time.Now(), func() (string, int64) {
+		return "SELECT * FROM users WHERE password = 'abc'", 1
+	}, nil)
+	gobs.AssertField(t, "db.table", "users")
+	gobs.AssertNoMessage(t, "abc")
+}
+
+func Test29CrashReport(t *testing.T) {
+	obs, restore := logging.ObserveLogger("debug")
+	defer restore()
+	logging.EnableCrashReport(t.TempDir(), 5)
+	defer logging.EnableCrashReport("", 0)
+	logging.Infow("before crash", "step", 1)
+
+	func() {
+		defer logging.Recover(false)
+		panic("something broken")
+	}()
+	obs.AssertMessage(t, "panic recovered")
+	entries := obs.FilterMessage("panic recovered").All()
+	if assert.Len(t, entries, 1) {
+		file := entries[0].ContextMap()["report"].(string)
+		data, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		assert.Contains(t, string(data), "panic: something broken")
+		assert.Contains(t, string(data), "before crash")
+		assert.Contains(t, string(data), "== goroutines ==")
+	}
+
+	report := &logging.CrashReport{Time: time.Now(), Panic: "same time"}
+	first, err := report.WriteFile(t.TempDir())
+	assert.NoError(t, err)
+	second, err := report.WriteFile(filepath.Dir(first))
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+}
+
+func Test30Syslog(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	zl := logging.NewLoggerURL("info", "syslog://"+conn.LocalAddr().String()+"?app=test&facility=local0")
+	zl.Errorw("db is down", "user_id", 7)
+	buf := make([]byte, 4096)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(t, err)
+	msg := string(buf[:n])
+	assert.True(t, strings.HasPrefix(msg, "<131>1 "), msg) // local0*8 + error
+	assert.Contains(t, msg, " test ")
+	assert.Contains(t, msg, `[fields@32473 user_id="7"] db is down`)
+}
+
+func Test31SyslogCustomFormat(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	cfg := logging.SingleFileConfig("info", "syslog://"+conn.LocalAddr().String())
+	cfg.TimeFormat, cfg.LevelCase = "15:04:05 Jan 2", "none"
+	cfg.Redaction = &logging.Redaction{}
+	zl := logging.NewLoggerCustom(cfg, "")
+	zl.With("password", "secret").Warnw("slow query", "elapsed", 1.5)
+	buf := make([]byte, 4096)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(t, err)
+	msg := string(buf[:n])
+	assert.True(t, strings.HasPrefix(msg, "<12>1 "), msg) // user*8 + warning
+	assert.Contains(t, msg, `[fields@32473 elapsed="1.5" password="***"] slow query`)
+}
+
+func Test32Journald(t *testing.T) {
+	dir, err := os.MkdirTemp("", "journal")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	zl := logging.NewLoggerURL("info", "journald://"+socket+"?app=test")
+	zl.Warnw("disk is full", "mount.point", "/data", "priority", "high", "_pid", 1)
+	buf := make([]byte, 4096)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	assert.NoError(t, err)
+	msg := string(buf[:n])
+	assert.Contains(t, msg, "MESSAGE=disk is full\n")
+	assert.Contains(t, msg, "PRIORITY=4\n")
+	assert.Contains(t, msg, "SYSLOG_IDENTIFIER=test\n")
+	assert.Contains(t, msg, "MOUNT_POINT=/data\n")
+	assert.Contains(t, msg, "FIELD_PRIORITY=high\n") // 不能覆盖可信字段
+	assert.NotContains(t, msg, "PID=")
+}
+
+func Test33SyslogTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer ln.Close()
+	go func() { // 接受连接但不读取，写满缓冲后写入会阻塞
+		if conn, err := ln.Accept(); err == nil {
+			defer conn.Close()
+			time.Sleep(10 * time.Second)
+		}
+	}()
+	u, _ := url.Parse("syslog://" + ln.Addr().String() + "?net=tcp&timeout=1")
+	w, err := logging.NewSyslogWriter(u)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer w.Close()
+	entry := &logging.LogEntry{Time: time.Now(), Level: "info", Message: strings.Repeat("x", 1<<20)}
+	start := time.Now()
+	for i := 0; i < 64 && err == nil; i++ {
+		err = w.WriteEntry(entry)
+	}
+	var netErr net.Error
+	assert.True(t, errors.As(err, &netErr) && netErr.Timeout(), err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// TestingT testing.T的一部分，避免引入testing包
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// ObservedLogs 记录在内存中的日志，用于测试中检查输出
+type ObservedLogs struct {
+	*observer.ObservedLogs
+	Logger *zap.SugaredLogger
+}
+
+// NewObserver 创建内存中的记录器，只记录不低于level的日志
+func NewObserver(level string) *ObservedLogs {
+	_, lvl := GetZapLevel(level)
+	core, logs := observer.New(lvl)
+	return &ObservedLogs{ObservedLogs: logs, Logger: zap.New(core).Sugar()}
+}
+
+// ObserveLogger 用内存记录器替换日志单例，返回恢复原单例的函数
+func ObserveLogger(level string) (*ObservedLogs, func()) {
+	obs := NewObserver(level)
+	origin := SwapLogger(obs.Logger)
+	return obs, func() { SetLogger(origin) }
+}
+
+// ContainsMessage 是否有包含sub的消息
+func (o *ObservedLogs) ContainsMessage(sub string) bool {
+	return o.FilterMessageSnippet(sub).Len() > 0
+}
+
+// CountLevel 某个级别的日志条数
+func (o *ObservedLogs) CountLevel(level string) int {
+	_, lvl := GetZapLevel(level)
+	return o.FilterLevelExact(lvl).Len()
+}
+
+// HasField 是否有日志带有某个字段和值，数值按文字比较
+func (o *ObservedLogs) HasField(key string, value any) bool {
+	want := fmt.Sprint(value)
+	for _, entry := range o.All() {
+		if val, ok := entry.ContextMap()[key]; ok && fmt.Sprint(val) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// Messages 全部日志的消息
+func (o *ObservedLogs) Messages() []string {
+	entries := o.All()
+	result := make([]string, len(entries))
+	for i, entry := range entries {
+		result[i] = entry.Message
+	}
+	return result
+}
+
+// AssertMessage 断言有包含sub的消息
+func (o *ObservedLogs) AssertMessage(t TestingT, sub string) bool {
+	t.Helper()
+	if o.ContainsMessage(sub) {
+		return true
+	}
+	t.Errorf("no log message contains %q, got:\n\t%s", sub, strings.Join(o.Messages(), "\n\t"))
+	return false
+}
+
+// AssertNoMessage 断言没有包含sub的消息
+func (o *ObservedLogs) AssertNoMessage(t TestingT, sub string) bool {
+	t.Helper()
+	if !o.ContainsMessage(sub) {
+		return true
+	}
+	t.Errorf("unexpected log message contains %q", sub)
+	return false
+}
+
+// AssertLevelCount 断言某个级别的日志条数
+func (o *ObservedLogs) AssertLevelCount(t TestingT, level string, count int) bool {
+	t.Helper()
+	if n := o.CountLevel(level); n != count {
+		t.Errorf("expected %d %s logs, got %d", count, level, n)
+		return false
+	}
+	return true
+}
+
+// AssertField 断言有日志带有某个字段和值
+func (o *ObservedLogs) AssertField(t TestingT, key string, value any) bool {
+	t.Helper()
+	if o.HasField(key, value) {
+		return true
+	}
+	t.Errorf("no log has field %s=%v", key, value)
+	return false
+}
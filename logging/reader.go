@@ -0,0 +1,350 @@
+package logging
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxLineSize 单行日志的最大长度
+const maxLineSize = 1024 * 1024
+
+var (
+	// reColorCode 终端颜色代码
+	reColorCode = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+	// ParseTimeFormats 解析日志时间时依次尝试的格式
+	ParseTimeFormats = []string{
+		"2006-01-02 15:04:05",
+		"2006-01-02T15:04:05.000Z0700",
+		time.RFC3339Nano,
+		time.DateTime + ".000",
+	}
+)
+
+// LogEntry 从日志文件中解析出的一条记录
+type LogEntry struct {
+	Time    time.Time
+	Level   string
+	Name    string
+	Caller  string
+	Message string
+	Stack   string
+	Fields  map[string]any
+	File    string
+	Raw     string
+}
+
+// GetLevel 记录的日志级别，没有级别的记录当作info
+func (e *LogEntry) GetLevel() string {
+	if e.Level == "" {
+		return "info"
+	}
+	return e.Level
+}
+
+// MarshalJSON 转为JSON，字段与消息平铺
+func (e *LogEntry) MarshalJSON() ([]byte, error) {
+	data := make(map[string]any, len(e.Fields)+5)
+	for key, val := range e.Fields {
+		data[key] = val
+	}
+	data["time"], data["level"], data["msg"] = e.Time, e.GetLevel(), e.Message
+	if e.Caller != "" {
+		data["caller"] = e.Caller
+	}
+	if e.Stack != "" {
+		data["stack"] = e.Stack
+	}
+	return json.Marshal(data)
+}
+
+// LogQuery 日志过滤条件
+type LogQuery struct {
+	Since, Until       time.Time
+	MinLevel, MaxLevel string
+	Keyword            string
+	Fields             map[string]string
+}
+
+// Match 记录是否符合条件
+func (q *LogQuery) Match(e *LogEntry) bool {
+	if q == nil {
+		return true
+	}
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !e.Time.Before(q.Until) {
+		return false
+	}
+	if q.MinLevel != "" || q.MaxLevel != "" {
+		enabler := GetLevelEnabler(q.MinLevel, q.MaxLevel, "")
+		if _, lvl := GetZapLevel(e.GetLevel()); enabler == nil || !enabler.Enabled(lvl) {
+			return false
+		}
+	}
+	if q.Keyword != "" && !strings.Contains(e.Message, q.Keyword) {
+		return false
+	}
+	for key, want := range q.Fields {
+		val, ok := e.Fields[key]
+		if !ok || fmt.Sprint(val) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// LogReader 读取当前日志和它的历史备份
+type LogReader struct {
+	TimeFormat string
+	*RotateFile
+}
+
+// NewLogReader 创建日志读取器，timeFormat为写日志时使用的时间格式
+func NewLogReader(file *RotateFile, timeFormat string) *LogReader {
+	return &LogReader{TimeFormat: timeFormat, RotateFile: file}
+}
+
+// NewLogReaderURL 根据文件路径或rotate地址创建日志读取器
+func NewLogReaderURL(rawURL, timeFormat string) (*LogReader, error) {
+	path, err := GetAbsPath(rawURL, false)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := NewRotateFile(u)
+	if err != nil {
+		return nil, err
+	}
+	return NewLogReader(file, timeFormat), nil
+}
+
+// Files 全部日志文件，按时间从旧到新排列，当前日志在最后
+func (r *LogReader) Files() ([]string, error) {
+	backups, err := r.oldLogFiles()
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(backups)+1)
+	for i := len(backups) - 1; i >= 0; i-- {
+		files = append(files, filepath.Join(r.dir(), backups[i].Name()))
+	}
+	if _, err = osStat(r.filename()); err == nil {
+		files = append(files, r.filename())
+	}
+	return files, nil
+}
+
+// Query 按时间顺序查找符合条件的记录，回调返回false时停止
+func (r *LogReader) Query(q *LogQuery, fn func(e *LogEntry) bool) error {
+	files, err := r.Files()
+	if err != nil {
+		return err
+	}
+	var stop bool
+	for _, file := range files {
+		err = r.ReadFile(file, func(e *LogEntry) bool {
+			if q.Match(e) && !fn(e) {
+				stop = true
+			}
+			return !stop
+		})
+		if err != nil || stop {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadFile 读取单个日志文件，压缩文件自动解压
+func (r *LogReader) ReadFile(file string, fn func(e *LogEntry) bool) error {
+	rd, err := OpenLogFile(file)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	var last *LogEntry
+	for scanner.Scan() {
+		line := scanner.Text()
+		e := ParseLogLine(line, r.TimeFormat)
+		if e == nil { // 不能解析的行当作上一条记录的堆栈
+			if last != nil {
+				last.Stack = strings.TrimLeft(last.Stack+"\n"+line, "\n")
+				last.Raw += "\n" + line
+			}
+			continue
+		}
+		e.File = file
+		if last != nil && !fn(last) {
+			return nil
+		}
+		last = e
+	}
+	if last != nil {
+		fn(last)
+	}
+	return scanner.Err()
+}
+
+// OpenLogFile 打开日志文件，以.gz结尾的文件自动解压
+func OpenLogFile(file string) (io.ReadCloser, error) {
+	fp, err := os.Open(file)
+	if err != nil || !strings.HasSuffix(file, compressSuffix) {
+		return fp, err
+	}
+	gz, err := gzip.NewReader(fp)
+	if err != nil {
+		fp.Close()
+		return nil, err
+	}
+	return &gzipFile{Reader: gz, file: fp}, nil
+}
+
+// gzipFile 关闭时同时关闭解压器和文件
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+// Close implements io.Closer
+func (f *gzipFile) Close() error {
+	err := f.Reader.Close()
+	if errClose := f.file.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
+
+// ParseLogLine 解析一行JSON或console格式的日志，不能解析时返回nil
+func ParseLogLine(line, timeFormat string) *LogEntry {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "{") {
+		return parseJSONLine(line, timeFormat)
+	}
+	return parseConsoleLine(line, timeFormat)
+}
+
+// parseLogTime 解析日志时间
+func parseLogTime(value, timeFormat string) (t time.Time, err error) {
+	if timeFormat != "" {
+		if t, err = time.ParseInLocation(timeFormat, value, time.Local); err == nil {
+			return
+		}
+	}
+	for _, layout := range ParseTimeFormats {
+		if t, err = time.ParseInLocation(layout, value, time.Local); err == nil {
+			return
+		}
+	}
+	return
+}
+
+// parseLogLevel 识别日志级别，忽略大小写和颜色
+func parseLogLevel(value string) (string, bool) {
+	value = strings.ToLower(reColorCode.ReplaceAllString(value, ""))
+	_, ok := LogLevels[value]
+	return value, ok
+}
+
+// parseConsoleLine 解析console格式，各部分以tab分隔，最后可能是JSON格式的字段
+func parseConsoleLine(line, timeFormat string) *LogEntry {
+	parts := strings.Split(line, "\t")
+	t, err := parseLogTime(parts[0], timeFormat)
+	if err != nil {
+		return nil
+	}
+	e := &LogEntry{Time: t, Raw: line}
+	parts = parts[1:]
+	if len(parts) > 0 {
+		if lvl, ok := parseLogLevel(parts[0]); ok {
+			e.Level, parts = lvl, parts[1:]
+		}
+	}
+	if n := len(parts); n > 1 && strings.HasPrefix(parts[n-1], "{") {
+		if err = decodeJSON(parts[n-1], &e.Fields); err == nil {
+			parts = parts[:n-1]
+		}
+	}
+	if n := len(parts); n > 0 {
+		e.Message = parts[n-1]
+		if n > 2 {
+			e.Name, e.Caller = parts[0], parts[1]
+		} else if n > 1 && strings.Contains(parts[0], ".go:") {
+			e.Caller = parts[0]
+		} else if n > 1 {
+			e.Name = parts[0]
+		}
+	}
+	return e
+}
+
+// jsonKeys JSON格式中各部分可能使用的键名，包括开发和生产两种配置
+var jsonKeys = map[string][]string{
+	"time":   {"T", "ts", "time"},
+	"level":  {"L", "level"},
+	"name":   {"N", "logger"},
+	"caller": {"C", "caller"},
+	"msg":    {"M", "msg"},
+	"stack":  {"S", "stacktrace"},
+}
+
+// decodeJSON 解码JSON，数字保留为json.Number，避免大整数丢失精度
+func decodeJSON(text string, v any) error {
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// parseJSONLine 解析JSON格式
+func parseJSONLine(line, timeFormat string) *LogEntry {
+	var data map[string]any
+	if err := decodeJSON(line, &data); err != nil {
+		return nil
+	}
+	pop := func(name string) any {
+		for _, key := range jsonKeys[name] {
+			if val, ok := data[key]; ok {
+				delete(data, key)
+				return val
+			}
+		}
+		return nil
+	}
+	popString := func(name string) string {
+		if val := pop(name); val != nil {
+			return fmt.Sprint(val)
+		}
+		return ""
+	}
+	e := &LogEntry{Raw: line}
+	switch val := pop("time").(type) {
+	case string:
+		e.Time, _ = parseLogTime(val, timeFormat)
+	case json.Number: // 时间戳，单位秒
+		ts, _ := val.Float64()
+		sec := int64(ts)
+		e.Time = time.Unix(sec, int64((ts-float64(sec))*1e9))
+	}
+	e.Level, _ = parseLogLevel(popString("level"))
+	e.Name, e.Caller = popString("name"), popString("caller")
+	e.Message, e.Stack = popString("msg"), popString("stack")
+	if len(data) > 0 {
+		e.Fields = data
+	}
+	return e
+}
@@ -0,0 +1,507 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/azhai/gozzo/mapper"
+	"github.com/azhai/gozzo/match"
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	RedactMask = "***" // 敏感字段值的替代文字
+	RedactTag  = "log" // 结构体标签，log:"sensitive"表示字段敏感，log:"-"表示不输出
+)
+
+// DefaultRedactKeys 默认的敏感字段名，支持通配符
+var DefaultRedactKeys = []string{
+	"*password*", "*passwd*", "*secret*", "*token*", "salt",
+	"authorization", "cookie", "*id_card*", "*idcard*", "*bank_card*",
+}
+
+// RedactRule 内置的脱敏规则
+type RedactRule struct {
+	Name   string
+	Regexp *regexp.Regexp
+	Check  func(string) bool // 进一步校验匹配的内容，为空时全部隐藏
+}
+
+// RedactRules 内置的脱敏规则，按顺序替换
+var RedactRules = []RedactRule{
+	{"jwt", regexp.MustCompile(`\beyJ[\w-]+\.[\w-]+\.[\w-]+`), nil},
+	{"bearer", regexp.MustCompile(`(?i)\bbearer\s+[\w.~+/-]+=*`), nil},
+	{"email", regexp.MustCompile(`[\w.+-]+@[\w-]+(\.[\w-]+)+`), nil},
+	// 身份证号和银行卡号都只隐藏通过校验的，避免误伤时间戳、订单号等长数字
+	{"idcard", regexp.MustCompile(`\b[1-9]\d{16}[\dXx]\b`), IsIDCardValid},
+	{"bankcard", regexp.MustCompile(`\b[1-9]\d{15,18}\b`), IsLuhnValid},
+	{"mobile", regexp.MustCompile(`\b1[3-9]\d{9}\b`), nil},
+}
+
+// IsLuhnValid 数字串是否通过Luhn校验，银行卡号的最后一位是校验位
+func IsLuhnValid(digits string) bool {
+	sum, double := 0, false
+	for i := len(digits) - 1; i >= 0; i-- {
+		n := int(digits[i] - '0')
+		if n < 0 || n > 9 {
+			return false
+		}
+		if double {
+			if n *= 2; n > 9 {
+				n -= 9
+			}
+		}
+		sum, double = sum+n, !double
+	}
+	return len(digits) > 0 && sum%10 == 0
+}
+
+// IsIDCardValid 18位身份证号是否通过GB 11643的校验，最后一位是按前17位加权求和模11的校验码
+func IsIDCardValid(id string) bool {
+	if len(id) != 18 {
+		return false
+	}
+	weights := [17]int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	sum := 0
+	for i, w := range weights {
+		n := int(id[i] - '0')
+		if n < 0 || n > 9 {
+			return false
+		}
+		sum += n * w
+	}
+	last := id[17]
+	if last == 'x' {
+		last = 'X'
+	}
+	return "10X98765432"[sum%11] == last
+}
+
+// Redaction 脱敏配置
+type Redaction struct {
+	Keys     []string // 敏感字段名，支持通配符，不分大小写，为空时使用默认的
+	Patterns []string // 正则表达式，在消息和字符串值中匹配的内容部分隐藏
+	Rules    []string // 启用的内置规则，为空时全部启用，none表示不启用
+	redactor *Redactor
+}
+
+// Compile 编译规则，只编译一次
+func (c *Redaction) Compile() (*Redactor, error) {
+	if c.redactor != nil {
+		return c.redactor, nil
+	}
+	keys := c.Keys
+	if len(keys) == 0 {
+		keys = DefaultRedactKeys
+	}
+	lowers := make([]string, len(keys))
+	for i, key := range keys {
+		lowers[i] = strings.ToLower(key)
+	}
+	r := &Redactor{keys: match.NewGlobs(lowers)}
+	for _, rule := range RedactRules {
+		if len(c.Rules) == 0 || slices.Contains(c.Rules, rule.Name) {
+			r.rules = append(r.rules, rule)
+		}
+	}
+	for _, pattern := range c.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", pattern, err)
+		}
+		r.rules = append(r.rules, RedactRule{Name: pattern, Regexp: re})
+	}
+	c.redactor = r
+	return r, nil
+}
+
+// Wrap 包装编码器，配置为空或有错时返回原编码器
+func (c *Redaction) Wrap(enc zapcore.Encoder) zapcore.Encoder {
+	if c == nil {
+		return enc
+	}
+	if r, err := c.Compile(); err == nil {
+		return r.WrapEncoder(enc)
+	}
+	return enc
+}
+
+// Redactor 脱敏处理，按字段名整体隐藏，按正则部分隐藏
+type Redactor struct {
+	keys  match.Globs
+	rules []RedactRule
+}
+
+// IsSensitiveKey 字段名是否敏感
+func (r *Redactor) IsSensitiveKey(key string) bool {
+	return r.keys.MatchAny(strings.ToLower(key), false)
+}
+
+// RedactString 隐藏文字中符合规则的部分
+func (r *Redactor) RedactString(s string) string {
+	for _, rule := range r.rules {
+		check := rule.Check
+		s = rule.Regexp.ReplaceAllStringFunc(s, func(m string) string {
+			if check != nil && !check(m) {
+				return m
+			}
+			return MaskText(m)
+		})
+	}
+	return s
+}
+
+// RedactField 处理一个日志字段
+func (r *Redactor) RedactField(f zapcore.Field) zapcore.Field {
+	if f.Type == zapcore.NamespaceType || f.Type == zapcore.SkipType {
+		return f
+	}
+	if r.IsSensitiveKey(f.Key) {
+		return zap.String(f.Key, RedactMask)
+	}
+	switch f.Type {
+	case zapcore.StringType:
+		f.String = r.RedactString(f.String)
+	case zapcore.ByteStringType:
+		return zap.String(f.Key, r.RedactString(string(f.Interface.([]byte))))
+	case zapcore.ErrorType:
+		if err, ok := f.Interface.(error); ok && err != nil {
+			return zap.String(f.Key, r.RedactString(err.Error()))
+		}
+	case zapcore.ReflectType:
+		return zap.Any(f.Key, r.RedactValue(f.Interface))
+	case zapcore.StringerType:
+		return zap.Stringer(f.Key, redactStringer{f.Interface.(fmt.Stringer), r})
+	case zapcore.ObjectMarshalerType:
+		return zap.Object(f.Key, redactObject{f.Interface.(zapcore.ObjectMarshaler), r})
+	case zapcore.ArrayMarshalerType:
+		return zap.Array(f.Key, redactArray{f.Interface.(zapcore.ArrayMarshaler), r})
+	}
+	return f
+}
+
+// RedactValue 处理结构体、哈希表和数组中的敏感内容
+func (r *Redactor) RedactValue(val any) any {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case string:
+		return r.RedactString(v)
+	case json.Marshaler: // 例如time.Time，输出的内容没有敏感信息时保持原样
+		data, err := v.MarshalJSON()
+		if err != nil {
+			return val
+		}
+		if text := r.RedactString(string(data)); text != string(data) {
+			return json.RawMessage(text)
+		}
+		return val
+	case error:
+		if text := r.RedactString(v.Error()); text != v.Error() {
+			return text
+		}
+		return val
+	case fmt.Stringer:
+		if text := r.RedactString(v.String()); text != v.String() {
+			return text
+		}
+		return val
+	}
+	rv := reflect.ValueOf(val)
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return val
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Struct:
+		return r.redactStruct(rv.Interface())
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return val
+		}
+		data := make(map[string]any, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			if r.IsSensitiveKey(key) {
+				data[key] = RedactMask
+			} else {
+				data[key] = r.RedactValue(iter.Value().Interface())
+			}
+		}
+		return data
+	case reflect.Slice, reflect.Array:
+		if !isNestedKind(rv.Type().Elem().Kind()) {
+			return val
+		}
+		items := make([]any, rv.Len())
+		for i := range items {
+			items[i] = r.RedactValue(rv.Index(i).Interface())
+		}
+		return items
+	}
+	return val
+}
+
+// redactStringer 输出时隐藏文字中符合规则的部分
+type redactStringer struct {
+	fmt.Stringer
+	redactor *Redactor
+}
+
+// String 实现fmt.Stringer
+func (s redactStringer) String() string {
+	return s.redactor.RedactString(s.Stringer.String())
+}
+
+// redactStruct 结构体转为哈希表，字段名使用json标签
+func (r *Redactor) redactStruct(obj any) map[string]any {
+	data := make(map[string]any)
+	_ = mapper.TravelStruct(obj, "json", true,
+		func(field *mapper.StructField, opt *mapper.TagOpt) error {
+			if !field.Value.CanInterface() {
+				return nil // 未导出的字段
+			}
+			switch field.GetTag(RedactTag) {
+			case "-":
+				return nil
+			case "sensitive":
+				data[opt.Name] = RedactMask
+				return nil
+			}
+			if r.IsSensitiveKey(opt.Name) {
+				data[opt.Name] = RedactMask
+			} else {
+				data[opt.Name] = r.RedactValue(field.Value.Interface())
+			}
+			return nil
+		})
+	return data
+}
+
+// isNestedKind 数组元素是否可能包含敏感内容
+func isNestedKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String, reflect.Struct, reflect.Map, reflect.Slice,
+		reflect.Array, reflect.Pointer, reflect.Interface:
+		return true
+	}
+	return false
+}
+
+// WrapEncoder 包装编码器，输出前隐藏敏感内容
+func (r *Redactor) WrapEncoder(enc zapcore.Encoder) zapcore.Encoder {
+	return &redactEncoder{Encoder: enc, redactor: r}
+}
+
+// MaskText 保留首尾少量字符，中间用星号代替
+func MaskText(s string) string {
+	rs := []rune(s)
+	keep := min(len(rs)/4, 4)
+	for i := keep; i < len(rs)-keep; i++ {
+		rs[i] = '*'
+	}
+	return string(rs)
+}
+
+// redactEncoder 脱敏编码器
+type redactEncoder struct {
+	zapcore.Encoder
+	redactor *Redactor
+}
+
+// Clone 复制编码器
+func (e *redactEncoder) Clone() zapcore.Encoder {
+	return &redactEncoder{Encoder: e.Encoder.Clone(), redactor: e.redactor}
+}
+
+// EncodeEntry 处理消息和字段后再编码
+func (e *redactEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	ent.Message = e.redactor.RedactString(ent.Message)
+	if len(fields) > 0 {
+		redacted := make([]zapcore.Field, len(fields))
+		for i, f := range fields {
+			redacted[i] = e.redactor.RedactField(f)
+		}
+		fields = redacted
+	}
+	return e.Encoder.EncodeEntry(ent, fields)
+}
+
+// fields 处理With添加的字段
+func (e *redactEncoder) fields() *redactObjectEncoder {
+	return &redactObjectEncoder{ObjectEncoder: e.Encoder, redactor: e.redactor}
+}
+
+// AddString 处理With添加的字符串字段
+func (e *redactEncoder) AddString(key, val string) {
+	e.fields().AddString(key, val)
+}
+
+// AddByteString 处理With添加的字节字段
+func (e *redactEncoder) AddByteString(key string, val []byte) {
+	e.fields().AddByteString(key, val)
+}
+
+// AddInt64 处理With添加的整数字段，例如手机号
+func (e *redactEncoder) AddInt64(key string, val int64) {
+	e.fields().AddInt64(key, val)
+}
+
+// AddUint64 处理With添加的无符号整数字段
+func (e *redactEncoder) AddUint64(key string, val uint64) {
+	e.fields().AddUint64(key, val)
+}
+
+// AddReflected 处理With添加的结构体等字段
+func (e *redactEncoder) AddReflected(key string, obj any) error {
+	return e.fields().AddReflected(key, obj)
+}
+
+// AddObject 处理With添加的zap.Object字段
+func (e *redactEncoder) AddObject(key string, obj zapcore.ObjectMarshaler) error {
+	return e.fields().AddObject(key, obj)
+}
+
+// AddArray 处理With添加的zap.Array字段
+func (e *redactEncoder) AddArray(key string, arr zapcore.ArrayMarshaler) error {
+	return e.fields().AddArray(key, arr)
+}
+
+// redactObject 处理zap.Object字段，编码时逐个处理其中的字段
+type redactObject struct {
+	zapcore.ObjectMarshaler
+	redactor *Redactor
+}
+
+// MarshalLogObject 用脱敏的编码器编码
+func (o redactObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	return o.ObjectMarshaler.MarshalLogObject(&redactObjectEncoder{ObjectEncoder: enc, redactor: o.redactor})
+}
+
+// redactArray 处理zap.Array字段，编码时逐个处理其中的元素
+type redactArray struct {
+	zapcore.ArrayMarshaler
+	redactor *Redactor
+}
+
+// MarshalLogArray 用脱敏的编码器编码
+func (a redactArray) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	return a.ArrayMarshaler.MarshalLogArray(&redactArrayEncoder{ArrayEncoder: enc, redactor: a.redactor})
+}
+
+// redactObjectEncoder 脱敏的字段编码器，处理字符串、64位整数、反射和嵌套的字段，
+// 其他类型的数值按原样输出
+type redactObjectEncoder struct {
+	zapcore.ObjectEncoder
+	redactor *Redactor
+}
+
+// AddString 敏感字段整体隐藏，其他按规则部分隐藏
+func (e *redactObjectEncoder) AddString(key, val string) {
+	if e.redactor.IsSensitiveKey(key) {
+		val = RedactMask
+	} else {
+		val = e.redactor.RedactString(val)
+	}
+	e.ObjectEncoder.AddString(key, val)
+}
+
+// AddByteString 按字符串处理
+func (e *redactObjectEncoder) AddByteString(key string, val []byte) {
+	e.AddString(key, string(val))
+}
+
+// AddInt64 敏感字段整体隐藏
+func (e *redactObjectEncoder) AddInt64(key string, val int64) {
+	if e.redactor.IsSensitiveKey(key) {
+		e.ObjectEncoder.AddString(key, RedactMask)
+	} else {
+		e.ObjectEncoder.AddInt64(key, val)
+	}
+}
+
+// AddInt 敏感字段整体隐藏
+func (e *redactObjectEncoder) AddInt(key string, val int) {
+	e.AddInt64(key, int64(val))
+}
+
+// AddUint64 敏感字段整体隐藏
+func (e *redactObjectEncoder) AddUint64(key string, val uint64) {
+	if e.redactor.IsSensitiveKey(key) {
+		e.ObjectEncoder.AddString(key, RedactMask)
+	} else {
+		e.ObjectEncoder.AddUint64(key, val)
+	}
+}
+
+// AddUint 敏感字段整体隐藏
+func (e *redactObjectEncoder) AddUint(key string, val uint) {
+	e.AddUint64(key, uint64(val))
+}
+
+// AddReflected 敏感字段整体隐藏，其他处理结构体中的内容
+func (e *redactObjectEncoder) AddReflected(key string, obj any) error {
+	if e.redactor.IsSensitiveKey(key) {
+		e.ObjectEncoder.AddString(key, RedactMask)
+		return nil
+	}
+	return e.ObjectEncoder.AddReflected(key, e.redactor.RedactValue(obj))
+}
+
+// AddObject 敏感字段整体隐藏，其他处理嵌套的字段
+func (e *redactObjectEncoder) AddObject(key string, obj zapcore.ObjectMarshaler) error {
+	if e.redactor.IsSensitiveKey(key) {
+		e.ObjectEncoder.AddString(key, RedactMask)
+		return nil
+	}
+	return e.ObjectEncoder.AddObject(key, redactObject{obj, e.redactor})
+}
+
+// AddArray 敏感字段整体隐藏，其他处理数组中的元素
+func (e *redactObjectEncoder) AddArray(key string, arr zapcore.ArrayMarshaler) error {
+	if e.redactor.IsSensitiveKey(key) {
+		e.ObjectEncoder.AddString(key, RedactMask)
+		return nil
+	}
+	return e.ObjectEncoder.AddArray(key, redactArray{arr, e.redactor})
+}
+
+// redactArrayEncoder 脱敏的数组编码器，元素没有字段名，只按规则处理字符串
+type redactArrayEncoder struct {
+	zapcore.ArrayEncoder
+	redactor *Redactor
+}
+
+// AppendString 按规则部分隐藏
+func (e *redactArrayEncoder) AppendString(val string) {
+	e.ArrayEncoder.AppendString(e.redactor.RedactString(val))
+}
+
+// AppendByteString 按字符串处理
+func (e *redactArrayEncoder) AppendByteString(val []byte) {
+	e.AppendString(string(val))
+}
+
+// AppendReflected 处理结构体中的内容
+func (e *redactArrayEncoder) AppendReflected(val any) error {
+	return e.ArrayEncoder.AppendReflected(e.redactor.RedactValue(val))
+}
+
+// AppendObject 处理嵌套的字段
+func (e *redactArrayEncoder) AppendObject(obj zapcore.ObjectMarshaler) error {
+	return e.ArrayEncoder.AppendObject(redactObject{obj, e.redactor})
+}
+
+// AppendArray 处理嵌套的数组
+func (e *redactArrayEncoder) AppendArray(arr zapcore.ArrayMarshaler) error {
+	return e.ArrayEncoder.AppendArray(redactArray{arr, e.redactor})
+}
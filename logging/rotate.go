@@ -31,6 +31,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -43,7 +44,6 @@ const (
 	backupTimeFormat = "20060102-150405"
 	shortTimeFormat  = "20060102"
 	compressSuffix   = ".gz"
-	zoneSeconds      = 28800 // the time zone of Asia/Shanghai
 )
 
 var (
@@ -64,9 +64,16 @@ var _ io.WriteCloser = (*RotateFile)(nil)
 
 // rotate For RegisterSink
 func rotate(url *url.URL) (sink zap.Sink, err error) {
-	sink = &RotateFile{Filename: url.Path, LocalTime: true, Compress: true}
-	err = form.NewDecoder().Decode(&sink, url.Query())
-	return
+	return NewRotateFile(url)
+}
+
+// NewRotateFile 根据URL参数创建日志文件，例如 rotate:///var/log/app.log?cycle=daily&comp=1
+func NewRotateFile(url *url.URL) (*RotateFile, error) {
+	l := &RotateFile{Filename: url.Path, LocalTime: true, Compress: true}
+	if err := form.NewDecoder().Decode(l, url.Query()); err != nil {
+		return l, err
+	}
+	return l, l.loadLocation()
 }
 
 // RotateFile is an io.WriteCloser that writes to the specified filename.
@@ -88,7 +95,10 @@ func rotate(url *url.URL) (sink zap.Sink, err error) {
 // time.Time format of `2006-01-02T15-04-05.000` and the extension is the
 // original extension.  For example, if your RotateFile.Filename is
 // `/var/log/foo/server.log`, a backup created at 6:30pm on Nov 11 2016 would
-// use the filename `/var/log/foo/server-2016-11-04T18-30-00.000.log`
+// use the filename `/var/log/foo/server-2016-11-04T18-30-00.000.log`.
+// When a backup with the same timestamp already exists, for example several
+// size-rotations within one daily cycle, a sequence number is appended to the
+// timestamp, such as `server-20161104.1.log`.
 //
 // # Cleaning Up Old Log Files
 //
@@ -99,7 +109,11 @@ func rotate(url *url.URL) (sink zap.Sink, err error) {
 // MaxBackups.  Note that the time encoded in the timestamp is the rotation
 // time, which may differ from the last time that file was written to.
 //
-// If MaxBackups and MaxAge are both 0, no old log files will be deleted.
+// Then the oldest files are deleted until the total size of the backups is
+// not more than MaxTotalSize megabytes.
+//
+// If MaxBackups, MaxAge and MaxTotalSize are all 0, no old log files will be
+// deleted.
 type RotateFile struct {
 	// Filename is the file to write logs to.  Backup log files will be retained
 	// in the same directory.  It uses <processname>-lumberjack.log in
@@ -137,13 +151,26 @@ type RotateFile struct {
 	// using gzip. The default is not to perform compression.
 	Compress bool `json:"compress" yaml:"compress" form:"comp"`
 
+	// MaxTotalSize is the maximum total size in megabytes of all backup
+	// files. The oldest backups are deleted when exceeded. The default is
+	// not to limit the total size.
+	MaxTotalSize int `json:"maxtotalsize" yaml:"maxtotalsize" form:"total"`
+
+	// TimeZone is the IANA name of the time zone used for cycles and the
+	// timestamps in backup files, such as Asia/Shanghai. It overrides
+	// LocalTime when not empty.
+	TimeZone string `json:"timezone" yaml:"timezone" form:"tz"`
+
 	size    int64
 	modTime time.Time
 	file    *os.File
 	mu      sync.Mutex
 
-	millCh    chan bool
-	startMill sync.Once
+	millCh chan bool
+
+	loc     *time.Location
+	locErr  error
+	loadLoc sync.Once
 }
 
 // Sync implements zap.Sink.SyncWriter
@@ -167,6 +194,9 @@ func (l *RotateFile) Write(p []byte) (n int, err error) {
 	}
 
 	if l.file == nil {
+		if err = l.loadLocation(); err != nil {
+			return 0, err
+		}
 		if err = l.openExistingOrNew(writeLen, maxSize); err != nil {
 			return 0, err
 		}
@@ -189,6 +219,10 @@ func (l *RotateFile) Write(p []byte) (n int, err error) {
 func (l *RotateFile) Close() error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	if l.millCh != nil { // stop the mill goroutine, a later Write starts it again
+		close(l.millCh)
+		l.millCh = nil
+	}
 	return l.close()
 }
 
@@ -232,13 +266,14 @@ func (l *RotateFile) check(writeLen, maxSize int64) bool {
 	if maxSize > 0 && l.size+writeLen >= maxSize {
 		return true
 	}
-	nowTime, ok := currentTime(), isCycle(l.Cycle)
-	if ok && isDiffDate(l.Cycle, l.modTime, nowTime) {
+	loc, ok := l.location(), isCycle(l.Cycle)
+	modTime, nowTime := l.modTime.In(loc), currentTime().In(loc)
+	if ok && isDiffDate(l.Cycle, modTime, nowTime) {
 		return true
 	}
 	if !ok && l.Minutely > 0 {
 		secs := int64(l.Minutely) * 60
-		if isDiffTime(secs, l.modTime, nowTime) {
+		if isDiffTime(secs, modTime, nowTime) {
 			return true
 		}
 	}
@@ -259,10 +294,7 @@ func (l *RotateFile) openNew() error {
 		// Copy the mode off the old logfile.
 		mode, last = info.Mode(), info.ModTime()
 		// move the existing file
-		if !l.LocalTime {
-			last = last.UTC()
-		}
-		newName := backupName(name, l.getTimeFormat(), last)
+		newName := l.nextBackupName(name, last.In(l.location()))
 		if err = os.Rename(name, newName); err != nil {
 			return fmt.Errorf("can't rename log file: %s", err)
 		}
@@ -319,7 +351,7 @@ func (l *RotateFile) openExistingOrNew(writeLen, maxSize int64) error {
 // files are removed, keeping at most l.MaxBackups files, as long as
 // none of them are older than MaxAge.
 func (l *RotateFile) millRunOnce() error {
-	if l.MaxBackups == 0 && l.MaxAge == 0 && !l.Compress {
+	if l.MaxBackups == 0 && l.MaxAge == 0 && l.MaxTotalSize == 0 && !l.Compress {
 		return nil
 	}
 
@@ -364,6 +396,21 @@ func (l *RotateFile) millRunOnce() error {
 		}
 		files = remaining
 	}
+	if l.MaxTotalSize > 0 {
+		limit := int64(l.MaxTotalSize) * int64(megabyte)
+		var (
+			total     int64
+			remaining []logInfo
+		)
+		for _, f := range files {
+			if total += f.Size(); total > limit {
+				remove = append(remove, f)
+			} else {
+				remaining = append(remaining, f)
+			}
+		}
+		files = remaining
+	}
 
 	if l.Compress {
 		for _, f := range files {
@@ -391,21 +438,21 @@ func (l *RotateFile) millRunOnce() error {
 }
 
 // millRun runs in a goroutine to manage post-rotation compression and removal
-// of old log files.
-func (l *RotateFile) millRun() {
-	for range l.millCh {
+// of old log files, until the channel is closed by Close.
+func (l *RotateFile) millRun(ch <-chan bool) {
+	for range ch {
 		// what am I going to do, log this?
 		_ = l.millRunOnce()
 	}
 }
 
 // mill performs post-rotation compression and removal of stale log files,
-// starting the mill goroutine if necessary.
+// starting the mill goroutine if necessary. It must be called with l.mu held.
 func (l *RotateFile) mill() {
-	l.startMill.Do(func() {
+	if l.millCh == nil {
 		l.millCh = make(chan bool, 1)
-		go l.millRun()
-	})
+		go l.millRun(l.millCh)
+	}
 	select {
 	case l.millCh <- true:
 	default:
@@ -424,6 +471,7 @@ func (l *RotateFile) oldLogFiles() ([]logInfo, error) {
 		logFiles []logInfo
 		info     os.FileInfo
 		t        time.Time
+		seq      int
 	)
 	prefix, ext := l.prefixAndExt()
 
@@ -431,15 +479,15 @@ func (l *RotateFile) oldLogFiles() ([]logInfo, error) {
 		if f.IsDir() {
 			continue
 		}
-		if t, err = l.timeFromName(f.Name(), prefix, ext); err == nil {
+		if t, seq, err = l.timeFromName(f.Name(), prefix, ext); err == nil {
 			if info, err = f.Info(); err == nil {
-				logFiles = append(logFiles, logInfo{t, info})
+				logFiles = append(logFiles, logInfo{t, seq, info})
 			}
 			continue
 		}
-		if t, err = l.timeFromName(f.Name(), prefix, ext+compressSuffix); err == nil {
+		if t, seq, err = l.timeFromName(f.Name(), prefix, ext+compressSuffix); err == nil {
 			if info, err = f.Info(); err == nil {
-				logFiles = append(logFiles, logInfo{t, info})
+				logFiles = append(logFiles, logInfo{t, seq, info})
 			}
 			continue
 		}
@@ -452,26 +500,83 @@ func (l *RotateFile) oldLogFiles() ([]logInfo, error) {
 	return logFiles, nil
 }
 
-// getTimeFormat use shortTimeFormat when cycle only
+// getTimeFormat use shortTimeFormat when cycle is longer than an hour,
+// several size-rotations in one day are told apart by sequence numbers
 func (l *RotateFile) getTimeFormat() string {
-	if l.max() == 0 && isCycle(l.Cycle) && l.Cycle != "hourly" {
+	if isCycle(l.Cycle) && l.Cycle != "hourly" {
 		return shortTimeFormat
 	}
 	return backupTimeFormat
 }
 
-// timeFromName extracts the formatted time from the filename by stripping off
-// the filename's prefix and extension. This prevents someone's filename from
-// confusing time.parse.
-func (l *RotateFile) timeFromName(filename, prefix, ext string) (time.Time, error) {
+// loadLocation loads the time zone once, an unknown TimeZone is an error.
+func (l *RotateFile) loadLocation() error {
+	l.loadLoc.Do(func() {
+		l.loc = time.UTC
+		if l.LocalTime {
+			l.loc = time.Local
+		}
+		if l.TimeZone != "" {
+			loc, err := time.LoadLocation(l.TimeZone)
+			if err != nil {
+				l.locErr = fmt.Errorf("invalid time zone %q: %w", l.TimeZone, err)
+				return
+			}
+			l.loc = loc
+		}
+	})
+	return l.locErr
+}
+
+// location returns the time zone for cycles and backup names
+func (l *RotateFile) location() *time.Location {
+	_ = l.loadLocation()
+	return l.loc
+}
+
+// nextBackupName returns a backup name which is not used, adding a sequence
+// number after the timestamp when there are backups in the same period.
+func (l *RotateFile) nextBackupName(name string, last time.Time) string {
+	timestamp := last.Format(l.getTimeFormat())
+	for seq := 0; ; seq++ {
+		ts := timestamp
+		if seq > 0 {
+			ts += "." + strconv.Itoa(seq)
+		}
+		newName := backupName(name, ts)
+		if _, err := osStat(newName); err == nil {
+			continue
+		}
+		if _, err := osStat(newName + compressSuffix); err == nil {
+			continue
+		}
+		return newName
+	}
+}
+
+// timeFromName extracts the formatted time and the sequence number from the
+// filename by stripping off the filename's prefix and extension. This prevents
+// someone's filename from confusing time.parse.
+func (l *RotateFile) timeFromName(filename, prefix, ext string) (t time.Time, seq int, err error) {
 	if !strings.HasPrefix(filename, prefix) {
-		return time.Time{}, errors.New("mismatched prefix")
+		return t, 0, errors.New("mismatched prefix")
 	}
 	if !strings.HasSuffix(filename, ext) {
-		return time.Time{}, errors.New("mismatched extension")
+		return t, 0, errors.New("mismatched extension")
 	}
 	ts := filename[len(prefix) : len(filename)-len(ext)]
-	return time.Parse(l.getTimeFormat(), ts)
+	if pos := strings.LastIndexByte(ts, '.'); pos > 0 {
+		if seq, err = strconv.Atoi(ts[pos+1:]); err != nil {
+			return t, 0, err
+		}
+		ts = ts[:pos]
+	}
+	format := l.getTimeFormat()
+	if t, err = time.ParseInLocation(format, ts, l.location()); err != nil && format != backupTimeFormat {
+		// backups named before cycle and size were combined
+		t, err = time.ParseInLocation(backupTimeFormat, ts, l.location())
+	}
+	return t, seq, err
 }
 
 // max returns the maximum size in bytes of log files before rolling.
@@ -531,13 +636,17 @@ func isDiffDate(cycle string, modTime, nowTime time.Time) bool {
 	return modTime.Format(layout) != nowTime.Format(layout)
 }
 
-// isDiffTime the time.Time is not in the same cycle
+// isDiffTime the time.Time is not in the same cycle, the cycles are aligned
+// to the time zone of the given times. The cycle is given in seconds and is at
+// most 720 minutes, the upper bound of Minutely.
 func isDiffTime(secs int64, modTime, nowTime time.Time) bool {
-	if secs <= 0 || secs > 720 {
+	if secs <= 0 || secs > 720*60 {
 		return false
 	}
-	modStamp := modTime.Unix() + zoneSeconds
-	nowStamp := nowTime.Unix() + zoneSeconds
+	_, modOffset := modTime.Zone()
+	_, nowOffset := nowTime.Zone()
+	modStamp := modTime.Unix() + int64(modOffset)
+	nowStamp := nowTime.Unix() + int64(nowOffset)
 	diff := nowStamp - modStamp
 	if diff < 0 && 0-diff >= secs || diff >= secs {
 		return true
@@ -546,14 +655,12 @@ func isDiffTime(secs int64, modTime, nowTime time.Time) bool {
 }
 
 // backupName creates a new filename from the given name, inserting a timestamp
-// between the filename and the extension, using the local time if requested
-// (otherwise UTC).
-func backupName(name, timeFormat string, last time.Time) string {
+// between the filename and the extension.
+func backupName(name, timestamp string) string {
 	dir := filepath.Dir(name)
 	filename := filepath.Base(name)
 	ext := filepath.Ext(filename)
 	prefix := filename[:len(filename)-len(ext)]
-	timestamp := last.Format(timeFormat)
 	return filepath.Join(dir, fmt.Sprintf("%s-%s%s", prefix, timestamp, ext))
 }
 
@@ -616,13 +723,18 @@ func compressLogFile(src, dst string) (err error) {
 // timestamp.
 type logInfo struct {
 	timestamp time.Time
+	seq       int
 	os.FileInfo
 }
 
-// byFormatTime sorts by newest time formatted in the name.
+// byFormatTime sorts by newest time formatted in the name, and then by the
+// largest sequence number.
 type byFormatTime []logInfo
 
 func (b byFormatTime) Less(i, j int) bool {
+	if b[i].timestamp.Equal(b[j].timestamp) {
+		return b[i].seq > b[j].seq
+	}
 	return b[i].timestamp.After(b[j].timestamp)
 }
 
@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeMegabyte 测试时把MaxSize等的单位改为1字节
+func fakeMegabyte(t *testing.T) {
+	old := megabyte
+	megabyte = 1
+	t.Cleanup(func() { megabyte = old })
+}
+
+func TestRotateSequence(t *testing.T) {
+	fakeMegabyte(t)
+	dir := t.TempDir()
+	l := &RotateFile{
+		Filename: filepath.Join(dir, "app.log"),
+		MaxSize:  10, Cycle: "daily", TimeZone: "Asia/Shanghai",
+	}
+	defer l.Close()
+	for i := 0; i < 4; i++ {
+		_, err := l.Write([]byte("012345678"))
+		assert.NoError(t, err)
+	}
+	files, err := l.oldLogFiles()
+	assert.NoError(t, err)
+	assert.Len(t, files, 3)
+	day := time.Now().In(l.location()).Format(shortTimeFormat)
+	assert.Equal(t, "app-"+day+".2.log", files[0].Name())
+	assert.Equal(t, "app-"+day+".log", files[2].Name())
+}
+
+func TestRotateTotalSize(t *testing.T) {
+	fakeMegabyte(t)
+	dir := t.TempDir()
+	l := &RotateFile{Filename: filepath.Join(dir, "app.log"), MaxTotalSize: 25}
+	for i := 1; i <= 4; i++ {
+		name := filepath.Join(dir, "app-2024010"+string(rune('0'+i))+"-000000.log")
+		assert.NoError(t, os.WriteFile(name, []byte("0123456789"), 0o644))
+	}
+	assert.NoError(t, l.millRunOnce())
+	files, err := l.oldLogFiles()
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+	assert.Equal(t, "app-20240104-000000.log", files[0].Name())
+}
+
+func TestRotateTimeZone(t *testing.T) {
+	u, _ := url.Parse("rotate:///tmp/app.log?tz=Nowhere/Unknown")
+	_, err := NewRotateFile(u)
+	assert.Error(t, err)
+	l := &RotateFile{Filename: filepath.Join(t.TempDir(), "app.log"), TimeZone: "Nowhere/Unknown"}
+	_, err = l.Write([]byte("hello"))
+	assert.Error(t, err)
+}
+
+func TestIsDiffTime(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	modTime := time.Date(2024, 1, 1, 7, 59, 0, 0, loc)
+	assert.False(t, isDiffTime(3600, modTime, modTime.Add(time.Second*30)))
+	assert.True(t, isDiffTime(3600, modTime, modTime.Add(time.Minute)))
+	assert.False(t, isDiffTime(720*60, modTime, modTime.Add(time.Hour*4)))
+	assert.True(t, isDiffTime(720*60, modTime, modTime.Add(time.Hour*5)))
+	assert.False(t, isDiffTime(721*60, modTime, modTime.Add(time.Hour*24)))
+}
@@ -0,0 +1,134 @@
+package logging
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// RepeatedKey 去重后记录重复次数的字段名
+const RepeatedKey = "repeated"
+
+// Sampling 采样配置，每个周期内同样的消息先记录前First条，之后每Thereafter条记录一条
+type Sampling struct {
+	Interval   time.Duration
+	First      int
+	Thereafter int
+}
+
+// Wrap 为内核加上采样
+func (s *Sampling) Wrap(core zapcore.Core) zapcore.Core {
+	if s == nil || s.First <= 0 {
+		return core
+	}
+	tick := s.Interval
+	if tick <= 0 {
+		tick = time.Second
+	}
+	return zapcore.NewSamplerWithOptions(core, tick, s.First, s.Thereafter)
+}
+
+// dedupItem 窗口内的重复消息
+type dedupItem struct {
+	core   zapcore.Core // 写入这条消息的内核，子内核带有各自的字段
+	entry  zapcore.Entry
+	fields []zapcore.Field
+	count  int
+}
+
+// dedupState 去重状态，同一个内核派生出的子内核共用
+type dedupState struct {
+	window time.Duration
+	items  map[string]*dedupItem
+	seq    int // 子内核的编号，用作去重键的前缀
+	mu     sync.Mutex
+}
+
+// DedupCore 去重内核，窗口内相同级别和内容的消息只记录第一条，
+// 窗口结束后再补记一条带重复次数的消息
+type DedupCore struct {
+	zapcore.Core
+	state  *dedupState
+	prefix string
+}
+
+// NewDedupCore 创建去重内核，窗口为0时不去重
+func NewDedupCore(core zapcore.Core, window time.Duration) zapcore.Core {
+	if window <= 0 {
+		return core
+	}
+	state := &dedupState{window: window, items: make(map[string]*dedupItem)}
+	return &DedupCore{Core: core, state: state}
+}
+
+// With 增加字段，子内核和父内核共用状态，但消息单独去重
+func (c *DedupCore) With(fields []zapcore.Field) zapcore.Core {
+	s := c.state
+	s.mu.Lock()
+	s.seq++
+	prefix := strconv.Itoa(s.seq) + "|"
+	s.mu.Unlock()
+	return &DedupCore{Core: c.Core.With(fields), state: s, prefix: prefix}
+}
+
+// Check 检查是否需要记录
+func (c *DedupCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write 写入消息，窗口内重复的消息只计数
+func (c *DedupCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	s := c.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := c.prefix + ent.Level.String() + "|" + ent.Message
+	if item, ok := s.items[key]; ok && ent.Time.Sub(item.entry.Time) < s.window {
+		item.count++
+		return nil
+	}
+	err := c.flush(ent.Time, false)
+	s.items[key] = &dedupItem{core: c.Core, entry: ent, fields: fields}
+	if errWrite := c.Core.Write(ent, fields); err == nil {
+		err = errWrite
+	}
+	return err
+}
+
+// Sync 补记所有重复消息后同步，包括子内核的消息
+func (c *DedupCore) Sync() error {
+	c.state.mu.Lock()
+	err := c.flush(time.Now(), true)
+	c.state.mu.Unlock()
+	if errSync := c.Core.Sync(); err == nil {
+		err = errSync
+	}
+	return err
+}
+
+// flush 补记已经超出窗口的重复消息，all为真时补记全部
+func (c *DedupCore) flush(now time.Time, all bool) (err error) {
+	s := c.state
+	for key, item := range s.items {
+		if !all && now.Sub(item.entry.Time) < s.window {
+			continue
+		}
+		delete(s.items, key)
+		if item.count == 0 {
+			continue
+		}
+		ent := item.entry
+		ent.Time = now
+		fields := append(item.fields[:len(item.fields):len(item.fields)],
+			zap.Int(RepeatedKey, item.count))
+		if errWrite := item.core.Write(ent, fields); err == nil {
+			err = errWrite
+		}
+	}
+	return
+}
@@ -0,0 +1,344 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-playground/form/v4"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	SyslogSDID    = "fields@32473" // RFC5424结构化数据的ID，32473是文档示例用的企业编号
+	SyslogTimeout = 5              // 默认的连接和写入超时，单位秒
+)
+
+// SyslogFacilities 设施名称和编号
+var SyslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// ensure we always implement zap.Sink
+var (
+	_ zap.Sink = (*SyslogWriter)(nil)
+	_ zap.Sink = (*JournalWriter)(nil)
+)
+
+// syslog 注册的syslog地址，例如 syslog://127.0.0.1:514?net=udp&app=web
+func syslog(u *url.URL) (zap.Sink, error) {
+	return NewSyslogWriter(u)
+}
+
+// Severity zap级别对应的syslog严重程度
+func Severity(level zapcore.Level) int {
+	switch level {
+	case zapcore.DebugLevel:
+		return 7
+	case zapcore.InfoLevel:
+		return 6
+	case zapcore.WarnLevel:
+		return 4
+	case zapcore.ErrorLevel, zapcore.DPanicLevel:
+		return 3
+	default: // panic和fatal
+		return 2
+	}
+}
+
+// entrySeverity 日志记录的严重程度
+func entrySeverity(e *LogEntry) int {
+	_, level := GetZapLevel(e.GetLevel())
+	return Severity(level)
+}
+
+// EntryWriter 直接写入日志记录的输出，级别和字段不经过编码器，例如syslog和journald
+type EntryWriter interface {
+	WriteEntry(e *LogEntry) error
+	Close() error
+}
+
+// OpenEntryWriter 根据syslog或journald地址创建输出
+func OpenEntryWriter(addr string) (EntryWriter, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "syslog":
+		return NewSyslogWriter(u)
+	case "journald":
+		return NewJournalWriter(u)
+	}
+	return nil, fmt.Errorf("unknown entry writer %q", addr)
+}
+
+// NewEntryCore 创建写入EntryWriter的内核，redactor不为空时先脱敏
+func NewEntryCore(w EntryWriter, enabler zapcore.LevelEnabler, redactor *Redactor) zapcore.Core {
+	return &entryCore{LevelEnabler: enabler, writer: w, redactor: redactor}
+}
+
+// entryCore 把日志记录和字段直接交给EntryWriter
+type entryCore struct {
+	zapcore.LevelEnabler
+	writer   EntryWriter
+	redactor *Redactor
+	fields   []zapcore.Field // With添加的字段
+}
+
+// With 增加字段
+func (c *entryCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = append(c.fields[:len(c.fields):len(c.fields)], fields...)
+	return &clone
+}
+
+// Check 检查是否需要记录
+func (c *entryCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write 转为LogEntry后写入，与编码器的配置一致，不包括调用者
+func (c *entryCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if len(c.fields) > 0 {
+		fields = append(c.fields[:len(c.fields):len(c.fields)], fields...)
+	}
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range fields {
+		if c.redactor != nil {
+			f = c.redactor.RedactField(f)
+		}
+		f.AddTo(enc)
+	}
+	e := &LogEntry{
+		Time: ent.Time, Level: ent.Level.String(), Name: ent.LoggerName,
+		Message: ent.Message, Stack: ent.Stack, Fields: enc.Fields,
+	}
+	if c.redactor != nil {
+		e.Message = c.redactor.RedactString(e.Message)
+	}
+	return c.writer.WriteEntry(e)
+}
+
+// Sync 无需同步
+func (c *entryCore) Sync() error {
+	return nil
+}
+
+// parseEntry 解析zap写入的一条日志，解析不了时整体作为消息，
+// 只用于直接作为zap.Sink使用时，级别和字段依赖编码的格式
+func parseEntry(p []byte, timeFormat string) *LogEntry {
+	text := strings.TrimRight(string(p), "\r\n")
+	line, stack, _ := strings.Cut(text, "\n")
+	e := ParseLogLine(line, timeFormat)
+	if e == nil {
+		return &LogEntry{Time: time.Now(), Message: text, Raw: text}
+	}
+	e.Stack = stack
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	return e
+}
+
+// SyslogWriter 按RFC5424格式写入syslog，支持udp、tcp和unix套接字
+type SyslogWriter struct {
+	Network    string `form:"net"`      // udp、tcp、unix或unixgram，默认有主机时udp，否则unixgram
+	Address    string `form:"-"`        // 主机端口或套接字路径
+	Facility   string `form:"facility"` // 默认user
+	AppName    string `form:"app"`      // 默认为程序名
+	Hostname   string `form:"hostname"` // 默认为本机名
+	TimeFormat string `form:"tf"`       // 解析日志时间的格式
+	Timeout    int    `form:"timeout"`  // 连接和每次写入的超时，单位秒，默认5秒
+	facility   int
+	conn       net.Conn
+	mu         sync.Mutex
+}
+
+// NewSyslogWriter 根据URL创建，例如 syslog:///dev/log 或 syslog://10.0.0.1:601?net=tcp
+func NewSyslogWriter(u *url.URL) (*SyslogWriter, error) {
+	w := &SyslogWriter{Address: u.Host}
+	if err := form.NewDecoder().Decode(w, u.Query()); err != nil {
+		return nil, err
+	}
+	if w.Address == "" {
+		w.Address = u.Path
+	}
+	if w.Network == "" {
+		if w.Network = "udp"; u.Host == "" {
+			w.Network = "unixgram"
+		}
+	}
+	if w.Facility == "" {
+		w.Facility = "user"
+	}
+	var ok bool
+	if w.facility, ok = SyslogFacilities[strings.ToLower(w.Facility)]; !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", w.Facility)
+	}
+	if w.AppName == "" {
+		w.AppName = filepath.Base(os.Args[0])
+	}
+	if w.Hostname == "" {
+		w.Hostname, _ = os.Hostname()
+	}
+	if w.Timeout <= 0 {
+		w.Timeout = SyslogTimeout
+	}
+	return w, nil
+}
+
+// Write 解析编码后的日志再发送，只用于直接作为zap.Sink使用时
+func (w *SyslogWriter) Write(p []byte) (int, error) {
+	if err := w.WriteEntry(parseEntry(p, w.TimeFormat)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteEntry 实现EntryWriter，转为syslog消息发送，连接断开时重连一次
+// 每次写入都有超时，服务端没有响应时关闭连接，下次写入时重连
+func (w *SyslogWriter) WriteEntry(e *LogEntry) error {
+	msg := w.frame(w.Format(e))
+	timeout := time.Duration(w.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = SyslogTimeout * time.Second
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := 0; ; i++ {
+		if w.conn == nil {
+			conn, err := net.DialTimeout(w.Network, w.Address, timeout)
+			if err != nil {
+				return err
+			}
+			w.conn = conn
+		}
+		err := w.conn.SetWriteDeadline(time.Now().Add(timeout))
+		if err == nil {
+			_, err = w.conn.Write(msg)
+		}
+		if err == nil {
+			return nil
+		}
+		_ = w.conn.Close()
+		w.conn = nil
+		var netErr net.Error
+		if i > 0 || errors.As(err, &netErr) && netErr.Timeout() { // 超时不再重试
+			return err
+		}
+	}
+}
+
+// frame 流式连接需要分帧，tcp使用长度前缀，unix使用换行
+func (w *SyslogWriter) frame(msg []byte) []byte {
+	switch w.Network {
+	case "tcp", "tcp4", "tcp6":
+		return append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	case "unix":
+		return append(msg, '\n')
+	}
+	return msg
+}
+
+// Format 生成RFC5424格式的消息
+func (w *SyslogWriter) Format(e *LogEntry) []byte {
+	var buf bytes.Buffer
+	pri := w.facility*8 + entrySeverity(e)
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s %d %s ", pri,
+		e.Time.Format("2006-01-02T15:04:05.000000Z07:00"), syslogName(w.Hostname, 255),
+		syslogName(w.AppName, 48), os.Getpid(), syslogName(e.Name, 32))
+	writeStructuredData(&buf, e)
+	buf.WriteByte(' ')
+	buf.WriteString(e.Message)
+	if e.Stack != "" {
+		buf.WriteString("\n" + e.Stack)
+	}
+	return buf.Bytes()
+}
+
+// Sync 无需同步
+func (w *SyslogWriter) Sync() error {
+	return nil
+}
+
+// Close 关闭连接
+func (w *SyslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// syslogName 头部的名称，只能是可见ASCII字符，为空时用减号
+func syslogName(name string, size int) string {
+	name = strings.Map(func(r rune) rune {
+		if r > 32 && r < 127 {
+			return r
+		}
+		return -1
+	}, name)
+	if name == "" {
+		return "-"
+	}
+	return name[:min(len(name), size)]
+}
+
+// writeStructuredData 字段和调用位置作为结构化数据
+func writeStructuredData(buf *bytes.Buffer, e *LogEntry) {
+	if len(e.Fields) == 0 && e.Caller == "" {
+		buf.WriteByte('-')
+		return
+	}
+	buf.WriteString("[" + SyslogSDID)
+	if e.Caller != "" {
+		writeParam(buf, "caller", e.Caller)
+	}
+	for _, key := range sortedKeys(e.Fields) {
+		writeParam(buf, key, e.Fields[key])
+	}
+	buf.WriteByte(']')
+}
+
+// writeParam 写入一个参数，名称去掉不允许的字符，值转义引号、反斜杠和右括号
+func writeParam(buf *bytes.Buffer, key string, val any) {
+	name := strings.Map(func(r rune) rune {
+		if r <= 32 || r >= 127 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+	value := fmt.Sprint(val)
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+	fmt.Fprintf(buf, ` %s="%s"`, name[:min(len(name), 32)], value)
+}
+
+// sortedKeys 排序后的字段名
+func sortedKeys(fields map[string]any) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}